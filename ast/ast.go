@@ -36,11 +36,12 @@ type Ident struct {
 func (i *Ident) exprNode()        {}
 func (i *Ident) TokenLit() string { return i.Token.Lit }
 
-// An AssignStmt represents a
+// An AssignStmt represents an assignment to a variable, an element of an
+// array or map, or a field
 type AssignStmt struct {
-	Token grammar.Token // the grammar.VAR token
-	Name  *Ident
-	Value Expr
+	Token  grammar.Token // the grammar.ASSIGN token
+	Target Expr          // an Ident, IndexExpr or SelectorExpr
+	Value  Expr
 }
 
 func (vs *AssignStmt) stmtNode()        {}
@@ -64,22 +65,43 @@ type BlockStmt struct {
 func (bs *BlockStmt) stmtNode()        {}
 func (bs *BlockStmt) TokenLit() string { return bs.Token.Lit }
 
-// A VarStmt node represents a variable statement
+// A VarStmt node represents a variable or constant declaration
 type VarStmt struct {
-	Token grammar.Token
-	Name  *Ident
-	Value Expr
+	Token   grammar.Token // the grammar.VAR or grammar.CONST token
+	Name    *Ident
+	Pattern Pattern // set instead of Name by destructuring declarations
+	Value   Expr
 }
 
 func (vs *VarStmt) stmtNode()        {}
 func (vs *VarStmt) TokenLit() string { return vs.Token.Lit }
 
-// An IfStmt node represents an if statement
+// An ImportStmt node represents an import statement
+type ImportStmt struct {
+	Token grammar.Token // the grammar.IMPORT token
+	Path  *StringLit
+	Name  *Ident // nil if the module is bound to the name of its file
+}
+
+func (is *ImportStmt) stmtNode()        {}
+func (is *ImportStmt) TokenLit() string { return is.Token.Lit }
+
+// An ExportStmt node represents a declaration exported from a module
+type ExportStmt struct {
+	Token grammar.Token // the grammar.EXPORT token
+	Decl  Stmt          // a *VarStmt, *RecordStmt, *ClassStmt or *EnumStmt
+}
+
+func (es *ExportStmt) stmtNode()        {}
+func (es *ExportStmt) TokenLit() string { return es.Token.Lit }
+
+// An IfStmt node represents an if statement, which is also an expression
+// whose value is that of the branch taken
 type IfStmt struct {
 	Token grammar.Token
 	Cond  Expr
 	Body  *BlockStmt
-	Else  *BlockStmt
+	Else  Node // *BlockStmt, *IfStmt for else if, or nil
 }
 
 func (is *IfStmt) exprNode()        {}
@@ -95,11 +117,23 @@ type BinaryExpr struct {
 func (be *BinaryExpr) exprNode()        {}
 func (be *BinaryExpr) TokenLit() string { return be.Op.Lit }
 
+// A UnaryExpr node represents a prefix operator applied to an operand, such
+// as -x or !ok
+type UnaryExpr struct {
+	Op grammar.Token // operator
+	X  Expr          // operand
+}
+
+func (ue *UnaryExpr) exprNode()        {}
+func (ue *UnaryExpr) TokenLit() string { return ue.Op.Lit }
+
 // An FunLit represents a function literal
 type FunLit struct {
-	Token  grammar.Token
-	Params []*Ident
-	Body   *BlockStmt
+	Token     grammar.Token
+	Params    []Pattern
+	Body      *BlockStmt
+	Generator bool // whether Body yields, not counting nested functions
+	Async     bool // whether the function is declared async
 }
 
 func (fl *FunLit) exprNode()        {}
@@ -115,6 +149,68 @@ type CallExpr struct {
 func (ce *CallExpr) exprNode()        {}
 func (ce *CallExpr) TokenLit() string { return ce.Token.Lit }
 
+// A SelectorExpr node represents an expression followed by a selector
+type SelectorExpr struct {
+	Token grammar.Token // the grammar.DOT token
+	X     Expr          // expression
+	Sel   *Ident        // field selector
+}
+
+func (se *SelectorExpr) exprNode()        {}
+func (se *SelectorExpr) TokenLit() string { return se.Token.Lit }
+
+// An IntLit node represents an integer literal
+type IntLit struct {
+	Token grammar.Token
+	Value int64
+}
+
+func (il *IntLit) exprNode()        {}
+func (il *IntLit) TokenLit() string { return il.Token.Lit }
+
+// A FloatLit node represents a floating-point literal
+type FloatLit struct {
+	Token grammar.Token
+	Value float64
+}
+
+func (fl *FloatLit) exprNode()        {}
+func (fl *FloatLit) TokenLit() string { return fl.Token.Lit }
+
+// An ArrayLit node represents an array literal
+type ArrayLit struct {
+	Token grammar.Token // the grammar.LBRACKET token
+	Elems []Expr
+}
+
+func (al *ArrayLit) exprNode()        {}
+func (al *ArrayLit) TokenLit() string { return al.Token.Lit }
+
+// A KeyValueExpr node represents a (key : value) pair in a map literal
+type KeyValueExpr struct {
+	Key   Expr
+	Value Expr
+}
+
+// A MapLit node represents a map literal
+type MapLit struct {
+	Token grammar.Token // the grammar.LBRACE token
+	Pairs []*KeyValueExpr
+}
+
+func (ml *MapLit) exprNode()        {}
+func (ml *MapLit) TokenLit() string { return ml.Token.Lit }
+
+// An IndexExpr node represents an expression followed by an index
+type IndexExpr struct {
+	Token grammar.Token // the grammar.LBRACKET token
+	X     Expr          // expression
+	Index Expr          // index expression
+}
+
+func (ie *IndexExpr) exprNode()        {}
+func (ie *IndexExpr) TokenLit() string { return ie.Token.Lit }
+
 // An StringLit node represents a string literal
 type StringLit struct {
 	Token grammar.Token
@@ -124,6 +220,16 @@ type StringLit struct {
 func (sl *StringLit) exprNode()        {}
 func (sl *StringLit) TokenLit() string { return sl.Token.Lit }
 
+// A RegexLit node represents a regular expression literal
+type RegexLit struct {
+	Token   grammar.Token
+	Pattern string
+	Flags   string
+}
+
+func (rl *RegexLit) exprNode()        {}
+func (rl *RegexLit) TokenLit() string { return rl.Token.Lit }
+
 // An BoolLit node represents a boolean literal
 type BoolLit struct {
 	Token grammar.Token
@@ -132,3 +238,215 @@ type BoolLit struct {
 
 func (bl *BoolLit) exprNode()        {}
 func (bl *BoolLit) TokenLit() string { return bl.Token.Lit }
+
+// A NullLit node represents the null literal
+type NullLit struct {
+	Token grammar.Token
+}
+
+func (nl *NullLit) exprNode()        {}
+func (nl *NullLit) TokenLit() string { return nl.Token.Lit }
+
+// A MatchExpr node represents a match expression
+type MatchExpr struct {
+	Token   grammar.Token // the grammar.MATCH token
+	Subject Expr
+	Arms    []*MatchArm
+}
+
+func (me *MatchExpr) exprNode()        {}
+func (me *MatchExpr) TokenLit() string { return me.Token.Lit }
+
+// A MatchArm node represents a (pattern if guard => body) arm of a match
+// expression
+type MatchArm struct {
+	Pattern Pattern
+	Guard   Expr // nil if the arm has no guard
+	Body    Node // *BlockStmt or Expr
+}
+
+// Pattern nodes implement the Pattern interface
+type Pattern interface {
+	Node
+	patternNode()
+}
+
+// A WildcardPattern node represents the _ pattern, which matches anything
+type WildcardPattern struct {
+	Token grammar.Token
+}
+
+func (wp *WildcardPattern) patternNode()     {}
+func (wp *WildcardPattern) TokenLit() string { return wp.Token.Lit }
+
+// A BindingPattern node represents a name bound to the value it matches,
+// unless the name is that of a variant of an enum without fields, which it
+// matches instead
+type BindingPattern struct {
+	Name *Ident
+}
+
+func (bp *BindingPattern) patternNode()     {}
+func (bp *BindingPattern) TokenLit() string { return bp.Name.Token.Lit }
+
+// A LiteralPattern node represents a literal matching equal values
+type LiteralPattern struct {
+	Value Expr // an IntLit, FloatLit, StringLit, BoolLit or NullLit, or a negated number
+}
+
+func (lp *LiteralPattern) patternNode()     {}
+func (lp *LiteralPattern) TokenLit() string { return lp.Value.TokenLit() }
+
+// An ArrayPattern node represents a pattern matching arrays of as many
+// elements as it has patterns, or at least as many if it has a rest pattern
+type ArrayPattern struct {
+	Token grammar.Token // the grammar.LBRACKET token
+	Elems []Pattern
+	Rest  Pattern // matches the remaining elements, nil if there is no ...rest
+}
+
+func (ap *ArrayPattern) patternNode()     {}
+func (ap *ArrayPattern) TokenLit() string { return ap.Token.Lit }
+
+// A MapPattern node represents a pattern matching maps holding at least its
+// keys
+type MapPattern struct {
+	Token  grammar.Token // the grammar.LBRACE token
+	Keys   []string
+	Values []Pattern
+}
+
+func (mp *MapPattern) patternNode()     {}
+func (mp *MapPattern) TokenLit() string { return mp.Token.Lit }
+
+// A TypePattern node represents a (pattern : Type) pattern, matching values
+// of the named type that also match the inner pattern
+type TypePattern struct {
+	Pattern Pattern
+	Type    *Ident
+}
+
+func (tp *TypePattern) patternNode()     {}
+func (tp *TypePattern) TokenLit() string { return tp.Pattern.TokenLit() }
+
+// A RecordStmt node represents a record type declaration
+type RecordStmt struct {
+	Token  grammar.Token // the grammar.RECORD token
+	Name   *Ident
+	Fields []*Ident
+}
+
+func (rs *RecordStmt) stmtNode()        {}
+func (rs *RecordStmt) TokenLit() string { return rs.Token.Lit }
+
+// A WithExpr node represents a copy of a record with some fields replaced
+type WithExpr struct {
+	Token  grammar.Token // the grammar.WITH token
+	X      Expr
+	Fields []*KeyValueExpr // keys are *Idents naming fields
+}
+
+func (we *WithExpr) exprNode()        {}
+func (we *WithExpr) TokenLit() string { return we.Token.Lit }
+
+// A ClassStmt node represents a class declaration
+type ClassStmt struct {
+	Token   grammar.Token // the grammar.CLASS token
+	Name    *Ident
+	Super   *Ident // nil if the class does not extend another
+	Methods []*MethodDecl
+}
+
+func (cs *ClassStmt) stmtNode()        {}
+func (cs *ClassStmt) TokenLit() string { return cs.Token.Lit }
+
+// A MethodDecl node represents a method of a class declaration
+type MethodDecl struct {
+	Name *Ident
+	Fun  *FunLit
+}
+
+// A ConstructorPattern node represents a pattern such as Circle(r) or
+// Shape.Empty, matching values built by the named constructor whose fields
+// match the argument patterns
+type ConstructorPattern struct {
+	Path []*Ident  // the constructor, possibly qualified by its enum
+	Args []Pattern // nil if the pattern has no parentheses
+}
+
+func (cp *ConstructorPattern) patternNode()     {}
+func (cp *ConstructorPattern) TokenLit() string { return cp.Path[0].Token.Lit }
+
+// An EnumStmt node represents an enum declaration
+type EnumStmt struct {
+	Token    grammar.Token // the grammar.ENUM token
+	Name     *Ident
+	Variants []*EnumVariant
+}
+
+func (es *EnumStmt) stmtNode()        {}
+func (es *EnumStmt) TokenLit() string { return es.Token.Lit }
+
+// An EnumVariant node represents a variant of an enum declaration
+type EnumVariant struct {
+	Name   *Ident
+	Fields []*Ident // nil if the variant has no parentheses
+}
+
+// A YieldExpr node represents a value yielded by a generator function
+type YieldExpr struct {
+	Token grammar.Token // the grammar.YIELD token
+	Value Expr
+}
+
+func (ye *YieldExpr) exprNode()        {}
+func (ye *YieldExpr) TokenLit() string { return ye.Token.Lit }
+
+// A ForStmt node represents a loop over the values of an iterable
+type ForStmt struct {
+	Token   grammar.Token // the grammar.FOR token
+	Pattern Pattern
+	Iter    Expr
+	Body    *BlockStmt
+}
+
+func (fs *ForStmt) stmtNode()        {}
+func (fs *ForStmt) TokenLit() string { return fs.Token.Lit }
+
+// A SpawnExpr node represents a function call run as a new task
+type SpawnExpr struct {
+	Token grammar.Token // the grammar.SPAWN token
+	Call  *CallExpr
+}
+
+func (se *SpawnExpr) exprNode()        {}
+func (se *SpawnExpr) TokenLit() string { return se.Token.Lit }
+
+// A SelectExpr node represents a select expression, whose value is that of
+// the case whose channel operation proceeds first
+type SelectExpr struct {
+	Token   grammar.Token // the grammar.SELECT token
+	Cases   []*SelectCase
+	Default Node // *BlockStmt or Expr, nil if there is no _ case
+}
+
+func (se *SelectExpr) exprNode()        {}
+func (se *SelectExpr) TokenLit() string { return se.Token.Lit }
+
+// A SelectCase node represents a (recv(ch) as pattern => body) or
+// (send(ch, value) => body) case of a select expression
+type SelectCase struct {
+	Chan    Expr
+	Value   Expr    // the value sent, nil for a receive
+	Pattern Pattern // bound to the value received, nil if there is none
+	Body    Node    // *BlockStmt or Expr
+}
+
+// An AwaitExpr node represents waiting for a promise to settle
+type AwaitExpr struct {
+	Token grammar.Token // the grammar.AWAIT token
+	Value Expr
+}
+
+func (ae *AwaitExpr) exprNode()        {}
+func (ae *AwaitExpr) TokenLit() string { return ae.Token.Lit }
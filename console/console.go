@@ -2,6 +2,7 @@ package console
 
 import (
 	"bufio"
+	"context"
 	"fmt"
 	"io"
 
@@ -17,7 +18,7 @@ const (
 
 func StartRepl(in io.Reader, out io.Writer) {
 	bufScanner := bufio.NewScanner(in)
-	env := types.NewEnv()
+	env := types.NewEnv(types.WithStdout(out))
 
 	fmt.Fprint(out, welcomeMessage)
 
@@ -42,7 +43,7 @@ func StartRepl(in io.Reader, out io.Writer) {
 			}
 		}
 
-		evaluated := types.Eval(ast, env)
+		evaluated := types.Eval(context.Background(), ast, env)
 		if evaluated != nil {
 			_, _ = io.WriteString(out, evaluated.Inspect())
 			_, _ = io.WriteString(out, "\n")
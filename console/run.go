@@ -0,0 +1,43 @@
+package console
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gramidt/mash-lang-for-codemash/parser"
+	"github.com/gramidt/mash-lang-for-codemash/scanner"
+	"github.com/gramidt/mash-lang-for-codemash/types"
+)
+
+// RunFile evaluates the script at path in env. Parser errors and a script
+// evaluating to an Error are returned as a Go error.
+func RunFile(ctx context.Context, path string, env *types.Env) error {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	env.SetDir(filepath.Dir(path))
+
+	return Run(ctx, string(src), env)
+}
+
+// Run evaluates the script src in env.
+func Run(ctx context.Context, src string, env *types.Env) error {
+	parser := parser.NewParser(scanner.NewScanner(src))
+	ast := parser.Parse()
+
+	if len(parser.Errors()) != 0 {
+		return errors.New("parser errors:\n\t" + strings.Join(parser.Errors(), "\n\t"))
+	}
+
+	if err, ok := types.Eval(ctx, ast, env).(*types.Error); ok {
+		return fmt.Errorf("%s", err.Inspect())
+	}
+
+	return nil
+}
@@ -16,28 +16,65 @@ const (
 
 	// Literals (identifiers and basic types)
 	IDENT
+	INT
+	FLOAT
 	STRING
+	REGEX
 
 	// Operators
 	ASSIGN
+	ARROW
 	ADD
+	SUB
+	MUL
+	QUO
+	REM
 	EQ
+	NEQ
+	LSS
+	GTR
+	LEQ
+	GEQ
+	NOT
 
 	// Delimiters
 	COMMA
+	DOT
+	ELLIPSIS
+	COLON
 	SEMICOLON
 	LPAREN
 	RPAREN
+	LBRACKET
+	RBRACKET
 	LBRACE
 	RBRACE
 
 	// Keywords
 	FUN
 	VAR
+	CONST
 	TRUE
 	FALSE
+	NULL
 	IF
 	ELSE
+	IMPORT
+	AS
+	EXPORT
+	MATCH
+	RECORD
+	WITH
+	CLASS
+	EXTENDS
+	ENUM
+	YIELD
+	FOR
+	IN
+	SPAWN
+	SELECT
+	ASYNC
+	AWAIT
 )
 
 var tokens = [...]string{
@@ -45,25 +82,62 @@ var tokens = [...]string{
 	EOF:     "EOF",
 
 	IDENT:  "IDENT",
+	INT:    "INT",
+	FLOAT:  "FLOAT",
 	STRING: "STRING",
+	REGEX:  "REGEX",
 
 	ASSIGN: "=",
+	ARROW:  "=>",
 	ADD:    "+",
+	SUB:    "-",
+	MUL:    "*",
+	QUO:    "/",
+	REM:    "%",
 	EQ:     "==",
+	NEQ:    "!=",
+	LSS:    "<",
+	GTR:    ">",
+	LEQ:    "<=",
+	GEQ:    ">=",
+	NOT:    "!",
 
 	COMMA:     ",",
+	DOT:       ".",
+	ELLIPSIS:  "...",
+	COLON:     ":",
 	SEMICOLON: ";",
 	LPAREN:    "(",
 	RPAREN:    ")",
+	LBRACKET:  "[",
+	RBRACKET:  "]",
 	LBRACE:    "{",
 	RBRACE:    "}",
 
-	FUN:   "fun",
-	VAR:   "var",
-	TRUE:  "true",
-	FALSE: "false",
-	IF:    "if",
-	ELSE:  "else",
+	FUN:     "fun",
+	VAR:     "var",
+	CONST:   "const",
+	TRUE:    "true",
+	FALSE:   "false",
+	NULL:    "null",
+	IF:      "if",
+	ELSE:    "else",
+	IMPORT:  "import",
+	AS:      "as",
+	EXPORT:  "export",
+	MATCH:   "match",
+	RECORD:  "record",
+	WITH:    "with",
+	CLASS:   "class",
+	EXTENDS: "extends",
+	ENUM:    "enum",
+	YIELD:   "yield",
+	FOR:     "for",
+	IN:      "in",
+	SPAWN:   "spawn",
+	SELECT:  "select",
+	ASYNC:   "async",
+	AWAIT:   "await",
 }
 
 func (tt TokenType) String() string {
@@ -79,27 +153,51 @@ func (tt TokenType) String() string {
 
 const (
 	LowestPrecedence = 1
+	// PrefixPrecedence is the precedence of the operand of a prefix
+	// operator such as -, ! or await, which binds tighter than binary
+	// operators but looser than calls, indexing and selectors.
+	PrefixPrecedence = 5
 )
 
 func (tok Token) Precedence() int {
 	switch tok.Type {
-	case EQ:
+	case EQ, NEQ, LSS, GTR, LEQ, GEQ:
 		return 2
-	case ADD:
+	case ADD, SUB:
 		return 3
-	case LPAREN:
+	case MUL, QUO, REM:
 		return 4
+	case LPAREN, LBRACKET, DOT, WITH:
+		return 6
 	}
 	return LowestPrecedence
 }
 
 var keywords = map[string]TokenType{
-	tokens[FUN]:   FUN,
-	tokens[VAR]:   VAR,
-	tokens[TRUE]:  TRUE,
-	tokens[FALSE]: FALSE,
-	tokens[IF]:    IF,
-	tokens[ELSE]:  ELSE,
+	tokens[FUN]:     FUN,
+	tokens[VAR]:     VAR,
+	tokens[CONST]:   CONST,
+	tokens[TRUE]:    TRUE,
+	tokens[FALSE]:   FALSE,
+	tokens[NULL]:    NULL,
+	tokens[IF]:      IF,
+	tokens[ELSE]:    ELSE,
+	tokens[IMPORT]:  IMPORT,
+	tokens[AS]:      AS,
+	tokens[EXPORT]:  EXPORT,
+	tokens[MATCH]:   MATCH,
+	tokens[RECORD]:  RECORD,
+	tokens[WITH]:    WITH,
+	tokens[CLASS]:   CLASS,
+	tokens[EXTENDS]: EXTENDS,
+	tokens[ENUM]:    ENUM,
+	tokens[YIELD]:   YIELD,
+	tokens[FOR]:     FOR,
+	tokens[IN]:      IN,
+	tokens[SPAWN]:   SPAWN,
+	tokens[SELECT]:  SELECT,
+	tokens[ASYNC]:   ASYNC,
+	tokens[AWAIT]:   AWAIT,
 }
 
 func Lookup(ident string) TokenType {
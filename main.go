@@ -1,11 +1,97 @@
 package main
 
 import (
+	"context"
+	"flag"
+	"fmt"
 	"os"
+	"strings"
 
 	"github.com/gramidt/mash-lang-for-codemash/console"
+	"github.com/gramidt/mash-lang-for-codemash/types"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "run" {
+		os.Exit(run(os.Args[2:]))
+	}
+
 	console.StartRepl(os.Stdin, os.Stdout)
 }
+
+// run implements "mash run [flags] <file.mash>".
+func run(args []string) int {
+	flags := flag.NewFlagSet("mash run", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: mash run [flags] <file.mash>")
+		flags.PrintDefaults()
+	}
+
+	grants := []struct {
+		name  string
+		usage string
+		allow func(...string) types.Option
+	}{
+		{"allow-read", "allow reading `paths` (all if omitted)", types.AllowRead},
+		{"allow-write", "allow writing `paths` (all if omitted)", types.AllowWrite},
+		{"allow-env", "allow reading environment `variables` (all if omitted)", types.AllowEnv},
+		{"allow-exec", "allow running `commands` (all if omitted)", types.AllowExec},
+		{"allow-net", "allow network access to `hosts` (all if omitted; reserved, no builtin uses it yet)", types.AllowNet},
+	}
+
+	perms := make([]*permFlag, len(grants))
+	for i, g := range grants {
+		perms[i] = &permFlag{}
+		flags.Var(perms[i], g.name, g.usage)
+	}
+	virtualTime := flags.Bool("virtual-time", false, "fire timers without waiting for them")
+
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 2
+	}
+
+	var opts []types.Option
+	for i, g := range grants {
+		if perms[i].set {
+			opts = append(opts, g.allow(perms[i].values...))
+		}
+	}
+	if *virtualTime {
+		opts = append(opts, types.WithVirtualTime())
+	}
+
+	if err := console.RunFile(context.Background(), flags.Arg(0), types.NewEnv(opts...)); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	return 0
+}
+
+// A permFlag is a permission flag that may be given alone, granting the
+// permission for everything, or with a comma-separated list of values.
+type permFlag struct {
+	set    bool
+	values []string
+}
+
+func (f *permFlag) String() string { return strings.Join(f.values, ",") }
+
+func (f *permFlag) IsBoolFlag() bool { return true }
+
+func (f *permFlag) Set(value string) error {
+	f.set = true
+	if value == "true" {
+		return nil
+	}
+	for _, v := range strings.Split(value, ",") {
+		if v != "" {
+			f.values = append(f.values, v)
+		}
+	}
+	return nil
+}
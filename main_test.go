@@ -0,0 +1,58 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestRunPermissionFlags(t *testing.T) {
+	t.Setenv("MASH_TEST_VAR", "mash")
+	script := filepath.Join(t.TempDir(), "env.mash")
+	if err := os.WriteFile(script, []byte(`os.getenv("MASH_TEST_VAR")`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		args []string
+		want int
+	}{
+		{"not granted", []string{script}, 1},
+		{"granted", []string{"--allow-env", script}, 0},
+		{"variable granted", []string{"--allow-env=HOME,MASH_TEST_VAR", script}, 0},
+		{"other variable", []string{"--allow-env=HOME", script}, 1},
+		{"other permission", []string{"--allow-read", "--allow-exec", script}, 1},
+		{"no script", nil, 2},
+		{"unknown flag", []string{"--allow-everything", script}, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := run(tt.args); got != tt.want {
+				t.Errorf("run(%q) = %d, want %d", tt.args, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPermFlag(t *testing.T) {
+	var f permFlag
+	for _, value := range []string{"a,b", "", "c,"} {
+		if err := f.Set(value); err != nil {
+			t.Fatalf("Set(%q): %v", value, err)
+		}
+	}
+	if want := []string{"a", "b", "c"}; !f.set || !reflect.DeepEqual(f.values, want) {
+		t.Errorf("permFlag = %+v, want the values %q", f, want)
+	}
+
+	var all permFlag
+	if err := all.Set("true"); err != nil {
+		t.Fatalf("Set(true): %v", err)
+	}
+	if !all.set || all.values != nil {
+		t.Errorf("permFlag = %+v, want set without values", all)
+	}
+}
@@ -2,12 +2,18 @@ package parser
 
 import (
 	"fmt"
+	"strconv"
+	"strings"
 
 	"github.com/gramidt/mash-lang-for-codemash/ast"
 	"github.com/gramidt/mash-lang-for-codemash/grammar"
 	"github.com/gramidt/mash-lang-for-codemash/scanner"
 )
 
+// regexFlags are the flags allowed after a regular expression literal:
+// case-insensitive, multi-line, dot matches newline and ungreedy.
+const regexFlags = "imsU"
+
 type (
 	parseFn       func() ast.Expr
 	binaryParseFn func(ast.Expr) ast.Expr
@@ -22,6 +28,9 @@ type Parser struct {
 
 	parseFunctions map[grammar.TokenType]parseFn
 	binaryParseFns map[grammar.TokenType]binaryParseFn
+
+	// funs are the function literals being parsed, innermost last.
+	funs []*ast.FunLit
 }
 
 func NewParser(lexer *scanner.Scanner) *Parser {
@@ -31,19 +40,45 @@ func NewParser(lexer *scanner.Scanner) *Parser {
 	}
 
 	p.parseFunctions = map[grammar.TokenType]parseFn{
-		grammar.IDENT:  p.parseIdent,
-		grammar.STRING: p.parseStringLit,
-		grammar.TRUE:   p.parseBoolLit,
-		grammar.FALSE:  p.parseBoolLit,
-		grammar.LPAREN: p.parseGroupedExpr,
-		grammar.FUN:    p.parseFunLit,
-		grammar.IF:     p.parseIfSmt,
+		grammar.IDENT:    p.parseIdent,
+		grammar.INT:      p.parseIntLit,
+		grammar.FLOAT:    p.parseFloatLit,
+		grammar.STRING:   p.parseStringLit,
+		grammar.REGEX:    p.parseRegexLit,
+		grammar.TRUE:     p.parseBoolLit,
+		grammar.FALSE:    p.parseBoolLit,
+		grammar.NULL:     p.parseNullLit,
+		grammar.SUB:      p.parseUnaryExpr,
+		grammar.NOT:      p.parseUnaryExpr,
+		grammar.LPAREN:   p.parseGroupedExpr,
+		grammar.LBRACKET: p.parseArrayLit,
+		grammar.LBRACE:   p.parseMapLit,
+		grammar.FUN:      p.parseFunLit,
+		grammar.ASYNC:    p.parseAsyncFunLit,
+		grammar.AWAIT:    p.parseAwaitExpr,
+		grammar.IF:       p.parseIfSmt,
+		grammar.YIELD:    p.parseYieldExpr,
+		grammar.MATCH:    p.parseMatchExpr,
+		grammar.SPAWN:    p.parseSpawnExpr,
+		grammar.SELECT:   p.parseSelectExpr,
 	}
 
 	p.binaryParseFns = map[grammar.TokenType]binaryParseFn{
-		grammar.ADD:    p.parseBinaryExpr,
-		grammar.EQ:     p.parseBinaryExpr,
-		grammar.LPAREN: p.parseCallExpr,
+		grammar.ADD:      p.parseBinaryExpr,
+		grammar.SUB:      p.parseBinaryExpr,
+		grammar.MUL:      p.parseBinaryExpr,
+		grammar.QUO:      p.parseBinaryExpr,
+		grammar.REM:      p.parseBinaryExpr,
+		grammar.EQ:       p.parseBinaryExpr,
+		grammar.NEQ:      p.parseBinaryExpr,
+		grammar.LSS:      p.parseBinaryExpr,
+		grammar.GTR:      p.parseBinaryExpr,
+		grammar.LEQ:      p.parseBinaryExpr,
+		grammar.GEQ:      p.parseBinaryExpr,
+		grammar.LPAREN:   p.parseCallExpr,
+		grammar.LBRACKET: p.parseIndexExpr,
+		grammar.DOT:      p.parseSelectorExpr,
+		grammar.WITH:     p.parseWithExpr,
 	}
 
 	// Read the first two tokens, so tok and peekTok are set.
@@ -57,7 +92,12 @@ func (p *Parser) Parse() *ast.Root {
 	root.Stmts = []ast.Stmt{}
 
 	for !p.tokenIs(grammar.EOF) {
-		stmt := p.parseStmt()
+		var stmt ast.Stmt
+		if p.tokenIs(grammar.EXPORT) {
+			stmt = p.parseExportStmt()
+		} else {
+			stmt = p.parseStmt()
+		}
 		root.Stmts = append(root.Stmts, stmt)
 		p.next()
 	}
@@ -108,62 +148,237 @@ func (p *Parser) parseIdent() ast.Expr {
 	return &ast.Ident{Token: p.tok, Value: p.tok.Lit}
 }
 
+func (p *Parser) parseIntLit() ast.Expr {
+	value, err := strconv.ParseInt(p.tok.Lit, 10, 64)
+	if err != nil {
+		msg := fmt.Sprintf("could not parse %q as integer", p.tok.Lit)
+		p.errors = append(p.errors, msg)
+		return nil
+	}
+
+	return &ast.IntLit{Token: p.tok, Value: value}
+}
+
+func (p *Parser) parseFloatLit() ast.Expr {
+	value, err := strconv.ParseFloat(p.tok.Lit, 64)
+	if err != nil {
+		msg := fmt.Sprintf("could not parse %q as float", p.tok.Lit)
+		p.errors = append(p.errors, msg)
+		return nil
+	}
+
+	return &ast.FloatLit{Token: p.tok, Value: value}
+}
+
 func (p *Parser) parseStringLit() ast.Expr {
 	return &ast.StringLit{Token: p.tok, Value: p.tok.Lit}
 }
 
+func (p *Parser) parseRegexLit() ast.Expr {
+	end := strings.LastIndexByte(p.tok.Lit, '/')
+	lit := &ast.RegexLit{Token: p.tok, Pattern: p.tok.Lit[1:end], Flags: p.tok.Lit[end+1:]}
+
+	for _, flag := range lit.Flags {
+		if !strings.ContainsRune(regexFlags, flag) {
+			msg := fmt.Sprintf("invalid regular expression flag %q in %s", flag, p.tok.Lit)
+			p.errors = append(p.errors, msg)
+			return nil
+		}
+	}
+
+	return lit
+}
+
 func (p *Parser) parseBoolLit() ast.Expr {
 	return &ast.BoolLit{Token: p.tok, Value: p.tokenIs(grammar.TRUE)}
 }
 
+func (p *Parser) parseNullLit() ast.Expr {
+	return &ast.NullLit{Token: p.tok}
+}
+
+// parseUnaryExpr parses a prefix operator and its operand, which binds like
+// the operand of await, so -x.y negates x.y and -a * b multiplies -a by b.
+func (p *Parser) parseUnaryExpr() ast.Expr {
+	expr := &ast.UnaryExpr{Op: p.tok}
+
+	p.next()
+	expr.X = p.parseExpr(grammar.PrefixPrecedence)
+	if expr.X == nil {
+		return nil
+	}
+
+	return expr
+}
+
+func (p *Parser) parseArrayLit() ast.Expr {
+	lit := &ast.ArrayLit{Token: p.tok}
+	lit.Elems = p.parseExprList(grammar.RBRACKET)
+	if lit.Elems == nil {
+		return nil
+	}
+
+	return lit
+}
+
+func (p *Parser) parseMapLit() ast.Expr {
+	lit := &ast.MapLit{Token: p.tok}
+	lit.Pairs = []*ast.KeyValueExpr{}
+
+	for !p.peekTokenIs(grammar.RBRACE) {
+		p.next()
+		key := p.parseExpr(grammar.LowestPrecedence)
+
+		if !p.expectPeekTokenIs(grammar.COLON) {
+			return nil
+		}
+
+		p.next()
+		value := p.parseExpr(grammar.LowestPrecedence)
+
+		lit.Pairs = append(lit.Pairs, &ast.KeyValueExpr{Key: key, Value: value})
+
+		if !p.peekTokenIs(grammar.RBRACE) && !p.expectPeekTokenIs(grammar.COMMA) {
+			return nil
+		}
+	}
+
+	if !p.expectPeekTokenIs(grammar.RBRACE) {
+		return nil
+	}
+
+	return lit
+}
+
 func (p *Parser) parseFunLit() ast.Expr {
 	lit := &ast.FunLit{Token: p.tok}
+	if !p.parseFun(lit) {
+		return nil
+	}
+	return lit
+}
 
-	if !p.expectPeekTokenIs(grammar.LPAREN) {
+func (p *Parser) parseAsyncFunLit() ast.Expr {
+	if !p.expectPeekTokenIs(grammar.FUN) {
+		return nil
+	}
+
+	lit := &ast.FunLit{Token: p.tok, Async: true}
+	if !p.parseFun(lit) {
 		return nil
 	}
+	return lit
+}
+
+// parseFun parses the parameters and body of lit.
+func (p *Parser) parseFun(lit *ast.FunLit) bool {
+	if !p.expectPeekTokenIs(grammar.LPAREN) {
+		return false
+	}
 
 	lit.Params = p.parseFunParams()
 
 	if !p.expectPeekTokenIs(grammar.LBRACE) {
-		return nil
+		return false
 	}
 
+	return p.parseFunBody(lit)
+}
+
+// parseFunBody parses the body of lit, which is a generator if it yields.
+// Async functions cannot yield.
+func (p *Parser) parseFunBody(lit *ast.FunLit) bool {
+	p.funs = append(p.funs, lit)
 	lit.Body = p.parseBlockStmt()
+	p.funs = p.funs[:len(p.funs)-1]
 
-	return lit
+	if lit.Async && lit.Generator {
+		p.errors = append(p.errors, "async functions cannot yield")
+		return false
+	}
+	return true
+}
+
+func (p *Parser) parseYieldExpr() ast.Expr {
+	expr := &ast.YieldExpr{Token: p.tok}
+
+	if len(p.funs) == 0 {
+		p.errors = append(p.errors, "yield is only allowed in a function")
+		return nil
+	}
+	p.funs[len(p.funs)-1].Generator = true
+
+	p.next()
+	expr.Value = p.parseExpr(grammar.LowestPrecedence)
+	if expr.Value == nil {
+		return nil
+	}
+
+	return expr
 }
 
-func (p *Parser) parseFunParams() []*ast.Ident {
-	idents := []*ast.Ident{}
+// parseAwaitExpr parses an await expression, which is allowed in async
+// functions and at the top level. await is a prefix operator, so await p +
+// await q adds the values of p and q.
+func (p *Parser) parseAwaitExpr() ast.Expr {
+	expr := &ast.AwaitExpr{Token: p.tok}
+
+	if len(p.funs) != 0 && !p.funs[len(p.funs)-1].Async {
+		p.errors = append(p.errors, "await is only allowed in async functions and at the top level")
+		return nil
+	}
+
+	p.next()
+	expr.Value = p.parseExpr(grammar.PrefixPrecedence)
+	if expr.Value == nil {
+		return nil
+	}
+
+	return expr
+}
+
+// parseFunParams parses the parameters of a function literal, each of
+// which is a name or a pattern destructuring its argument.
+func (p *Parser) parseFunParams() []ast.Pattern {
+	params := []ast.Pattern{}
 
 	if p.peekTokenIs(grammar.RPAREN) {
 		p.next()
-		return idents
+		return params
 	}
 
 	p.next()
-
-	ident := &ast.Ident{Token: p.tok, Value: p.tok.Lit}
-	idents = append(idents, ident)
+	params = append(params, p.parsePattern())
 
 	for p.peekTokenIs(grammar.COMMA) {
 		p.nextTwo()
-		ident := &ast.Ident{Token: p.tok, Value: p.tok.Lit}
-		idents = append(idents, ident)
+		params = append(params, p.parsePattern())
 	}
 
 	if !p.expectPeekTokenIs(grammar.RPAREN) {
 		return nil
 	}
 
-	return idents
+	return params
 }
 
 func (p *Parser) parseStmt() ast.Stmt {
 	switch p.tok.Type {
-	case grammar.VAR:
+	case grammar.VAR, grammar.CONST:
 		return p.parseVarStmt()
+	case grammar.RECORD:
+		return p.parseRecordStmt()
+	case grammar.CLASS:
+		return p.parseClassStmt()
+	case grammar.ENUM:
+		return p.parseEnumStmt()
+	case grammar.FOR:
+		return p.parseForStmt()
+	case grammar.IMPORT:
+		return p.parseImportStmt()
+	case grammar.EXPORT:
+		p.errors = append(p.errors, "export is only allowed at the top level of a module")
+		return nil
 	default:
 		return p.parseExprStmt()
 	}
@@ -187,19 +402,323 @@ func (p *Parser) parseBlockStmt() *ast.BlockStmt {
 func (p *Parser) parseVarStmt() *ast.VarStmt {
 	stmt := &ast.VarStmt{Token: p.tok}
 
+	switch {
+	case p.peekTokenIs(grammar.LBRACKET) || p.peekTokenIs(grammar.LBRACE):
+		p.next()
+		if stmt.Pattern = p.parsePattern(); stmt.Pattern == nil {
+			return nil
+		}
+	case p.expectPeekTokenIs(grammar.IDENT):
+		stmt.Name = &ast.Ident{Token: p.tok, Value: p.tok.Lit}
+	default:
+		return nil
+	}
+
+	if !p.expectPeekTokenIs(grammar.ASSIGN) {
+		return nil
+	}
+
+	p.next()
+
+	stmt.Value = p.parseExpr(grammar.LowestPrecedence)
+
+	if p.peekTokenIs(grammar.SEMICOLON) {
+		p.next()
+	}
+
+	return stmt
+}
+
+func (p *Parser) parseImportStmt() *ast.ImportStmt {
+	stmt := &ast.ImportStmt{Token: p.tok}
+
+	if !p.expectPeekTokenIs(grammar.STRING) {
+		return nil
+	}
+
+	stmt.Path = &ast.StringLit{Token: p.tok, Value: p.tok.Lit}
+
+	if p.peekTokenIs(grammar.AS) {
+		p.next()
+		if !p.expectPeekTokenIs(grammar.IDENT) {
+			return nil
+		}
+		stmt.Name = &ast.Ident{Token: p.tok, Value: p.tok.Lit}
+	}
+
+	if p.peekTokenIs(grammar.SEMICOLON) {
+		p.next()
+	}
+
+	return stmt
+}
+
+func (p *Parser) parseExportStmt() *ast.ExportStmt {
+	stmt := &ast.ExportStmt{Token: p.tok}
+
+	p.next()
+	switch p.tok.Type {
+	case grammar.VAR, grammar.CONST:
+		decl := p.parseVarStmt()
+		if decl == nil {
+			return nil
+		}
+		stmt.Decl = decl
+	case grammar.RECORD:
+		decl := p.parseRecordStmt()
+		if decl == nil {
+			return nil
+		}
+		stmt.Decl = decl
+	case grammar.CLASS:
+		decl := p.parseClassStmt()
+		if decl == nil {
+			return nil
+		}
+		stmt.Decl = decl
+	case grammar.ENUM:
+		decl := p.parseEnumStmt()
+		if decl == nil {
+			return nil
+		}
+		stmt.Decl = decl
+	default:
+		msg := fmt.Sprintf("expected declaration after export, got %s instead", p.tok.Type)
+		p.errors = append(p.errors, msg)
+		return nil
+	}
+
+	return stmt
+}
+
+// parseRecordStmt parses a record declaration such as record Point { x, y }.
+func (p *Parser) parseRecordStmt() *ast.RecordStmt {
+	stmt := &ast.RecordStmt{Token: p.tok}
+
 	if !p.expectPeekTokenIs(grammar.IDENT) {
 		return nil
 	}
+	stmt.Name = &ast.Ident{Token: p.tok, Value: p.tok.Lit}
+
+	if !p.expectPeekTokenIs(grammar.LBRACE) {
+		return nil
+	}
+
+	stmt.Fields = []*ast.Ident{}
+	seen := map[string]bool{}
+	for !p.peekTokenIs(grammar.RBRACE) {
+		if !p.expectPeekTokenIs(grammar.IDENT) {
+			return nil
+		}
+		if seen[p.tok.Lit] {
+			msg := fmt.Sprintf("duplicate field %s in record %s", p.tok.Lit, stmt.Name.Value)
+			p.errors = append(p.errors, msg)
+			return nil
+		}
+		seen[p.tok.Lit] = true
+		stmt.Fields = append(stmt.Fields, &ast.Ident{Token: p.tok, Value: p.tok.Lit})
+
+		if !p.peekTokenIs(grammar.RBRACE) && !p.expectPeekTokenIs(grammar.COMMA) {
+			return nil
+		}
+	}
 
+	if !p.expectPeekTokenIs(grammar.RBRACE) {
+		return nil
+	}
+
+	if p.peekTokenIs(grammar.SEMICOLON) {
+		p.next()
+	}
+
+	return stmt
+}
+
+// parseClassStmt parses a class declaration such as
+// class Counter extends Base { init(n) { ... } inc() { ... } }, whose
+// methods may be declared async.
+func (p *Parser) parseClassStmt() *ast.ClassStmt {
+	stmt := &ast.ClassStmt{Token: p.tok}
+
+	if !p.expectPeekTokenIs(grammar.IDENT) {
+		return nil
+	}
 	stmt.Name = &ast.Ident{Token: p.tok, Value: p.tok.Lit}
 
-	if !p.expectPeekTokenIs(grammar.ASSIGN) {
+	if p.peekTokenIs(grammar.EXTENDS) {
+		p.next()
+		if !p.expectPeekTokenIs(grammar.IDENT) {
+			return nil
+		}
+		stmt.Super = &ast.Ident{Token: p.tok, Value: p.tok.Lit}
+	}
+
+	if !p.expectPeekTokenIs(grammar.LBRACE) {
+		return nil
+	}
+
+	stmt.Methods = []*ast.MethodDecl{}
+	seen := map[string]bool{}
+	for !p.peekTokenIs(grammar.RBRACE) {
+		async := p.peekTokenIs(grammar.ASYNC)
+		if async {
+			p.next()
+		}
+		if !p.expectPeekTokenIs(grammar.IDENT) {
+			return nil
+		}
+		method := &ast.MethodDecl{Name: &ast.Ident{Token: p.tok, Value: p.tok.Lit}}
+		if seen[method.Name.Value] {
+			msg := fmt.Sprintf("duplicate method %s in class %s", method.Name.Value, stmt.Name.Value)
+			p.errors = append(p.errors, msg)
+			return nil
+		}
+		seen[method.Name.Value] = true
+
+		method.Fun = &ast.FunLit{Token: p.tok, Async: async}
+		if !p.parseFun(method.Fun) {
+			return nil
+		}
+
+		stmt.Methods = append(stmt.Methods, method)
+	}
+
+	if !p.expectPeekTokenIs(grammar.RBRACE) {
+		return nil
+	}
+
+	if p.peekTokenIs(grammar.SEMICOLON) {
+		p.next()
+	}
+
+	return stmt
+}
+
+// parseEnumStmt parses an enum declaration such as
+// enum Shape { Circle(r), Rect(w, h), Empty }.
+func (p *Parser) parseEnumStmt() *ast.EnumStmt {
+	stmt := &ast.EnumStmt{Token: p.tok}
+
+	if !p.expectPeekTokenIs(grammar.IDENT) {
+		return nil
+	}
+	stmt.Name = &ast.Ident{Token: p.tok, Value: p.tok.Lit}
+
+	if !p.expectPeekTokenIs(grammar.LBRACE) {
+		return nil
+	}
+
+	stmt.Variants = []*ast.EnumVariant{}
+	seen := map[string]bool{}
+	for !p.peekTokenIs(grammar.RBRACE) {
+		if !p.expectPeekTokenIs(grammar.IDENT) {
+			return nil
+		}
+		variant := &ast.EnumVariant{Name: &ast.Ident{Token: p.tok, Value: p.tok.Lit}}
+		if seen[variant.Name.Value] {
+			msg := fmt.Sprintf("duplicate variant %s in enum %s", variant.Name.Value, stmt.Name.Value)
+			p.errors = append(p.errors, msg)
+			return nil
+		}
+		seen[variant.Name.Value] = true
+
+		if p.peekTokenIs(grammar.LPAREN) {
+			p.next()
+			variant.Fields = []*ast.Ident{}
+			for !p.peekTokenIs(grammar.RPAREN) {
+				if !p.expectPeekTokenIs(grammar.IDENT) {
+					return nil
+				}
+				variant.Fields = append(variant.Fields, &ast.Ident{Token: p.tok, Value: p.tok.Lit})
+				if !p.peekTokenIs(grammar.RPAREN) && !p.expectPeekTokenIs(grammar.COMMA) {
+					return nil
+				}
+			}
+			p.next()
+		}
+
+		stmt.Variants = append(stmt.Variants, variant)
+
+		if !p.peekTokenIs(grammar.RBRACE) && !p.expectPeekTokenIs(grammar.COMMA) {
+			return nil
+		}
+	}
+
+	if !p.expectPeekTokenIs(grammar.RBRACE) {
+		return nil
+	}
+
+	if p.peekTokenIs(grammar.SEMICOLON) {
+		p.next()
+	}
+
+	return stmt
+}
+
+// parseWithExpr parses the { field: value, ... } replacements of a with
+// expression.
+func (p *Parser) parseWithExpr(x ast.Expr) ast.Expr {
+	expr := &ast.WithExpr{Token: p.tok, X: x}
+
+	if !p.expectPeekTokenIs(grammar.LBRACE) {
+		return nil
+	}
+
+	expr.Fields = []*ast.KeyValueExpr{}
+	for !p.peekTokenIs(grammar.RBRACE) {
+		if !p.expectPeekTokenIs(grammar.IDENT) {
+			return nil
+		}
+		key := &ast.Ident{Token: p.tok, Value: p.tok.Lit}
+
+		if !p.expectPeekTokenIs(grammar.COLON) {
+			return nil
+		}
+
+		p.next()
+		value := p.parseExpr(grammar.LowestPrecedence)
+
+		expr.Fields = append(expr.Fields, &ast.KeyValueExpr{Key: key, Value: value})
+
+		if !p.peekTokenIs(grammar.RBRACE) && !p.expectPeekTokenIs(grammar.COMMA) {
+			return nil
+		}
+	}
+
+	if !p.expectPeekTokenIs(grammar.RBRACE) {
+		return nil
+	}
+
+	return expr
+}
+
+// parseForStmt parses a loop such as for (x in xs) { body }, where x may be
+// any pattern destructuring the values of xs.
+func (p *Parser) parseForStmt() ast.Stmt {
+	stmt := &ast.ForStmt{Token: p.tok}
+
+	if !p.expectPeekTokenIs(grammar.LPAREN) {
 		return nil
 	}
 
 	p.next()
+	stmt.Pattern = p.parsePattern()
+	if stmt.Pattern == nil {
+		return nil
+	}
 
-	stmt.Value = p.parseExpr(grammar.LowestPrecedence)
+	if !p.expectPeekTokenIs(grammar.IN) {
+		return nil
+	}
+
+	p.next()
+	stmt.Iter = p.parseExpr(grammar.LowestPrecedence)
+
+	if !p.expectPeekTokenIs(grammar.RPAREN) || !p.expectPeekTokenIs(grammar.LBRACE) {
+		return nil
+	}
+
+	stmt.Body = p.parseBlockStmt()
 
 	if p.peekTokenIs(grammar.SEMICOLON) {
 		p.next()
@@ -230,6 +749,17 @@ func (p *Parser) parseIfSmt() ast.Expr {
 
 	if p.peekTokenIs(grammar.ELSE) {
 		p.next()
+
+		if p.peekTokenIs(grammar.IF) {
+			p.next()
+			elseIf := p.parseIfSmt()
+			if elseIf == nil {
+				return nil
+			}
+			stmt.Else = elseIf
+			return stmt
+		}
+
 		if !p.expectPeekTokenIs(grammar.LBRACE) {
 			return nil
 		}
@@ -239,9 +769,387 @@ func (p *Parser) parseIfSmt() ast.Expr {
 	return stmt
 }
 
-func (p *Parser) parseExprStmt() *ast.ExprStmt {
-	stmt := &ast.ExprStmt{Token: p.tok}
-	stmt.Expr = p.parseExpr(grammar.LowestPrecedence)
+func (p *Parser) parseMatchExpr() ast.Expr {
+	expr := &ast.MatchExpr{Token: p.tok}
+
+	if !p.expectPeekTokenIs(grammar.LPAREN) {
+		return nil
+	}
+
+	p.next()
+	expr.Subject = p.parseExpr(grammar.LowestPrecedence)
+
+	if !p.expectPeekTokenIs(grammar.RPAREN) || !p.expectPeekTokenIs(grammar.LBRACE) {
+		return nil
+	}
+
+	expr.Arms = []*ast.MatchArm{}
+	for !p.peekTokenIs(grammar.RBRACE) {
+		p.next()
+		arm := p.parseMatchArm()
+		if arm == nil {
+			return nil
+		}
+		expr.Arms = append(expr.Arms, arm)
+
+		if !p.peekTokenIs(grammar.RBRACE) && !p.expectPeekTokenIs(grammar.COMMA) {
+			return nil
+		}
+	}
+
+	if !p.expectPeekTokenIs(grammar.RBRACE) {
+		return nil
+	}
+
+	return expr
+}
+
+// parseSpawnExpr parses a spawn expression such as spawn worker(ch), whose
+// operand must be a call. spawn applies to the first call only, so that
+// spawn worker(ch).wait() waits for the task spawned.
+func (p *Parser) parseSpawnExpr() ast.Expr {
+	expr := &ast.SpawnExpr{Token: p.tok}
+
+	p.next()
+	parse := p.parseFunctions[p.tok.Type]
+	if parse == nil {
+		p.errors = append(p.errors, "spawn must be followed by a function call")
+		return nil
+	}
+	operand := parse()
+	for operand != nil {
+		if call, ok := operand.(*ast.CallExpr); ok {
+			expr.Call = call
+			return expr
+		}
+		if !p.peekTokenIs(grammar.DOT) && !p.peekTokenIs(grammar.LBRACKET) && !p.peekTokenIs(grammar.LPAREN) {
+			break
+		}
+		p.next()
+		operand = p.binaryParseFns[p.tok.Type](operand)
+	}
+
+	p.errors = append(p.errors, "spawn must be followed by a function call")
+	return nil
+}
+
+// parseSelectExpr parses a select expression such as
+// select { recv(ch) as x => body, send(ch, y) => body, _ => body }.
+func (p *Parser) parseSelectExpr() ast.Expr {
+	expr := &ast.SelectExpr{Token: p.tok}
+
+	if !p.expectPeekTokenIs(grammar.LBRACE) {
+		return nil
+	}
+
+	expr.Cases = []*ast.SelectCase{}
+	for !p.peekTokenIs(grammar.RBRACE) {
+		p.next()
+		if p.tokenIs(grammar.IDENT) && p.tok.Lit == "_" {
+			if expr.Default != nil {
+				p.errors = append(p.errors, "multiple _ cases in select")
+				return nil
+			}
+			if !p.expectPeekTokenIs(grammar.ARROW) {
+				return nil
+			}
+			expr.Default = p.parseArmBody()
+		} else {
+			c := p.parseSelectCase()
+			if c == nil {
+				return nil
+			}
+			expr.Cases = append(expr.Cases, c)
+		}
+
+		if !p.peekTokenIs(grammar.RBRACE) && !p.expectPeekTokenIs(grammar.COMMA) {
+			return nil
+		}
+	}
+
+	if !p.expectPeekTokenIs(grammar.RBRACE) {
+		return nil
+	}
+
+	return expr
+}
+
+// parseSelectCase parses a select case, whose channel operation is written
+// as a call of recv or send, or of the recv or send method of a channel.
+func (p *Parser) parseSelectCase() *ast.SelectCase {
+	c := &ast.SelectCase{}
+
+	call, ok := p.parseExpr(grammar.LowestPrecedence).(*ast.CallExpr)
+	if !ok {
+		p.errors = append(p.errors, "select case must be a recv or send call")
+		return nil
+	}
+	op, args := "", call.Args
+	switch fun := call.Fun.(type) {
+	case *ast.Ident:
+		op = fun.Value
+	case *ast.SelectorExpr:
+		op = fun.Sel.Value
+		args = append([]ast.Expr{fun.X}, args...)
+	}
+	switch {
+	case op == "recv" && len(args) == 1:
+		c.Chan = args[0]
+	case op == "send" && len(args) == 2:
+		c.Chan, c.Value = args[0], args[1]
+	default:
+		p.errors = append(p.errors, "select case must be a recv or send call")
+		return nil
+	}
+
+	if p.peekTokenIs(grammar.AS) {
+		if c.Value != nil {
+			p.errors = append(p.errors, "send case in select cannot bind a value")
+			return nil
+		}
+		p.nextTwo()
+		if c.Pattern = p.parsePattern(); c.Pattern == nil {
+			return nil
+		}
+	}
+
+	if !p.expectPeekTokenIs(grammar.ARROW) {
+		return nil
+	}
+	c.Body = p.parseArmBody()
+
+	return c
+}
+
+// parseMatchArm parses an arm of a match expression. A body starting with a
+// brace is a block, so a map literal body must be parenthesized.
+func (p *Parser) parseMatchArm() *ast.MatchArm {
+	arm := &ast.MatchArm{Pattern: p.parsePattern()}
+	if arm.Pattern == nil {
+		return nil
+	}
+
+	if p.peekTokenIs(grammar.IF) {
+		p.nextTwo()
+		arm.Guard = p.parseExpr(grammar.LowestPrecedence)
+	}
+
+	if !p.expectPeekTokenIs(grammar.ARROW) {
+		return nil
+	}
+	arm.Body = p.parseArmBody()
+
+	return arm
+}
+
+// parseArmBody parses the body following the => of a match arm or select
+// case, which is either a block or an expression.
+func (p *Parser) parseArmBody() ast.Node {
+	p.next()
+	if p.tokenIs(grammar.LBRACE) {
+		return p.parseBlockStmt()
+	}
+	return p.parseExpr(grammar.LowestPrecedence)
+}
+
+// parsePattern parses a pattern, optionally followed by a type annotation.
+func (p *Parser) parsePattern() ast.Pattern {
+	var pattern ast.Pattern
+
+	switch p.tok.Type {
+	case grammar.IDENT:
+		switch {
+		case p.tok.Lit == "_":
+			pattern = &ast.WildcardPattern{Token: p.tok}
+		case p.peekTokenIs(grammar.LPAREN) || p.peekTokenIs(grammar.DOT):
+			pattern = p.parseConstructorPattern()
+		default:
+			pattern = &ast.BindingPattern{Name: &ast.Ident{Token: p.tok, Value: p.tok.Lit}}
+		}
+	case grammar.INT, grammar.FLOAT, grammar.STRING, grammar.TRUE, grammar.FALSE, grammar.NULL:
+		value := p.parseFunctions[p.tok.Type]()
+		if value == nil {
+			return nil
+		}
+		pattern = &ast.LiteralPattern{Value: value}
+	case grammar.SUB:
+		op := p.tok
+		if !p.peekTokenIs(grammar.INT) && !p.peekTokenIs(grammar.FLOAT) {
+			msg := fmt.Sprintf("expected number after - in pattern, got %s instead", p.peekTok.Type)
+			p.errors = append(p.errors, msg)
+			return nil
+		}
+		p.next()
+		value := p.parseFunctions[p.tok.Type]()
+		if value == nil {
+			return nil
+		}
+		pattern = &ast.LiteralPattern{Value: &ast.UnaryExpr{Op: op, X: value}}
+	case grammar.LBRACKET:
+		pattern = p.parseArrayPattern()
+	case grammar.LBRACE:
+		pattern = p.parseMapPattern()
+	default:
+		msg := fmt.Sprintf("expected pattern, got %s instead", p.tok.Type)
+		p.errors = append(p.errors, msg)
+		return nil
+	}
+
+	if pattern == nil || !p.peekTokenIs(grammar.COLON) {
+		return pattern
+	}
+
+	p.next()
+	if !p.expectPeekTokenIs(grammar.IDENT) {
+		return nil
+	}
+
+	return &ast.TypePattern{Pattern: pattern, Type: &ast.Ident{Token: p.tok, Value: p.tok.Lit}}
+}
+
+// parseConstructorPattern parses a possibly qualified constructor name,
+// followed by the patterns for its fields in parentheses.
+func (p *Parser) parseConstructorPattern() ast.Pattern {
+	pattern := &ast.ConstructorPattern{Path: []*ast.Ident{{Token: p.tok, Value: p.tok.Lit}}}
+
+	for p.peekTokenIs(grammar.DOT) {
+		p.next()
+		if !p.expectPeekTokenIs(grammar.IDENT) {
+			return nil
+		}
+		pattern.Path = append(pattern.Path, &ast.Ident{Token: p.tok, Value: p.tok.Lit})
+	}
+
+	if !p.peekTokenIs(grammar.LPAREN) {
+		return pattern
+	}
+
+	p.next()
+	pattern.Args = []ast.Pattern{}
+	for !p.peekTokenIs(grammar.RPAREN) {
+		p.next()
+		arg := p.parsePattern()
+		if arg == nil {
+			return nil
+		}
+		pattern.Args = append(pattern.Args, arg)
+
+		if !p.peekTokenIs(grammar.RPAREN) && !p.expectPeekTokenIs(grammar.COMMA) {
+			return nil
+		}
+	}
+	p.next()
+
+	return pattern
+}
+
+func (p *Parser) parseArrayPattern() ast.Pattern {
+	pattern := &ast.ArrayPattern{Token: p.tok}
+	pattern.Elems = []ast.Pattern{}
+
+	for !p.peekTokenIs(grammar.RBRACKET) {
+		p.next()
+
+		if p.tokenIs(grammar.ELLIPSIS) {
+			p.next()
+			if pattern.Rest = p.parsePattern(); pattern.Rest == nil {
+				return nil
+			}
+			break
+		}
+
+		elem := p.parsePattern()
+		if elem == nil {
+			return nil
+		}
+		pattern.Elems = append(pattern.Elems, elem)
+
+		if !p.peekTokenIs(grammar.RBRACKET) && !p.expectPeekTokenIs(grammar.COMMA) {
+			return nil
+		}
+	}
+
+	if !p.expectPeekTokenIs(grammar.RBRACKET) {
+		return nil
+	}
+
+	return pattern
+}
+
+// parseMapPattern parses a map pattern. Each key is a name or string,
+// followed by the pattern for its value; a name alone binds the value to
+// that name.
+func (p *Parser) parseMapPattern() ast.Pattern {
+	pattern := &ast.MapPattern{Token: p.tok}
+
+	for !p.peekTokenIs(grammar.RBRACE) {
+		p.next()
+		if !p.tokenIs(grammar.IDENT) && !p.tokenIs(grammar.STRING) {
+			msg := fmt.Sprintf("expected map pattern key, got %s instead", p.tok.Type)
+			p.errors = append(p.errors, msg)
+			return nil
+		}
+		key := p.tok
+
+		var value ast.Pattern
+		if p.peekTokenIs(grammar.COLON) {
+			p.nextTwo()
+			if value = p.parsePattern(); value == nil {
+				return nil
+			}
+		} else if key.Type == grammar.IDENT {
+			value = &ast.BindingPattern{Name: &ast.Ident{Token: key, Value: key.Lit}}
+		} else {
+			msg := fmt.Sprintf("expected pattern for map key %q", key.Lit)
+			p.errors = append(p.errors, msg)
+			return nil
+		}
+
+		pattern.Keys = append(pattern.Keys, key.Lit)
+		pattern.Values = append(pattern.Values, value)
+
+		if !p.peekTokenIs(grammar.RBRACE) && !p.expectPeekTokenIs(grammar.COMMA) {
+			return nil
+		}
+	}
+
+	if !p.expectPeekTokenIs(grammar.RBRACE) {
+		return nil
+	}
+
+	return pattern
+}
+
+// parseExprStmt parses an expression statement, or an assignment if the
+// expression is followed by '='.
+func (p *Parser) parseExprStmt() ast.Stmt {
+	tok := p.tok
+	expr := p.parseExpr(grammar.LowestPrecedence)
+
+	if p.peekTokenIs(grammar.ASSIGN) {
+		return p.parseAssignStmt(expr)
+	}
+
+	if p.peekTokenIs(grammar.SEMICOLON) {
+		p.next()
+	}
+
+	return &ast.ExprStmt{Token: tok, Expr: expr}
+}
+
+func (p *Parser) parseAssignStmt(target ast.Expr) ast.Stmt {
+	switch target.(type) {
+	case *ast.Ident, *ast.IndexExpr, *ast.SelectorExpr:
+	default:
+		p.errors = append(p.errors, "invalid assignment target, expected a name, index or selector")
+		return nil
+	}
+
+	p.next()
+	stmt := &ast.AssignStmt{Token: p.tok, Target: target}
+
+	p.next()
+	stmt.Value = p.parseExpr(grammar.LowestPrecedence)
 
 	if p.peekTokenIs(grammar.SEMICOLON) {
 		p.next()
@@ -298,24 +1206,62 @@ func (p *Parser) parseBinaryExpr(left ast.Expr) ast.Expr {
 
 func (p *Parser) parseCallExpr(fun ast.Expr) ast.Expr {
 	expr := &ast.CallExpr{Token: p.tok, Fun: fun}
-	expr.Args = []ast.Expr{}
+	expr.Args = p.parseExprList(grammar.RPAREN)
+	if expr.Args == nil {
+		return nil
+	}
 
-	if p.peekTokenIs(grammar.RPAREN) {
+	return expr
+}
+
+func (p *Parser) parseIndexExpr(x ast.Expr) ast.Expr {
+	expr := &ast.IndexExpr{Token: p.tok, X: x}
+
+	p.next()
+	expr.Index = p.parseExpr(grammar.LowestPrecedence)
+
+	if !p.expectPeekTokenIs(grammar.RBRACKET) {
+		return nil
+	}
+
+	return expr
+}
+
+func (p *Parser) parseExprList(end grammar.TokenType) []ast.Expr {
+	list := []ast.Expr{}
+
+	if p.peekTokenIs(end) {
 		p.next()
-		return expr
+		return list
 	}
 
 	p.next()
-	expr.Args = append(expr.Args, p.parseExpr(grammar.LowestPrecedence))
+	list = append(list, p.parseExpr(grammar.LowestPrecedence))
 
 	for p.peekTokenIs(grammar.COMMA) {
 		p.nextTwo()
-		expr.Args = append(expr.Args, p.parseExpr(grammar.LowestPrecedence))
+		list = append(list, p.parseExpr(grammar.LowestPrecedence))
 	}
 
-	if !p.expectPeekTokenIs(grammar.RPAREN) {
+	if !p.expectPeekTokenIs(end) {
 		return nil
 	}
 
+	return list
+}
+
+// parseSelectorExpr parses a selector such as x.name. Keywords are valid
+// names after the dot, so that values can have methods such as match.
+func (p *Parser) parseSelectorExpr(x ast.Expr) ast.Expr {
+	expr := &ast.SelectorExpr{Token: p.tok, X: x}
+
+	if p.peekTok.Type != grammar.IDENT && grammar.Lookup(p.peekTok.Lit) == p.peekTok.Type {
+		p.next()
+	} else if !p.expectPeekTokenIs(grammar.IDENT) {
+		return nil
+	}
+
+	expr.Sel = &ast.Ident{Token: p.tok, Value: p.tok.Lit}
+
 	return expr
 }
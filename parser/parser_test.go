@@ -0,0 +1,126 @@
+package parser
+
+import (
+	"testing"
+
+	"github.com/gramidt/mash-lang-for-codemash/ast"
+	"github.com/gramidt/mash-lang-for-codemash/grammar"
+	"github.com/gramidt/mash-lang-for-codemash/scanner"
+)
+
+func TestKeywordSelector(t *testing.T) {
+	for _, name := range []string{"match", "with", "in", "select"} {
+		expr := parseExpr(t, `re.`+name+`(s)`)
+		call, ok := expr.(*ast.CallExpr)
+		if !ok {
+			t.Fatalf("re.%s(s) parsed as %T, want a call", name, expr)
+		}
+		if sel, ok := call.Fun.(*ast.SelectorExpr); !ok || sel.Sel.Value != name {
+			t.Errorf("re.%s(s) calls %T, want the selector re.%s", name, call.Fun, name)
+		}
+	}
+}
+
+func TestSpawnAppliesToFirstCall(t *testing.T) {
+	expr := parseExpr(t, `spawn pool.workers[0](ch).wait()`)
+	call, ok := expr.(*ast.CallExpr)
+	if !ok {
+		t.Fatalf("parsed as %T, want a call of wait", expr)
+	}
+	sel, ok := call.Fun.(*ast.SelectorExpr)
+	if !ok || sel.Sel.Value != "wait" {
+		t.Fatalf("calls %T, want the selector wait", call.Fun)
+	}
+	spawn, ok := sel.X.(*ast.SpawnExpr)
+	if !ok {
+		t.Fatalf("wait selected from %T, want a spawn", sel.X)
+	}
+	if _, ok := spawn.Call.Fun.(*ast.IndexExpr); !ok {
+		t.Errorf("spawn calls %T, want the index pool.workers[0]", spawn.Call.Fun)
+	}
+
+	p := NewParser(scanner.NewScanner(`spawn worker`))
+	p.Parse()
+	if len(p.Errors()) == 0 {
+		t.Errorf("spawn worker parsed without errors, want an error")
+	}
+}
+
+func TestAwaitPrecedence(t *testing.T) {
+	expr := parseExpr(t, `await p + await q`)
+	sum, ok := expr.(*ast.BinaryExpr)
+	if !ok || sum.Op.Type != grammar.ADD {
+		t.Fatalf("await p + await q parsed as %T, want a sum", expr)
+	}
+	for _, operand := range []ast.Expr{sum.Left, sum.Right} {
+		if _, ok := operand.(*ast.AwaitExpr); !ok {
+			t.Errorf("operand of + parsed as %T, want an await", operand)
+		}
+	}
+
+	expr = parseExpr(t, `await obj.load(1)[0]`)
+	await, ok := expr.(*ast.AwaitExpr)
+	if !ok {
+		t.Fatalf("await obj.load(1)[0] parsed as %T, want an await", expr)
+	}
+	if _, ok := await.Value.(*ast.IndexExpr); !ok {
+		t.Errorf("operand of await parsed as %T, want the index", await.Value)
+	}
+}
+
+func TestUnaryPrecedence(t *testing.T) {
+	expr := parseExpr(t, `-a * b`)
+	product, ok := expr.(*ast.BinaryExpr)
+	if !ok || product.Op.Type != grammar.MUL {
+		t.Fatalf("-a * b parsed as %T, want a product", expr)
+	}
+	if _, ok := product.Left.(*ast.UnaryExpr); !ok {
+		t.Errorf("left operand of * parsed as %T, want a negation", product.Left)
+	}
+
+	expr = parseExpr(t, `-x.y`)
+	neg, ok := expr.(*ast.UnaryExpr)
+	if !ok || neg.Op.Type != grammar.SUB {
+		t.Fatalf("-x.y parsed as %T, want a negation", expr)
+	}
+	if _, ok := neg.X.(*ast.SelectorExpr); !ok {
+		t.Errorf("operand of - parsed as %T, want the selector", neg.X)
+	}
+
+	expr = parseExpr(t, `!ok == false`)
+	eq, ok := expr.(*ast.BinaryExpr)
+	if !ok || eq.Op.Type != grammar.EQ {
+		t.Fatalf("!ok == false parsed as %T, want a comparison", expr)
+	}
+	if not, ok := eq.Left.(*ast.UnaryExpr); !ok || not.Op.Type != grammar.NOT {
+		t.Errorf("left operand of == parsed as %T, want a negation", eq.Left)
+	}
+}
+
+func TestNegatedPattern(t *testing.T) {
+	p := NewParser(scanner.NewScanner(`match (1) { -n => n }`))
+	p.Parse()
+	want := "expected number after - in pattern, got IDENT instead"
+	if errs := p.Errors(); len(errs) == 0 || errs[0] != want {
+		t.Errorf("match with -n parsed with errors %v, want %q first", errs, want)
+	}
+}
+
+// parseExpr parses src, which must be a single expression statement, and
+// returns its expression.
+func parseExpr(t *testing.T, src string) ast.Expr {
+	t.Helper()
+	p := NewParser(scanner.NewScanner(src))
+	root := p.Parse()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parsing %q: %v", src, p.Errors())
+	}
+	if len(root.Stmts) != 1 {
+		t.Fatalf("parsing %q: got %d statements, want 1", src, len(root.Stmts))
+	}
+	stmt, ok := root.Stmts[0].(*ast.ExprStmt)
+	if !ok {
+		t.Fatalf("parsing %q: got a %T, want an expression statement", src, root.Stmts[0])
+	}
+	return stmt.Expr
+}
@@ -1,6 +1,8 @@
 package scanner
 
 import (
+	"strings"
+
 	"github.com/gramidt/mash-lang-for-codemash/grammar"
 )
 
@@ -9,6 +11,10 @@ type Scanner struct {
 	pos     int
 	readPos int
 	ch      byte
+
+	// prev is the type of the last token returned, which tells a regular
+	// expression literal apart from division.
+	prev grammar.TokenType
 }
 
 func NewScanner(input string) *Scanner {
@@ -18,6 +24,12 @@ func NewScanner(input string) *Scanner {
 }
 
 func (l *Scanner) NextToken() grammar.Token {
+	tok := l.nextToken()
+	l.prev = tok.Type
+	return tok
+}
+
+func (l *Scanner) nextToken() grammar.Token {
 	var tok grammar.Token
 
 	l.eatWhitespace()
@@ -29,6 +41,11 @@ func (l *Scanner) NextToken() grammar.Token {
 			l.readChar()
 			tok.Type = grammar.EQ
 			tok.Lit = string(ch) + string(l.ch)
+		} else if l.peekChar() == '>' {
+			ch := l.ch
+			l.readChar()
+			tok.Type = grammar.ARROW
+			tok.Lit = string(ch) + string(l.ch)
 		} else {
 			tok.Type = grammar.ASSIGN
 			tok.Lit = string(l.ch)
@@ -36,6 +53,27 @@ func (l *Scanner) NextToken() grammar.Token {
 	case '+':
 		tok.Type = grammar.ADD
 		tok.Lit = string(l.ch)
+	case '-':
+		tok.Type = grammar.SUB
+		tok.Lit = string(l.ch)
+	case '*':
+		tok.Type = grammar.MUL
+		tok.Lit = string(l.ch)
+	case '/':
+		if l.regexAllowed() {
+			return l.readRegex()
+		}
+		tok.Type = grammar.QUO
+		tok.Lit = string(l.ch)
+	case '%':
+		tok.Type = grammar.REM
+		tok.Lit = string(l.ch)
+	case '!':
+		tok = l.readComparison(grammar.NOT, grammar.NEQ)
+	case '<':
+		tok = l.readComparison(grammar.LSS, grammar.LEQ)
+	case '>':
+		tok = l.readComparison(grammar.GTR, grammar.GEQ)
 	case '"':
 		tok.Type = grammar.STRING
 		tok.Lit = l.readString()
@@ -51,6 +89,25 @@ func (l *Scanner) NextToken() grammar.Token {
 	case ',':
 		tok.Type = grammar.COMMA
 		tok.Lit = string(l.ch)
+	case '.':
+		if l.peekChar() == '.' && l.readPos+1 < len(l.input) && l.input[l.readPos+1] == '.' {
+			l.readChar()
+			l.readChar()
+			tok.Type = grammar.ELLIPSIS
+			tok.Lit = "..."
+		} else {
+			tok.Type = grammar.DOT
+			tok.Lit = string(l.ch)
+		}
+	case ':':
+		tok.Type = grammar.COLON
+		tok.Lit = string(l.ch)
+	case '[':
+		tok.Type = grammar.LBRACKET
+		tok.Lit = string(l.ch)
+	case ']':
+		tok.Type = grammar.RBRACKET
+		tok.Lit = string(l.ch)
 	case '{':
 		tok.Type = grammar.LBRACE
 		tok.Lit = string(l.ch)
@@ -65,6 +122,9 @@ func (l *Scanner) NextToken() grammar.Token {
 			tok.Lit = l.readIdentifier()
 			tok.Type = grammar.Lookup(tok.Lit)
 			return tok
+		} else if isDigit(l.ch) {
+			tok.Lit, tok.Type = l.readNumber()
+			return tok
 		} else {
 			tok.Type = grammar.ILLEGAL
 			tok.Lit = string(l.ch)
@@ -95,9 +155,30 @@ func (l *Scanner) peekChar() byte {
 	}
 }
 
-func (l *Scanner) eatWhitespace() {
-	for l.ch == ' ' || l.ch == '\t' || l.ch == '\n' || l.ch == '\r' {
+// readComparison scans a one character operator, or the two character
+// operator ending in '=' if the next character is '='.
+func (l *Scanner) readComparison(single, withEq grammar.TokenType) grammar.Token {
+	if l.peekChar() == '=' {
+		ch := l.ch
 		l.readChar()
+		return grammar.Token{Type: withEq, Lit: string(ch) + string(l.ch)}
+	}
+	return grammar.Token{Type: single, Lit: string(l.ch)}
+}
+
+// eatWhitespace skips whitespace and line comments.
+func (l *Scanner) eatWhitespace() {
+	for {
+		switch {
+		case l.ch == ' ' || l.ch == '\t' || l.ch == '\n' || l.ch == '\r':
+			l.readChar()
+		case l.ch == '/' && l.peekChar() == '/':
+			for l.ch != '\n' && l.ch != 0 {
+				l.readChar()
+			}
+		default:
+			return
+		}
 	}
 }
 
@@ -111,19 +192,102 @@ func (l *Scanner) readIdentifier() string {
 	return l.input[pos:l.pos]
 }
 
+func (l *Scanner) readNumber() (string, grammar.TokenType) {
+	pos := l.pos
+	typ := grammar.INT
+
+	for isDigit(l.ch) {
+		l.readChar()
+	}
+
+	if l.ch == '.' && isDigit(l.peekChar()) {
+		typ = grammar.FLOAT
+		l.readChar()
+		for isDigit(l.ch) {
+			l.readChar()
+		}
+	}
+
+	return l.input[pos:l.pos], typ
+}
+
+// regexAllowed reports whether a '/' starts a regular expression literal
+// rather than being the division operator, which is the case unless it
+// follows an operand.
+func (l *Scanner) regexAllowed() bool {
+	switch l.prev {
+	case grammar.IDENT, grammar.INT, grammar.FLOAT, grammar.STRING, grammar.REGEX,
+		grammar.TRUE, grammar.FALSE, grammar.NULL, grammar.RPAREN, grammar.RBRACKET:
+		return false
+	}
+	return true
+}
+
+// readRegex scans a regular expression literal such as /a+b/i. Its Lit is
+// the whole literal; an unterminated literal is ILLEGAL.
+func (l *Scanner) readRegex() grammar.Token {
+	pos := l.pos
+
+	for {
+		l.readChar()
+		if l.ch == '\\' {
+			l.readChar()
+			if l.ch != 0 && l.ch != '\n' {
+				continue
+			}
+		}
+		if l.ch == 0 || l.ch == '\n' {
+			return grammar.Token{Type: grammar.ILLEGAL, Lit: l.input[pos:l.pos]}
+		}
+		if l.ch == '/' {
+			break
+		}
+	}
+
+	l.readChar()
+	for isLetter(l.ch) {
+		l.readChar()
+	}
+
+	return grammar.Token{Type: grammar.REGEX, Lit: l.input[pos:l.pos]}
+}
+
 func (l *Scanner) readString() string {
-	pos := l.pos + 1
+	var out strings.Builder
 
 	for {
 		l.readChar()
 		if l.ch == '"' || l.ch == 0 {
 			break
 		}
+
+		if l.ch == '\\' {
+			l.readChar()
+			switch l.ch {
+			case 'n':
+				out.WriteByte('\n')
+			case 't':
+				out.WriteByte('\t')
+			case 'r':
+				out.WriteByte('\r')
+			case 0:
+				return out.String()
+			default:
+				out.WriteByte(l.ch)
+			}
+			continue
+		}
+
+		out.WriteByte(l.ch)
 	}
 
-	return l.input[pos:l.pos]
+	return out.String()
 }
 
 func isLetter(ch byte) bool {
-	return 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z'
+	return 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || ch == '_'
+}
+
+func isDigit(ch byte) bool {
+	return '0' <= ch && ch <= '9'
 }
@@ -0,0 +1,10 @@
+// Package std embeds the standard library of Mash modules, importable from
+// scripts as "std/<name>".
+package std
+
+import "embed"
+
+// FS holds the source of every standard library module.
+//
+//go:embed *.mash
+var FS embed.FS
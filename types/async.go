@@ -0,0 +1,556 @@
+package types
+
+import (
+	"container/heap"
+	"context"
+	"time"
+
+	"github.com/gramidt/mash-lang-for-codemash/ast"
+)
+
+// WithVirtualTime makes the timers of the event loop fire as soon as nothing
+// else is left to run, in the order of their deadlines, without waiting for
+// them. Scripts using timers then run quickly and always the same way.
+func WithVirtualTime() Option {
+	return func(rt *runtime) {
+		rt.loop.virtual = true
+	}
+}
+
+// The timer builtins call back into the evaluator, so they are added by
+// init to avoid an initialization cycle.
+func init() {
+	builtins["sleep"] = &Builtin{Name: "sleep", Fun: sleep, Arity: 1}
+	builtins["setTimeout"] = &Builtin{Name: "setTimeout", Fun: setTimeout, Arity: 2}
+	builtins["setInterval"] = &Builtin{Name: "setInterval", Fun: setInterval, Arity: 2}
+	builtins["clearTimeout"] = &Builtin{Name: "clearTimeout", Fun: clearTimer, Arity: 1}
+	builtins["clearInterval"] = &Builtin{Name: "clearInterval", Fun: clearTimer, Arity: 1}
+}
+
+type promiseState int
+
+const (
+	pending promiseState = iota
+	fulfilled
+	rejected
+)
+
+// A Promise is the eventual result of a call of an async function, or of a
+// timer started by sleep. await waits for it to settle, returning its value
+// or failing with its Error. Eval fails with the Error of a Promise rejected
+// without being awaited, which would otherwise be lost.
+type Promise struct {
+	state     promiseState
+	value     Object // the value, or the *Error of a rejected Promise
+	listeners []callback
+	loop      *eventLoop
+	handled   bool // set once the Promise is awaited or resolves another
+}
+
+func (p *Promise) Type() ObjType { return PROMISE_OBJ }
+func (p *Promise) Inspect() string {
+	switch p.state {
+	case fulfilled:
+		return "<promise fulfilled: " + p.value.Inspect() + ">"
+	case rejected:
+		return "<promise rejected: " + p.value.(*Error).Msg + ">"
+	}
+	return "<promise pending>"
+}
+func (p *Promise) IsTruthy() bool { return true }
+
+// resolve settles p with result, or with the result of another Promise once
+// it settles.
+func (p *Promise) resolve(result Object) {
+	if other, ok := result.(*Promise); ok {
+		other.handled = true
+		other.onSettle(func(ctx context.Context) *Error {
+			p.settle(other.value)
+			return nil
+		})
+		return
+	}
+	p.settle(result)
+}
+
+func (p *Promise) settle(value Object) {
+	if p.state != pending {
+		return
+	}
+	p.value = value
+	p.state = fulfilled
+	if isError(value) {
+		p.state = rejected
+		p.loop.rejected = append(p.loop.rejected, p)
+	}
+	p.loop.queue = append(p.loop.queue, p.listeners...)
+	p.listeners = nil
+}
+
+// onSettle schedules f to run on the event loop once p is settled.
+func (p *Promise) onSettle(f callback) {
+	if p.state == pending {
+		p.listeners = append(p.listeners, f)
+		return
+	}
+	p.loop.queue = append(p.loop.queue, f)
+}
+
+// A callback is run by the event loop. An Error it returns stops the loop.
+type callback func(ctx context.Context) *Error
+
+// An eventLoop runs the callbacks of settled promises and expired timers,
+// one at a time and in the order they are scheduled. It is run by Eval once
+// the script is evaluated, by await at the top level until the promise
+// settles, and by a task blocked until it is unblocked. Its state is guarded
+// by the lock of the scheduler.
+type eventLoop struct {
+	queue  []callback
+	timers timerHeap
+	byID   map[int64]*timer
+	nextID int64
+	seq    int64
+
+	virtual bool
+	clock   time.Duration // the virtual time elapsed
+
+	suspended []*coroutine // async calls waiting for a promise, oldest first
+	rejected  []*Promise   // see unhandledRejection
+	running   bool         // whether a task is running the loop
+}
+
+func newEventLoop() *eventLoop {
+	return &eventLoop{byID: make(map[int64]*timer)}
+}
+
+// run runs the event loop until until is settled or, if until is nil, until
+// nothing is left to run. Async calls left waiting for promises that can no
+// longer settle fail, oldest first.
+func (l *eventLoop) run(ctx context.Context, rt *runtime, until *Promise) *Error {
+	running := l.running
+	l.running = true
+	defer func() { l.running = running }()
+
+	for until == nil || until.state == pending {
+		ran, err := l.runNext(ctx, rt)
+		if err != nil {
+			return err
+		}
+		if ran {
+			continue
+		}
+
+		if len(l.timers) > 0 {
+			if d := l.timers[0].deadline - l.now(); d > 0 {
+				if err := l.sleep(ctx, rt.sched, d); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		if len(l.suspended) == 0 {
+			break
+		}
+		l.resume(l.suspended[0], newError("await: promise never settles"))
+	}
+
+	if until != nil && until.state == pending {
+		return newError("await: promise never settles")
+	}
+	return nil
+}
+
+// runNext runs the first callback queued or, if there is none, queues the
+// callback of the first timer due. It reports false if there was neither.
+func (l *eventLoop) runNext(ctx context.Context, rt *runtime) (bool, *Error) {
+	if len(l.queue) > 0 {
+		if err := rt.step(ctx); err != nil {
+			return false, err
+		}
+		f := l.queue[0]
+		l.queue = l.queue[1:]
+		return true, f(ctx)
+	}
+
+	if len(l.timers) == 0 || l.timers[0].deadline > l.now() {
+		return false, nil
+	}
+	t := l.timers[0]
+	if t.interval > 0 {
+		t.deadline += t.interval
+		t.seq = l.nextSeq()
+		heap.Fix(&l.timers, t.index)
+	} else {
+		heap.Pop(&l.timers)
+		delete(l.byID, t.id)
+	}
+	l.queue = append(l.queue, t.fun)
+	return true, nil
+}
+
+// runUntilFired runs the event loop for a task blocked on w, until w is
+// fired or only async calls waiting for promises are left.
+func (l *eventLoop) runUntilFired(ctx context.Context, rt *runtime, w *waiter) *Error {
+	l.running = true
+	defer func() { l.running = false }()
+
+	for !w.fired {
+		ran, err := l.runNext(ctx, rt)
+		if err != nil {
+			return err
+		}
+		if ran {
+			continue
+		}
+		if len(l.timers) == 0 {
+			return nil
+		}
+		if err := l.sleepBlocked(ctx, rt.sched, w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sleepBlocked blocks the current task on w until the first timer is due,
+// letting other tasks run meanwhile. In virtual time the timer is due once
+// no task is left to run.
+func (l *eventLoop) sleepBlocked(ctx context.Context, s *scheduler, w *waiter) *Error {
+	var due <-chan time.Time
+	var idle chan struct{}
+	if l.virtual {
+		idle = s.idle
+		select {
+		case <-idle:
+		default:
+		}
+	} else {
+		t := time.NewTimer(l.timers[0].deadline - l.now())
+		defer t.Stop()
+		due = t.C
+	}
+
+	s.blocked[w] = struct{}{}
+	s.active--
+	s.sleeping++
+	s.detectDeadlock()
+	s.lock.Unlock()
+
+	var err *Error
+	woken := false
+	select {
+	case <-w.ready:
+	case <-due:
+	case <-idle:
+		woken = true
+	case <-ctx.Done():
+		err = contextError(ctx.Err())
+	}
+
+	s.lock.Lock()
+	s.sleeping--
+	if !w.fired {
+		delete(s.blocked, w)
+		s.active++
+	}
+	if woken && len(l.timers) > 0 && l.timers[0].deadline > l.clock {
+		l.clock = l.timers[0].deadline
+	}
+	return err
+}
+
+// stop fails the async calls waiting for promises with err, so that their
+// goroutines exit, and drops the timers and callbacks left, which must not
+// run in the next call of Eval.
+func (l *eventLoop) stop(err *Error) {
+	for len(l.suspended) > 0 {
+		l.resume(l.suspended[0], err)
+	}
+	l.queue = nil
+	l.timers = nil
+	l.byID = make(map[int64]*timer)
+}
+
+// unhandledRejection returns the Error of the first Promise rejected without
+// being awaited, and forgets the rejected promises.
+func (l *eventLoop) unhandledRejection() *Error {
+	rejected := l.rejected
+	l.rejected = nil
+	for _, p := range rejected {
+		if !p.handled {
+			return p.value.(*Error)
+		}
+	}
+	return nil
+}
+
+// now returns the time elapsed since the start of the program, or the
+// virtual time.
+func (l *eventLoop) now() time.Duration {
+	if l.virtual {
+		return l.clock
+	}
+	return time.Since(processStart)
+}
+
+var processStart = time.Now()
+
+// sleep waits for d, letting other tasks run meanwhile.
+func (l *eventLoop) sleep(ctx context.Context, s *scheduler, d time.Duration) *Error {
+	if l.virtual {
+		l.clock += d
+		return nil
+	}
+
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	s.lock.Unlock()
+	defer s.lock.Lock()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return contextError(ctx.Err())
+	}
+}
+
+func (l *eventLoop) nextSeq() int64 {
+	l.seq++
+	return l.seq
+}
+
+// addTimer schedules fun to run after delay, and then every interval if it
+// is positive, returning the id of the timer.
+func (l *eventLoop) addTimer(delay, interval time.Duration, fun callback) int64 {
+	if delay < 0 {
+		delay = 0
+	}
+	l.nextID++
+	t := &timer{id: l.nextID, seq: l.nextSeq(), deadline: l.now() + delay, interval: interval, fun: fun}
+	heap.Push(&l.timers, t)
+	l.byID[t.id] = t
+	return t.id
+}
+
+// A timer runs fun once its deadline has passed. Timers with the same
+// deadline run in the order they were scheduled.
+type timer struct {
+	id       int64
+	seq      int64
+	deadline time.Duration
+	interval time.Duration // zero unless the timer repeats
+	fun      callback
+	index    int // in the timerHeap
+}
+
+type timerHeap []*timer
+
+func (h timerHeap) Len() int { return len(h) }
+func (h timerHeap) Less(i, j int) bool {
+	if h[i].deadline != h[j].deadline {
+		return h[i].deadline < h[j].deadline
+	}
+	return h[i].seq < h[j].seq
+}
+func (h timerHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index, h[j].index = i, j
+}
+func (h *timerHeap) Push(x interface{}) {
+	t := x.(*timer)
+	t.index = len(*h)
+	*h = append(*h, t)
+}
+func (h *timerHeap) Pop() interface{} {
+	old := *h
+	t := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return t
+}
+
+// A coroutine runs the body of an async call in a goroutine of its own,
+// taking turns with the event loop: either the loop or the body runs, while
+// the other waits for it to suspend at an await or return.
+type coroutine struct {
+	resume chan *Error // resumes the body, failing the await with the Error
+	yield  chan struct{}
+}
+
+type coroutineKey struct{}
+
+// startAsync calls the async function fun, with its parameters bound in env,
+// until it first waits for a promise, returning the Promise of its result.
+func startAsync(ctx context.Context, name string, fun *Fun, env *Env) Object {
+	if err := env.rt.alloc(envSize); err != nil {
+		return err
+	}
+
+	p := &Promise{loop: env.rt.loop}
+	co := &coroutine{resume: make(chan *Error), yield: make(chan struct{})}
+	// The call was entered by applyFunction, and is entered again on the
+	// stack of the body.
+	ctx = context.WithValue(ctx, callStackKey{}, &callStack{base: depth(ctx) - 1})
+	ctx = context.WithValue(ctx, coroutineKey{}, co)
+
+	go func() {
+		var result Object
+		ctx, err := env.rt.pushFrame(ctx, name, env)
+		if err != nil {
+			result = err
+		} else {
+			result = eval(ctx, fun.Body, env)
+			env.rt.popFrame(ctx)
+		}
+
+		if returnVal, ok := result.(*ReturnValue); ok {
+			result = returnVal.Value
+		}
+		if result == nil {
+			result = NULL
+		}
+		p.resolve(result)
+
+		co.yield <- struct{}{}
+	}()
+	<-co.yield
+
+	return p
+}
+
+// await suspends the body of co until p is settled, returning its value.
+func (co *coroutine) await(l *eventLoop, p *Promise) Object {
+	p.handled = true
+	if p.state == pending {
+		l.suspended = append(l.suspended, co)
+		p.onSettle(func(ctx context.Context) *Error {
+			l.resume(co, nil)
+			return nil
+		})
+
+		co.yield <- struct{}{}
+		if err := <-co.resume; err != nil {
+			return err
+		}
+	}
+	return p.value
+}
+
+// resume runs the body of co, if it is suspended, until it suspends again
+// or returns.
+func (l *eventLoop) resume(co *coroutine, err *Error) {
+	for i, suspended := range l.suspended {
+		if suspended == co {
+			l.suspended = append(l.suspended[:i], l.suspended[i+1:]...)
+			co.resume <- err
+			<-co.yield
+			return
+		}
+	}
+}
+
+// evalAwaitExpr waits for a Promise to settle. In an async function it
+// suspends the call, and at the top level it runs the event loop until the
+// Promise is settled. Awaiting any other value returns it.
+func evalAwaitExpr(ctx context.Context, node *ast.AwaitExpr, env *Env) Object {
+	value := eval(ctx, node.Value, env)
+	if isError(value) {
+		return value
+	}
+
+	p, ok := value.(*Promise)
+	if !ok {
+		if value == nil {
+			return NULL
+		}
+		return value
+	}
+
+	if co, ok := ctx.Value(coroutineKey{}).(*coroutine); ok {
+		return co.await(env.rt.loop, p)
+	}
+
+	p.handled = true
+	if err := env.rt.loop.run(ctx, env.rt, p); err != nil {
+		return err
+	}
+	return p.value
+}
+
+// durationArg returns args[i] of the builtin called name as a number of
+// milliseconds.
+func durationArg(name string, args []Object, i int) (time.Duration, *Error) {
+	ms, err := intArg(name, args, i)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(ms) * time.Millisecond, nil
+}
+
+// sleep returns a Promise fulfilled with null after a number of
+// milliseconds.
+func sleep(ctx context.Context, env *Env, args ...Object) Object {
+	d, err := durationArg("sleep", args, 0)
+	if err != nil {
+		return err
+	}
+
+	p := &Promise{loop: env.rt.loop}
+	env.rt.loop.addTimer(d, 0, func(ctx context.Context) *Error {
+		p.settle(NULL)
+		return nil
+	})
+	return env.rt.track(p)
+}
+
+// setTimeout calls a function once after a number of milliseconds,
+// returning the id of the timer for clearTimeout.
+func setTimeout(ctx context.Context, env *Env, args ...Object) Object {
+	return startTimer(env, "setTimeout", args, false)
+}
+
+// setInterval calls a function every number of milliseconds, returning the
+// id of the timer for clearInterval.
+func setInterval(ctx context.Context, env *Env, args ...Object) Object {
+	return startTimer(env, "setInterval", args, true)
+}
+
+func startTimer(env *Env, name string, args []Object, repeat bool) Object {
+	d, err := durationArg(name, args, 1)
+	if err != nil {
+		return err
+	}
+	var interval time.Duration
+	if repeat {
+		if d <= 0 {
+			return newError("argument 1 to %s must be positive, got %d", name, d/time.Millisecond)
+		}
+		interval = d
+	}
+
+	fun := args[0]
+	id := env.rt.loop.addTimer(d, interval, func(ctx context.Context) *Error {
+		if err, ok := applyFunction(ctx, env, name, fun, nil).(*Error); ok {
+			return err
+		}
+		return nil
+	})
+	return &Int{Value: id}
+}
+
+// clearTimer cancels a timer started by setTimeout or setInterval. Clearing
+// a timer that has already run does nothing.
+func clearTimer(ctx context.Context, env *Env, args ...Object) Object {
+	id, err := intArg("clearTimeout", args, 0)
+	if err != nil {
+		return err
+	}
+
+	l := env.rt.loop
+	if t, ok := l.byID[id]; ok {
+		heap.Remove(&l.timers, t.index)
+		delete(l.byID, id)
+	}
+	return NULL
+}
@@ -0,0 +1,270 @@
+package types
+
+import (
+	"bytes"
+	"context"
+	goruntime "runtime"
+	"testing"
+	"time"
+
+	"github.com/gramidt/mash-lang-for-codemash/parser"
+	"github.com/gramidt/mash-lang-for-codemash/scanner"
+)
+
+func TestAsync(t *testing.T) {
+	tests := []struct {
+		name    string
+		src     string
+		out     string
+		wantErr string
+	}{
+		{"timer order", `setTimeout(fun() { print("c") }, 30)
+setTimeout(fun() { print("a") }, 10)
+setTimeout(fun() { print("b") }, 20)
+setTimeout(fun() { print("d") }, 30)
+print("main")`, "main\na\nb\nc\nd\n", ""},
+		{"zero delay", `setTimeout(fun() { print("timer") }, 0)
+print("main")`, "main\ntimer\n", ""},
+		{"clearTimeout", `var id = setTimeout(fun() { print("cleared") }, 10)
+setTimeout(fun() { print("kept") }, 20)
+clearTimeout(id)
+clearTimeout(id)`, "kept\n", ""},
+		{"setInterval", `var n = 0
+var id = 0
+id = setInterval(fun() {
+	n = n + 1
+	print(n)
+	if (n == 3) { clearInterval(id) }
+}, 1000)`, "1\n2\n3\n", ""},
+		{"zero interval", `setInterval(fun() {}, 0)`, "", "argument 1 to setInterval must be positive, got 0"},
+		{"await order", `var f = async fun(name, ms) {
+	print(name, "start")
+	await sleep(ms)
+	print(name, "end")
+	name
+}
+var a = f("a", 20)
+var b = f("b", 10)
+print(await a + await b)`, "a\nstart\nb\nstart\nb\nend\na\nend\nab\n", ""},
+		{"await in expression", `var f = async fun(x) { await sleep(x); x }
+print(await f(1) + await f(2) * 10)`, "21\n", ""},
+		{"await non-promise", `print(await 5)`, "5\n", ""},
+		{"timers and coroutines", `var f = async fun() { await sleep(15); print("async") }
+setTimeout(fun() { print("timer") }, 10)
+setTimeout(fun() { print("later") }, 20)
+await f()
+print("main")`, "timer\nasync\nmain\nlater\n", ""},
+		{"awaited rejection", `var f = async fun() { await sleep(1); undefinedName }
+await f()
+print("unreachable")`, "", "invalid identifier: undefinedName"},
+		{"never settles", `var p = 0
+var f = async fun() { await sleep(1); await p }
+p = f()
+await p`, "", "await: promise never settles"},
+		{"timer error", `setTimeout(fun() { undefinedName }, 10)
+print("main")`, "main\n", "invalid identifier: undefinedName"},
+		{"virtual time is instant", `var f = async fun() { await sleep(1000000000) }
+await f()
+print("done")`, "done\n", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			result := evalSource(t, tt.src, NewEnv(WithVirtualTime(), WithStdout(&out)))
+			checkResult(t, result, tt.wantErr)
+			if got := out.String(); got != tt.out {
+				t.Errorf("printed %q, want %q", got, tt.out)
+			}
+		})
+	}
+}
+
+func TestVirtualTimeIsReproducible(t *testing.T) {
+	src := `var f = async fun(name, ms) {
+	for (i in range(3)) { await sleep(ms); print(name, i) }
+}
+f("a", 7)
+f("b", 5)
+var id = setInterval(fun() { print("tick") }, 11)
+setTimeout(fun() { clearInterval(id); print("stop") }, 30)
+await sleep(30)
+print("end")`
+
+	var first string
+	for i := 0; i < 20; i++ {
+		var out bytes.Buffer
+		result := evalSource(t, src, NewEnv(WithVirtualTime(), WithStdout(&out)))
+		checkResult(t, result, "")
+		if i == 0 {
+			first = out.String()
+		} else if out.String() != first {
+			t.Fatalf("run %d printed %q, want %q", i, out.String(), first)
+		}
+	}
+}
+
+func TestTimersAndChannels(t *testing.T) {
+	tests := []struct {
+		name    string
+		src     string
+		out     string
+		wantErr string
+	}{
+		{"timer sends", `var ch = chan(1)
+setTimeout(fun() { send(ch, 1) }, 10)
+print(recv(ch))`, "1\n", ""},
+		{"async call sends", `var ch = chan(1)
+var f = async fun() { await sleep(10); send(ch, 2) }
+f()
+print(recv(ch))`, "2\n", ""},
+		{"task waits for timer", `var ch = chan()
+var worker = fun() { recv(ch) }
+var t = spawn worker()
+setTimeout(fun() { send(ch, "x") }, 5)
+print(t.wait())`, "x\n", ""},
+		{"task starts timer", `var ch = chan()
+var worker = fun() { setTimeout(fun() { send(ch, 3) }, 5); recv(ch) }
+var t = spawn worker()
+print(t.wait())`, "3\n", ""},
+		{"timers in order", `var ch = chan(2)
+setTimeout(fun() { send(ch, "b") }, 20)
+setTimeout(fun() { send(ch, "a") }, 10)
+print(recv(ch), recv(ch))`, "a\nb\n", ""},
+
+		{"callback blocks", `var ch = chan()
+setTimeout(fun() { recv(ch) }, 1)
+setTimeout(fun() { send(ch, 1) }, 5)
+await sleep(10)`, "", "deadlock: all tasks are blocked"},
+	}
+
+	for _, virtual := range []bool{false, true} {
+		for _, tt := range tests {
+			name := tt.name
+			if virtual {
+				name += " in virtual time"
+			}
+			t.Run(name, func(t *testing.T) {
+				var out bytes.Buffer
+				opts := []Option{WithStdout(&out)}
+				if virtual {
+					opts = append(opts, WithVirtualTime())
+				}
+				result := evalSource(t, tt.src, NewEnv(opts...))
+				checkResult(t, result, tt.wantErr)
+				if got := out.String(); got != tt.out {
+					t.Errorf("printed %q, want %q", got, tt.out)
+				}
+			})
+		}
+	}
+}
+
+func TestEvalStopsEventLoop(t *testing.T) {
+	tests := []struct {
+		name    string
+		src     string
+		timeout time.Duration
+	}{
+		{"failure", `var f = async fun() { await sleep(100000) }
+f()
+setTimeout(fun() { print("late") }, 0)
+undefinedName`, 0},
+		{"timeout", `var f = async fun() { await sleep(100000) }
+f()
+setTimeout(fun() { print("late") }, 0)
+for (i in range(1000000000)) {}`, 10 * time.Millisecond},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := goruntime.NumGoroutine()
+			var out bytes.Buffer
+			env := NewEnv(WithStdout(&out))
+
+			for i := 0; i < 20; i++ {
+				ctx := context.Background()
+				if tt.timeout > 0 {
+					var cancel context.CancelFunc
+					ctx, cancel = context.WithTimeout(ctx, tt.timeout)
+					defer cancel()
+				}
+				p := parser.NewParser(scanner.NewScanner(tt.src))
+				if result := Eval(ctx, p.Parse(), env); !isError(result) {
+					t.Fatalf("Eval = %s, want an error", result.Inspect())
+				}
+			}
+
+			if result := evalSource(t, `1`, env); isError(result) {
+				t.Fatalf("Eval after failures: %s", result.Inspect())
+			}
+			if out.Len() != 0 {
+				t.Errorf("timers of failed calls of Eval printed %q", out.String())
+			}
+			waitForGoroutines(t, before)
+		})
+	}
+}
+
+func TestEvalReturnsUnhandledRejection(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{"unawaited", `var f = async fun() { undefinedName }
+f()
+print("done")`, "invalid identifier: undefinedName"},
+		{"rejected later", `var f = async fun() { await sleep(10); undefinedName }
+f()
+1`, "invalid identifier: undefinedName"},
+		{"returned", `var f = async fun() { undefinedName }
+var g = async fun() { f() }
+g()
+1`, "invalid identifier: undefinedName"},
+		{"awaited", `var f = async fun() { undefinedName }
+var p = f()
+var g = async fun() { await p }
+await g()`, "invalid identifier: undefinedName"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := evalSource(t, tt.src, NewEnv(WithVirtualTime(), WithStdout(&bytes.Buffer{})))
+			if err, ok := result.(*Error); !ok || err.Msg != tt.want {
+				t.Errorf("Eval = %s, want the error %q", result.Inspect(), tt.want)
+			}
+		})
+	}
+}
+
+func TestAsyncEvalTimesOut(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	src := `var f = async fun() { for (i in range(1000000000)) {} }
+f()`
+	p := parser.NewParser(scanner.NewScanner(src))
+	result := Eval(ctx, p.Parse(), NewEnv())
+	if err, ok := result.(*Error); !ok || err.Kind != TIMEOUT_ERROR {
+		t.Errorf("Eval = %s, want a TIMEOUT_ERROR", result.Inspect())
+	}
+}
+
+func TestEvalTimesOutWaitingForTimer(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	src := `var ch = chan()
+setTimeout(fun() { send(ch, 1) }, 1000000)
+recv(ch)`
+	p := parser.NewParser(scanner.NewScanner(src))
+	start := time.Now()
+	result := Eval(ctx, p.Parse(), NewEnv())
+	if err, ok := result.(*Error); !ok || err.Kind != TIMEOUT_ERROR {
+		t.Errorf("Eval = %s, want a TIMEOUT_ERROR", result.Inspect())
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Eval returned after %v, want it to stop at the timeout", elapsed)
+	}
+}
@@ -1,27 +1,219 @@
 package types
 
 import (
+	"context"
 	"fmt"
+	"math"
+	"os"
+	"os/exec"
+	"unicode/utf8"
 )
 
-var builtins = map[string]*Builtin{
-	"print": {
-		Fun: print,
-	},
+var builtins = map[string]Object{
 	// ;)
-	"generatePassword": {
-		Fun: generatePassword,
+	"generatePassword": &Builtin{
+		Name:  "generatePassword",
+		Fun:   generatePassword,
+		Arity: 0,
+	},
+	"len": &Builtin{
+		Name:  "len",
+		Fun:   length,
+		Arity: 1,
+	},
+	"append": &Builtin{
+		Name:  "append",
+		Fun:   appendElems,
+		Arity: VariadicArity,
+	},
+	"slice": &Builtin{
+		Name:  "slice",
+		Fun:   slice,
+		Arity: 3,
+	},
+	"regex": &Builtin{
+		Name:  "regex",
+		Fun:   regex,
+		Arity: VariadicArity,
+	},
+	"freeze": &Builtin{
+		Name:  "freeze",
+		Fun:   freeze,
+		Arity: 1,
+	},
+	"isFrozen": &Builtin{
+		Name:  "isFrozen",
+		Fun:   frozen,
+		Arity: 1,
 	},
+	"instanceOf": &Builtin{
+		Name:  "instanceOf",
+		Fun:   instanceOf,
+		Arity: 2,
+	},
+	"os": newNamespace("os",
+		&Builtin{
+			Name:  "getenv",
+			Fun:   getenv,
+			Arity: 1,
+		},
+		&Builtin{
+			Name:  "exec",
+			Fun:   execCommand,
+			Arity: VariadicArity,
+		},
+	),
+	"fs":   fsModule,
+	"json": jsonModule,
+}
+
+// print and format call the __str__ methods of instances, so they are added
+// in init to avoid an initialization cycle through Eval.
+func init() {
+	builtins["print"] = &Builtin{Name: "print", Fun: print, Arity: VariadicArity}
+	builtins["format"] = &Builtin{Name: "format", Fun: format, Arity: VariadicArity}
+}
+
+func newNamespace(name string, members ...*Builtin) *Namespace {
+	ns := &Namespace{Name: name, Members: make(map[string]Object, len(members))}
+	for _, member := range members {
+		ns.Members[member.Name] = member
+		member.Name = name + "." + member.Name
+	}
+	return ns
 }
 
-func print(args ...Object) Object {
+func print(ctx context.Context, env *Env, args ...Object) Object {
 	for _, arg := range args {
-		fmt.Println(arg.Inspect())
+		s, err := display(ctx, env, arg)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(env.rt.stdout, s)
 	}
 
 	return NULL
 }
 
-func generatePassword(args ...Object) Object {
+func generatePassword(ctx context.Context, env *Env, args ...Object) Object {
 	return &String{Value: "password1234"}
 }
+
+// length returns the number of elements of an Array, pairs of a Map or
+// characters (not bytes) of a String.
+func length(ctx context.Context, env *Env, args ...Object) Object {
+	switch arg := args[0].(type) {
+	case *Array:
+		return &Int{Value: int64(len(arg.Elems))}
+	case *Map:
+		return &Int{Value: int64(len(arg.Pairs))}
+	case *String:
+		return &Int{Value: int64(utf8.RuneCountInString(arg.Value))}
+	case *Range:
+		if arg.n > math.MaxInt64 {
+			return newError("len: %s has more than %d elements", arg.Inspect(), int64(math.MaxInt64))
+		}
+		return &Int{Value: int64(arg.n)}
+	}
+	return newError("argument to len not supported, got %s", args[0].Type().String())
+}
+
+// appendElems returns a new Array holding the elements of its first
+// argument followed by the remaining arguments.
+func appendElems(ctx context.Context, env *Env, args ...Object) Object {
+	if len(args) == 0 {
+		return newError("wrong number of arguments to append: want at least 1, got 0")
+	}
+
+	arr, ok := args[0].(*Array)
+	if !ok {
+		return newError("first argument to append must be ARRAY, got %s", args[0].Type().String())
+	}
+
+	elems := make([]Object, 0, len(arr.Elems)+len(args)-1)
+	elems = append(elems, arr.Elems...)
+	elems = append(elems, args[1:]...)
+	return env.rt.track(&Array{Elems: elems})
+}
+
+// slice returns the elements of an Array, or characters of a String, from
+// start up to but not including end. Indexes are clamped to the bounds.
+func slice(ctx context.Context, env *Env, args ...Object) Object {
+	start, ok1 := args[1].(*Int)
+	end, ok2 := args[2].(*Int)
+	if !ok1 || !ok2 {
+		return newError("indexes passed to slice must be INT, got %s and %s", args[1].Type().String(), args[2].Type().String())
+	}
+
+	bounds := func(n int) (int, int) {
+		lo, hi := clamp(start.Value, n), clamp(end.Value, n)
+		if hi < lo {
+			hi = lo
+		}
+		return lo, hi
+	}
+
+	switch arg := args[0].(type) {
+	case *Array:
+		lo, hi := bounds(len(arg.Elems))
+		elems := make([]Object, hi-lo)
+		copy(elems, arg.Elems[lo:hi])
+		return env.rt.track(&Array{Elems: elems})
+	case *String:
+		runes := []rune(arg.Value)
+		lo, hi := bounds(len(runes))
+		return env.rt.track(&String{Value: string(runes[lo:hi])})
+	}
+	return newError("first argument to slice must be ARRAY or STRING, got %s", args[0].Type().String())
+}
+
+func clamp(i int64, n int) int {
+	if i < 0 {
+		return 0
+	}
+	if i > int64(n) {
+		return n
+	}
+	return int(i)
+}
+
+func getenv(ctx context.Context, env *Env, args ...Object) Object {
+	name, ok := args[0].(*String)
+	if !ok {
+		return newError("argument to os.getenv must be STRING, got %s", args[0].Type().String())
+	}
+
+	if err := env.Require(ENV_PERM, name.Value); err != nil {
+		return err
+	}
+
+	if value, ok := os.LookupEnv(name.Value); ok {
+		return &String{Value: value}
+	}
+	return NULL
+}
+
+func execCommand(ctx context.Context, env *Env, args ...Object) Object {
+	if len(args) == 0 {
+		return newError("wrong number of arguments to os.exec: want at least 1, got 0")
+	}
+
+	strs := make([]string, len(args))
+	for i, arg := range args {
+		s, ok := arg.(*String)
+		if !ok {
+			return newError("arguments to os.exec must be STRING, got %s", arg.Type().String())
+		}
+		strs[i] = s.Value
+	}
+
+	if err := env.Require(EXEC_PERM, strs[0]); err != nil {
+		return err
+	}
+
+	out, err := exec.CommandContext(ctx, strs[0], strs[1:]...).Output()
+	if err != nil {
+		return newError("os.exec: %s", err)
+	}
+	return env.rt.track(&String{Value: string(out)})
+}
@@ -0,0 +1,205 @@
+package types
+
+import (
+	"context"
+	"sort"
+
+	"github.com/gramidt/mash-lang-for-codemash/ast"
+)
+
+// initMethod is the name of the method called to initialize new instances.
+const initMethod = "init"
+
+// A Class is declared by class Name { methods }. Calling it creates an
+// Instance and calls its init method, if any, with the arguments.
+type Class struct {
+	Name    string
+	Super   *Class // nil if the class does not extend another
+	Methods map[string]*Fun
+}
+
+func (c *Class) Type() ObjType   { return CLASS_OBJ }
+func (c *Class) Inspect() string { return "<class " + c.Name + ">" }
+func (c *Class) IsTruthy() bool  { return true }
+
+// findMethod returns the method called name of c or the closest class it
+// extends that has one, along with that class.
+func (c *Class) findMethod(name string) (*Fun, *Class, bool) {
+	for class := c; class != nil; class = class.Super {
+		if method, ok := class.Methods[name]; ok {
+			return method, class, true
+		}
+	}
+	return nil, nil, false
+}
+
+// extends reports whether c is other or a class extending it.
+func (c *Class) extends(other *Class) bool {
+	for class := c; class != nil; class = class.Super {
+		if class == other {
+			return true
+		}
+	}
+	return false
+}
+
+// An Instance is an object created by calling a Class. Its fields are set by
+// assigning to self.name in its methods, or to instance.name.
+type Instance struct {
+	Class  *Class
+	Fields map[string]Object
+	Frozen bool // set by freeze, see Freeze
+}
+
+func (i *Instance) Type() ObjType   { return INSTANCE_OBJ }
+func (i *Instance) Inspect() string { return inspect(i) }
+func (i *Instance) parts() ([]string, []Object) {
+	names := make([]string, 0, len(i.Fields))
+	for name := range i.Fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fields := make([]Object, len(names))
+	for j, name := range names {
+		fields[j] = i.Fields[name]
+	}
+	return fieldParts(i.Class.Name+"{", names, fields, "}"), fields
+}
+func (i *Instance) IsTruthy() bool { return true }
+
+// A Super is the value of super in a method. Its methods are those of the
+// class extended by the class defining the method, bound to the same self.
+type Super struct {
+	Self  *Instance
+	Class *Class
+}
+
+func (s *Super) Type() ObjType   { return SUPER_OBJ }
+func (s *Super) Inspect() string { return "<super " + s.Class.Name + ">" }
+func (s *Super) IsTruthy() bool  { return true }
+
+func evalClassStmt(node *ast.ClassStmt, env *Env) Object {
+	class := &Class{Name: node.Name.Value, Methods: make(map[string]*Fun, len(node.Methods))}
+
+	if node.Super != nil {
+		super, ok := env.Get(node.Super.Value)
+		if !ok {
+			return newError("class %s extends undeclared class %s", class.Name, node.Super.Value)
+		}
+		if class.Super, ok = super.(*Class); !ok {
+			return newError("class %s cannot extend %s, a %s", class.Name, node.Super.Value, super.Type().String())
+		}
+	}
+
+	for _, method := range node.Methods {
+		class.Methods[method.Name.Value] = &Fun{Params: method.Fun.Params, Body: method.Fun.Body, Env: env, Generator: method.Fun.Generator, Async: method.Fun.Async}
+	}
+
+	if err := env.rt.alloc(funSize * int64(len(class.Methods))); err != nil {
+		return err
+	}
+	if result := env.Set(class.Name, class); isError(result) {
+		return result
+	}
+	return nil
+}
+
+// newInstance creates an Instance of class, initialized by calling its init
+// method with args.
+func newInstance(ctx context.Context, class *Class, args []Object, env *Env) Object {
+	if err := env.rt.alloc(objectSize); err != nil {
+		return err
+	}
+	inst := &Instance{Class: class, Fields: make(map[string]Object)}
+
+	init, owner, ok := class.findMethod(initMethod)
+	if !ok {
+		if len(args) != 0 {
+			return newError("wrong number of arguments to %s: want 0, got %d", class.Name, len(args))
+		}
+		return inst
+	}
+
+	result := applyFunction(ctx, env, class.Name+"."+initMethod, bindMethod(inst, init, owner), args)
+	if isError(result) {
+		return result
+	}
+	return inst
+}
+
+// bindMethod returns method, defined by owner, with self bound to inst and
+// super bound to the class owner extends.
+func bindMethod(inst *Instance, method *Fun, owner *Class) *Fun {
+	env := NewEnclosedEnv(method.Env)
+	env.Set("self", inst)
+	if owner.Super != nil {
+		env.Set("super", &Super{Self: inst, Class: owner.Super})
+	}
+	return &Fun{Params: method.Params, Body: method.Body, Env: env, Generator: method.Generator, Async: method.Async}
+}
+
+// selectInstance returns the field called name of inst, or else its method
+// called name bound to inst.
+func selectInstance(inst *Instance, name string) Object {
+	if value, ok := inst.Fields[name]; ok {
+		return value
+	}
+	if method, owner, ok := inst.Class.findMethod(name); ok {
+		return bindMethod(inst, method, owner)
+	}
+	return newError("%s has no field or method %s", inst.Class.Name, name)
+}
+
+// selectSuper returns the method called name of the class super refers to,
+// bound to the instance of the calling method.
+func selectSuper(super *Super, name string) Object {
+	if method, owner, ok := super.Class.findMethod(name); ok {
+		return bindMethod(super.Self, method, owner)
+	}
+	return newError("%s has no method %s", super.Class.Name, name)
+}
+
+// setField assigns val to the field called name of inst.
+func setField(inst *Instance, name string, val Object, env *Env) Object {
+	if inst.Frozen {
+		return newError("cannot modify frozen %s", inst.Class.Name)
+	}
+	if _, ok := inst.Fields[name]; !ok {
+		if err := env.rt.alloc(mapPairSize); err != nil {
+			return err
+		}
+	}
+	inst.Fields[name] = val
+	return nil
+}
+
+// instanceOf reports whether a value is an instance of a class or one
+// extending it, or a value of another type declared by the script.
+func instanceOf(ctx context.Context, env *Env, args ...Object) Object {
+	ok, isType := isInstance(args[0], args[1])
+	if !isType {
+		return newError("second argument to instanceOf must be a type, got %s", args[1].Type().String())
+	}
+	return nativeBool(ok)
+}
+
+// isInstance reports whether value is of the type typ declared by a script,
+// and whether typ is such a type at all.
+func isInstance(value, typ Object) (ok bool, isType bool) {
+	switch typ := typ.(type) {
+	case *Class:
+		inst, ok := value.(*Instance)
+		return ok && inst.Class.extends(typ), true
+	case *RecordType:
+		rec, ok := value.(*Record)
+		return ok && rec.RecordType == typ, true
+	case *Enum:
+		ev, ok := value.(*EnumValue)
+		return ok && ev.Variant.Enum == typ, true
+	case *Variant:
+		ev, ok := value.(*EnumValue)
+		return ok && ev.Variant == typ, true
+	}
+	return false, false
+}
@@ -0,0 +1,55 @@
+package types
+
+import "testing"
+
+func TestClasses(t *testing.T) {
+	runEvalTests(t, []evalTest{
+		{"methods and self", `class Counter {
+	init(start) { self.n = start }
+	inc() { self.n = self.n + 1; self }
+}
+Counter(1).inc().inc().n`, "3", ""},
+		{"inspect", `class A { init() { self.x = 1 } }
+A()`, "A{x: 1}", ""},
+		{"super", `class A {
+	init(x) { self.x = x }
+	describe() { format("A %d", self.x) }
+}
+class B extends A {
+	init(x) { super.init(x * 2) }
+	describe() { "B of " + super.describe() }
+}
+B(1).describe()`, "B of A 2", ""},
+		{"super chain", `class A { m() { 1 } }
+class B extends A { m() { super.m() + 1 } }
+class C extends B { m() { super.m() + 1 } }
+C().m()`, "3", ""},
+		{"bound method", `class C {
+	init() { self.n = 0 }
+	inc() { self.n = self.n + 1 }
+}
+var c = C()
+var inc = c.inc
+inc()
+inc()
+c.n`, "2", ""},
+		{"bound method as callback", `class Adder {
+	init(n) { self.n = n }
+	add(x) { x + self.n }
+}
+[1, 2].map(Adder(10).add)`, "[11, 12]", ""},
+		{"instanceOf", `class A {}
+class B extends A {}
+[instanceOf(B(), A), instanceOf(A(), B)]`, "[true, false]", ""},
+
+		{"unknown member", `class A {}
+A().missing`, "", "A has no field or method missing"},
+		{"constructor arity", `class A {}
+A(1)`, "", "wrong number of arguments to A: want 0, got 1"},
+		{"init arity", `class A { init(x) { self.x = x } }
+A()`, "", "wrong number of arguments to A.init: want 1, got 0"},
+		{"super without parent", `class A { m() { super.m() } }
+A().m()`, "", "invalid identifier: super"},
+		{"undeclared parent", `class B extends Nope {}`, "", "class B extends undeclared class Nope"},
+	})
+}
@@ -0,0 +1,555 @@
+package types
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// collectionFuns are the higher-order functions on Arrays. Each is both a
+// builtin, taking the Array as its first argument, and a method of Arrays.
+var collectionFuns = []*Builtin{
+	{Name: "map", Fun: arrayMap, Arity: 2},
+	{Name: "filter", Fun: arrayFilter, Arity: 2},
+	{Name: "reduce", Fun: arrayReduce, Arity: VariadicArity},
+	{Name: "find", Fun: arrayFind, Arity: 2},
+	{Name: "any", Fun: arrayAny, Arity: 2},
+	{Name: "all", Fun: arrayAll, Arity: 2},
+	{Name: "zip", Fun: arrayZip, Arity: VariadicArity},
+	{Name: "flatMap", Fun: arrayFlatMap, Arity: 2},
+	{Name: "groupBy", Fun: arrayGroupBy, Arity: 2},
+	{Name: "sort", Fun: arraySort, Arity: 1},
+	{Name: "sortBy", Fun: arraySortBy, Arity: 2},
+	{Name: "unique", Fun: arrayUnique, Arity: 1},
+}
+
+// The collection functions call back into the evaluator, which refers to
+// builtins, so they are added by init to avoid an initialization cycle.
+func init() {
+	for _, fun := range collectionFuns {
+		builtins[fun.Name] = fun
+	}
+	builtins["range"] = &Builtin{Name: "range", Fun: rangeBuiltin, Arity: VariadicArity}
+}
+
+// Apply calls fun, a function value of a script or a builtin, with args. It
+// lets builtins registered by the host call functions passed to them, with
+// the same limits as calls made by the script itself. A builtin must pass
+// the context it was called with, see BuiltinFun.
+func (e *Env) Apply(ctx context.Context, fun Object, args ...Object) Object {
+	name := "<anonymous>"
+	if builtin, ok := fun.(*Builtin); ok {
+		name = builtin.Name
+	}
+	ctx, leave, _ := e.rt.sched.enter(ctx)
+	defer leave()
+	return applyFunction(ctx, e, name, fun, args)
+}
+
+// callPredicate calls pred with elem and reports whether it returned a
+// truthy value.
+func callPredicate(ctx context.Context, env *Env, name string, pred Object, elem Object) (bool, *Error) {
+	result := applyFunction(ctx, env, name, pred, []Object{elem})
+	if err, ok := result.(*Error); ok {
+		return false, err
+	}
+	return result != nil && result.IsTruthy(), nil
+}
+
+func arrayMap(ctx context.Context, env *Env, args ...Object) Object {
+	arr, err := arrayArg(env, "map", args, 0)
+	if err != nil {
+		return err
+	}
+
+	elems := make([]Object, len(arr.Elems))
+	defer env.rt.mem.pin(&elems)()
+	for i, elem := range arr.Elems {
+		result := applyFunction(ctx, env, "map", args[1], []Object{elem})
+		if isError(result) {
+			return result
+		}
+		if result == nil {
+			result = NULL
+		}
+		elems[i] = result
+	}
+
+	return env.rt.track(&Array{Elems: elems})
+}
+
+func arrayFilter(ctx context.Context, env *Env, args ...Object) Object {
+	arr, err := arrayArg(env, "filter", args, 0)
+	if err != nil {
+		return err
+	}
+
+	elems := []Object{}
+	defer env.rt.mem.pin(&elems)()
+	for _, elem := range arr.Elems {
+		ok, err := callPredicate(ctx, env, "filter", args[1], elem)
+		if err != nil {
+			return err
+		}
+		if ok {
+			elems = append(elems, elem)
+		}
+	}
+
+	return env.rt.track(&Array{Elems: elems})
+}
+
+// arrayReduce combines the elements of an Array from left to right by
+// calling a function with the result so far and the next element. The
+// result starts out as the optional third argument, or else as the first
+// element.
+func arrayReduce(ctx context.Context, env *Env, args ...Object) Object {
+	if len(args) != 2 && len(args) != 3 {
+		return newError("wrong number of arguments to reduce: want 2 or 3, got %d", len(args))
+	}
+
+	arr, err := arrayArg(env, "reduce", args, 0)
+	if err != nil {
+		return err
+	}
+
+	elems := arr.Elems
+	var acc Object
+	if len(args) == 3 {
+		acc = args[2]
+	} else {
+		if len(elems) == 0 {
+			return newError("reduce of empty ARRAY with no initial value")
+		}
+		acc, elems = elems[0], elems[1:]
+	}
+
+	for _, elem := range elems {
+		acc = applyFunction(ctx, env, "reduce", args[1], []Object{acc, elem})
+		if isError(acc) {
+			return acc
+		}
+		if acc == nil {
+			acc = NULL
+		}
+	}
+
+	return acc
+}
+
+// arrayFind returns the first element of an Array for which a predicate
+// returns a truthy value, or null.
+func arrayFind(ctx context.Context, env *Env, args ...Object) Object {
+	arr, err := arrayArg(env, "find", args, 0)
+	if err != nil {
+		return err
+	}
+
+	for _, elem := range arr.Elems {
+		ok, err := callPredicate(ctx, env, "find", args[1], elem)
+		if err != nil {
+			return err
+		}
+		if ok {
+			return elem
+		}
+	}
+
+	return NULL
+}
+
+func arrayAny(ctx context.Context, env *Env, args ...Object) Object {
+	arr, err := arrayArg(env, "any", args, 0)
+	if err != nil {
+		return err
+	}
+
+	for _, elem := range arr.Elems {
+		ok, err := callPredicate(ctx, env, "any", args[1], elem)
+		if err != nil {
+			return err
+		}
+		if ok {
+			return TRUE
+		}
+	}
+
+	return FALSE
+}
+
+func arrayAll(ctx context.Context, env *Env, args ...Object) Object {
+	arr, err := arrayArg(env, "all", args, 0)
+	if err != nil {
+		return err
+	}
+
+	for _, elem := range arr.Elems {
+		ok, err := callPredicate(ctx, env, "all", args[1], elem)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return FALSE
+		}
+	}
+
+	return TRUE
+}
+
+// arrayZip returns an Array of Arrays holding the elements at the same index
+// of each of its arguments, as long as the shortest argument.
+func arrayZip(ctx context.Context, env *Env, args ...Object) Object {
+	if len(args) < 2 {
+		return newError("wrong number of arguments to zip: want at least 2, got %d", len(args))
+	}
+
+	n := -1
+	arrs := make([]*Array, len(args))
+	for i := range args {
+		arr, err := arrayArg(env, "zip", args, i)
+		if err != nil {
+			return err
+		}
+		if n < 0 || len(arr.Elems) < n {
+			n = len(arr.Elems)
+		}
+		arrs[i] = arr
+	}
+
+	tuples := make([]Object, n)
+	for i := range tuples {
+		tuple := make([]Object, len(arrs))
+		for j, arr := range arrs {
+			tuple[j] = arr.Elems[i]
+		}
+		tuples[i] = env.rt.track(&Array{Elems: tuple})
+		if isError(tuples[i]) {
+			return tuples[i]
+		}
+	}
+
+	return env.rt.track(&Array{Elems: tuples})
+}
+
+// arrayFlatMap calls a function with each element of an Array and returns
+// the elements of the Arrays it returns, in order. Results that are not
+// Arrays are kept as they are.
+func arrayFlatMap(ctx context.Context, env *Env, args ...Object) Object {
+	arr, err := arrayArg(env, "flatMap", args, 0)
+	if err != nil {
+		return err
+	}
+
+	elems := []Object{}
+	defer env.rt.mem.pin(&elems)()
+	for _, elem := range arr.Elems {
+		result := applyFunction(ctx, env, "flatMap", args[1], []Object{elem})
+		switch result := result.(type) {
+		case *Error:
+			return result
+		case *Array:
+			elems = append(elems, result.Elems...)
+		case nil:
+			elems = append(elems, NULL)
+		default:
+			elems = append(elems, result)
+		}
+	}
+
+	return env.rt.track(&Array{Elems: elems})
+}
+
+// arrayGroupBy returns a Map from each key a function returns for the
+// elements of an Array to the Array of elements it returned that key for.
+func arrayGroupBy(ctx context.Context, env *Env, args ...Object) Object {
+	arr, err := arrayArg(env, "groupBy", args, 0)
+	if err != nil {
+		return err
+	}
+
+	groups := NewMap()
+	for _, elem := range arr.Elems {
+		result := applyFunction(ctx, env, "groupBy", args[1], []Object{elem})
+		if isError(result) {
+			return result
+		}
+
+		key, ok := result.(Hashable)
+		if !ok {
+			return newError("invalid map key returned to groupBy: %s", result.Type().String())
+		}
+
+		group, ok := groups.Get(key)
+		if !ok {
+			group = &Array{}
+		}
+		group.(*Array).Elems = append(group.(*Array).Elems, elem)
+		groups.Set(key, group)
+	}
+
+	for _, pair := range groups.Pairs {
+		if err := env.rt.track(pair.Value); isError(err) {
+			return err
+		}
+	}
+	return env.rt.track(groups)
+}
+
+// arraySort returns the elements of an Array of numbers or of Strings in
+// ascending order.
+func arraySort(ctx context.Context, env *Env, args ...Object) Object {
+	arr, err := arrayArg(env, "sort", args, 0)
+	if err != nil {
+		return err
+	}
+
+	return sortElems(arr, env, func(a, b Object) (bool, *Error) {
+		cmp, err := compareObjects(a, b)
+		return cmp < 0, err
+	})
+}
+
+// arraySortBy returns the elements of an Array sorted by a comparator. The
+// comparator is called with two elements and returns either a Bool telling
+// whether the first goes before the second, or an Int that is negative,
+// zero or positive as the first is less than, equal to or greater than the
+// second. The sort is stable.
+func arraySortBy(ctx context.Context, env *Env, args ...Object) Object {
+	arr, err := arrayArg(env, "sortBy", args, 0)
+	if err != nil {
+		return err
+	}
+
+	return sortElems(arr, env, func(a, b Object) (bool, *Error) {
+		switch result := applyFunction(ctx, env, "sortBy", args[1], []Object{a, b}).(type) {
+		case *Error:
+			return false, result
+		case *Bool:
+			return result.Value, nil
+		case *Int:
+			return result.Value < 0, nil
+		default:
+			return false, newError("comparator passed to sortBy must return BOOL or INT")
+		}
+	})
+}
+
+func sortElems(arr *Array, env *Env, less func(a, b Object) (bool, *Error)) Object {
+	elems := append([]Object{}, arr.Elems...)
+
+	var sortErr *Error
+	sort.SliceStable(elems, func(i, j int) bool {
+		if sortErr != nil {
+			return false
+		}
+		ok, err := less(elems[i], elems[j])
+		if err != nil {
+			sortErr = err
+		}
+		return ok
+	})
+	if sortErr != nil {
+		return sortErr
+	}
+
+	return env.rt.track(&Array{Elems: elems})
+}
+
+// compareObjects returns -1, 0 or 1 as a is less than, equal to or greater
+// than b, which must both be numbers or both be Strings.
+func compareObjects(a, b Object) (int, *Error) {
+	if a, ok := a.(*String); ok {
+		if b, ok := b.(*String); ok {
+			switch {
+			case a.Value < b.Value:
+				return -1, nil
+			case a.Value > b.Value:
+				return 1, nil
+			}
+			return 0, nil
+		}
+	}
+
+	x, ok1 := toFloat(a)
+	y, ok2 := toFloat(b)
+	if !ok1 || !ok2 {
+		return 0, newError("cannot compare %s and %s", a.Type().String(), b.Type().String())
+	}
+	switch {
+	case x < y:
+		return -1, nil
+	case x > y:
+		return 1, nil
+	}
+	return 0, nil
+}
+
+func toFloat(obj Object) (float64, bool) {
+	switch obj := obj.(type) {
+	case *Int:
+		return float64(obj.Value), true
+	case *Float:
+		return obj.Value, true
+	}
+	return 0, false
+}
+
+// arrayUnique returns the elements of an Array without repetitions, keeping
+// the first occurrence of each. Elements are equal the way == compares them,
+// so 1 and 1.0 are the same element but two equal Arrays are not.
+func arrayUnique(ctx context.Context, env *Env, args ...Object) Object {
+	arr, err := arrayArg(env, "unique", args, 0)
+	if err != nil {
+		return err
+	}
+
+	seen := make(map[HashKey]bool, len(arr.Elems))
+	elems := []Object{}
+	others := []Object{} // the kept elements without a uniqueKey
+	for _, elem := range arr.Elems {
+		if key, ok := uniqueKey(elem); ok {
+			if !seen[key] {
+				seen[key] = true
+				elems = append(elems, elem)
+			}
+			continue
+		}
+
+		found := false
+		for _, other := range others {
+			equal, err := objectsEqual(elem, other)
+			if err != nil {
+				return err
+			}
+			if equal {
+				found = true
+				break
+			}
+		}
+		if !found {
+			others = append(others, elem)
+			elems = append(elems, elem)
+		}
+	}
+
+	return env.rt.track(&Array{Elems: elems})
+}
+
+// uniqueKey returns the HashKey identifying elem for unique. A Float with an
+// integral value has the key of the equal Int. Values compared by their
+// fields, and NaN, have no key.
+func uniqueKey(elem Object) (HashKey, bool) {
+	switch elem := elem.(type) {
+	case Hashable:
+		return elem.HashKey(), true
+	case *Float:
+		f := elem.Value
+		if f == math.Trunc(f) && f >= math.MinInt64 && f < math.MaxInt64 {
+			return (&Int{Value: int64(f)}).HashKey(), true
+		}
+		if f != f {
+			return HashKey{}, false
+		}
+		return HashKey{Type: FLOAT_OBJ, Value: math.Float64bits(f)}, true
+	}
+	return HashKey{}, false
+}
+
+// A Range is the sequence of Ints returned by range. Its Ints are made as
+// they are iterated over, so a range takes no memory however long it is.
+// The collection functions take a Range for an Array, collecting its Ints
+// into one.
+type Range struct {
+	Start, Stop, Step int64
+	n                 uint64 // the number of Ints
+}
+
+func (r *Range) Type() ObjType { return RANGE_OBJ }
+func (r *Range) Inspect() string {
+	if r.Step == 1 {
+		return fmt.Sprintf("range(%d, %d)", r.Start, r.Stop)
+	}
+	return fmt.Sprintf("range(%d, %d, %d)", r.Start, r.Stop, r.Step)
+}
+func (r *Range) IsTruthy() bool { return true }
+
+// at returns the i-th Int of r.
+func (r *Range) at(i uint64) *Int {
+	return &Int{Value: r.Start + int64(i)*r.Step}
+}
+
+// toArray returns the Ints of r as an Array, failing if there are more than
+// maxArrayLength.
+func (r *Range) toArray(env *Env) Object {
+	if r.n > maxArrayLength {
+		return newError("%s has more than %d elements, too many for an ARRAY", r.Inspect(), maxArrayLength)
+	}
+	if err := env.rt.alloc(int64(r.n) * objectSize); err != nil {
+		return err
+	}
+	elems := make([]Object, r.n)
+	for i := range elems {
+		elems[i] = r.at(uint64(i))
+	}
+	return env.rt.track(&Array{Elems: elems})
+}
+
+// rangeBuiltin returns the Range of the Ints from start up to but not
+// including stop, counting by step. It is called as range(stop),
+// range(start, stop) or range(start, stop, step); start defaults to 0 and
+// step to 1.
+func rangeBuiltin(ctx context.Context, env *Env, args ...Object) Object {
+	if len(args) < 1 || len(args) > 3 {
+		return newError("wrong number of arguments to range: want 1 to 3, got %d", len(args))
+	}
+
+	bounds := []int64{0, 0, 1}
+	for i := range args {
+		n, err := intArg("range", args, i)
+		if err != nil {
+			return err
+		}
+		bounds[i] = n
+	}
+	if len(args) == 1 {
+		bounds[0], bounds[1] = 0, bounds[0]
+	}
+
+	r := &Range{Start: bounds[0], Stop: bounds[1], Step: bounds[2]}
+	if r.Step == 0 {
+		return newError("range step must not be zero")
+	}
+
+	// The count is computed in uint64, in which the distance between any
+	// two Ints and the size of any step fit.
+	if r.Step > 0 && r.Stop > r.Start {
+		r.n = (uint64(r.Stop)-uint64(r.Start)-1)/uint64(r.Step) + 1
+	} else if r.Step < 0 && r.Stop < r.Start {
+		r.n = (uint64(r.Start)-uint64(r.Stop)-1)/(0-uint64(r.Step)) + 1
+	}
+
+	return env.rt.track(r)
+}
+
+// rangeToArray returns the Ints of a Range as an Array.
+func rangeToArray(ctx context.Context, env *Env, args ...Object) Object {
+	return args[0].(*Range).toArray(env)
+}
+
+// arrayArg returns args[i] of the builtin called name as an Array. A Range
+// is collected into an Array.
+func arrayArg(env *Env, name string, args []Object, i int) (*Array, *Error) {
+	switch arg := args[i].(type) {
+	case *Array:
+		return arg, nil
+	case *Range:
+		switch arr := arg.toArray(env).(type) {
+		case *Error:
+			return nil, arr
+		case *Array:
+			return arr, nil
+		}
+	}
+	return nil, newError("argument %d to %s must be ARRAY, got %s", i, name, args[i].Type().String())
+}
@@ -0,0 +1,114 @@
+package types
+
+import (
+	"context"
+	"testing"
+)
+
+func TestCollections(t *testing.T) {
+	runEvalTests(t, []evalTest{
+		{"map", `[1, 2, 3].map(fun(x) { x * 2 })`, "[2, 4, 6]", ""},
+		{"map builtin", `map([1, 2], fun(x) { x + 1 })`, "[2, 3]", ""},
+		{"map with builtin", `[[1], [1, 2]].map(len)`, "[1, 2]", ""},
+		{"filter", `[1, 2, 3, 4].filter(fun(x) { x % 2 == 0 })`, "[2, 4]", ""},
+		{"reduce", `[1, 2, 3, 4].reduce(fun(acc, x) { acc * x })`, "24", ""},
+		{"reduce with initial value", `[1, 2].reduce(fun(acc, x) { acc + x }, 10)`, "13", ""},
+		{"reduce empty with initial value", `[].reduce(fun(acc, x) { acc + x }, 0)`, "0", ""},
+		{"find", `[1, 2, 3, 4].find(fun(x) { x > 2 })`, "3", ""},
+		{"find missing", `[1, 2].find(fun(x) { x > 2 })`, "null", ""},
+		{"any", `[[1, 3].any(fun(x) { x > 2 }), [].any(fun(x) { true })]`, "[true, false]", ""},
+		{"all", `[[1, 3].all(fun(x) { x > 2 }), [].all(fun(x) { false })]`, "[false, true]", ""},
+		{"zip", `zip([1, 2, 3], ["a", "b"])`, "[[1, a], [2, b]]", ""},
+		{"zip three", `[1, 2].zip([3, 4], [5, 6])`, "[[1, 3, 5], [2, 4, 6]]", ""},
+		{"flatMap", `[1, 2].flatMap(fun(x) { [x, x * 10] })`, "[1, 10, 2, 20]", ""},
+		{"flatMap non-array", `[1, 2].flatMap(fun(x) { x })`, "[1, 2]", ""},
+		{"groupBy", `[1, 2, 3, 4, 5].groupBy(fun(x) { x % 2 })`, "{0: [2, 4], 1: [1, 3, 5]}", ""},
+		{"sort", `[[3, 1.5, 2].sort(), ["b", "a"].sort()]`, "[[1.5, 2, 3], [a, b]]", ""},
+		{"sort copies", `var xs = [2, 1]; xs.sort(); xs`, "[2, 1]", ""},
+		{"sortBy bool", `[1, 3, 2].sortBy(fun(a, b) { a > b })`, "[3, 2, 1]", ""},
+		{"sortBy int", `["bb", "a", "ccc"].sortBy(fun(a, b) { a.len() - b.len() })`, "[a, bb, ccc]", ""},
+		{"sortBy is stable", `[[2, "a"], [1, "b"], [2, "c"]].sortBy(fun(a, b) { a[0] < b[0] }).map(fun(p) { p[1] })`, "[b, a, c]", ""},
+		{"unique", `[1, 2, 1, "a", "a", true].unique()`, "[1, 2, a, true]", ""},
+		{"unique numbers", `[1.5, 1.5, 1, 1.0, 2.0, 2, 0 / 1.0, -0.5, -0.5].unique()`, "[1.5, 1, 2, 0, -0.5]", ""},
+		{"unique by ==", `record P { x }
+var xs = [1];
+[xs, xs, [1], P(1), P(1)].unique()`, "[[1], [1], P{x: 1}]", ""},
+		{"range", `[range(3), range(1, 4), range(0, 10, 3), range(3, 0, -1), range(3, 0)].map(fun(r) { r.toArray() })`, "[[0, 1, 2], [1, 2, 3], [0, 3, 6, 9], [3, 2, 1], []]", ""},
+		{"composition", `range(10).filter(fun(x) { x % 3 == 0 }).map(fun(x) { x * x }).reduce(fun(acc, x) { acc + x })`, "126", ""},
+		{"std list", `import "std/list";
+[list.reverse([1, 2, 3]), list.concat([1], [2, 3]), list.fold([1, 2], 0, fun(acc, x) { acc + x })]`, "[[3, 2, 1], [1, 2, 3], 3]", ""},
+
+		{"not a function", `[1].map(1)`, "", "invalid function: INT"},
+		{"not an array", `map(1, fun(x) { x })`, "", "argument 0 to map must be ARRAY, got INT"},
+		{"callback error", `[1, 2].filter(fun(x) { x + "a" })`, "", "invalid operation: INT + STRING"},
+		{"reduce empty", `[].reduce(fun(acc, x) { acc + x })`, "", "reduce of empty ARRAY with no initial value"},
+		{"reduce arity", `reduce([1])`, "", "wrong number of arguments to reduce: want 2 or 3, got 1"},
+		{"zip arity", `zip([1])`, "", "wrong number of arguments to zip: want at least 2, got 1"},
+		{"groupBy key", `[1].groupBy(fun(x) { [x] })`, "", "invalid map key returned to groupBy: ARRAY"},
+		{"sort mixed", `[1, "a"].sort()`, "", "cannot compare STRING and INT"},
+		{"sortBy result", `[1, 2].sortBy(fun(a, b) { "a" })`, "", "comparator passed to sortBy must return BOOL or INT"},
+		{"huge range", `iter(range(-9223372036854775807, 9223372036854775807)).take(2).toArray()`, "[-9223372036854775807, -9223372036854775806]", ""},
+		{"range step", `range(0, 10, 0)`, "", "range step must not be zero"},
+		{"range arity", `range()`, "", "wrong number of arguments to range: want 1 to 3, got 0"},
+	})
+}
+
+func TestApply(t *testing.T) {
+	env := NewEnv()
+	err := env.RegisterBuiltin("twice", func(ctx context.Context, env *Env, args ...Object) Object {
+		once := env.Apply(ctx, args[0], args[1])
+		if isError(once) {
+			return once
+		}
+		return env.Apply(ctx, args[0], once)
+	}, 2)
+	if err != nil {
+		t.Fatalf("RegisterBuiltin: %v", err)
+	}
+
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{`twice(fun(x) { x * 3 }, 2)`, "18"},
+		{`twice(len, [1, 2])`, "ERROR: argument to len not supported, got INT"},
+		{`twice(fun(x) { x + "a" }, 1)`, "ERROR: invalid operation: INT + STRING"},
+	}
+	for _, tt := range tests {
+		if got := evalSource(t, tt.src, env).Inspect(); got != tt.want {
+			t.Errorf("%s = %s, want %s", tt.src, got, tt.want)
+		}
+	}
+}
+
+func TestRangeComposition(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{`range(5)`, "range(0, 5)"},
+		{`range(10, 0, -3)`, "range(10, 0, -3)"},
+		{`map(range(3), fun(x) { x * 2 })`, "[0, 2, 4]"},
+		{`range(0, 5).map(fun(x) { x * x })`, "[0, 1, 4, 9, 16]"},
+		{`range(10).filter(fun(x) { x % 3 == 0 })`, "[0, 3, 6, 9]"},
+		{`range(1, 5).reduce(fun(acc, x) { acc * x })`, "24"},
+		{`sort(range(3, 0, -1))`, "[1, 2, 3]"},
+		{`len(range(0, 10, 3))`, "4"},
+		{`range(0, 10, 3).len()`, "4"},
+		{`len(range(5, 0))`, "0"},
+		{`zip(range(2), ["a", "b", "c"])`, "[[0, a], [1, b]]"},
+		{`range(3).toArray()`, "[0, 1, 2]"},
+		{`iter(range(100000000000)).map(fun(x) { x + 1 }).take(3).toArray()`, "[1, 2, 3]"},
+		{`var total = 0
+for (i in range(4)) { total = total + i }
+total`, "6"},
+		{`range(100000000000).map(fun(x) { x })`, "ERROR: range(0, 100000000000) has more than 16777216 elements, too many for an ARRAY"},
+		{`map(range(0, 5), 1)`, "ERROR: invalid function: INT"},
+	}
+
+	for _, tt := range tests {
+		if got := evalSource(t, tt.src, NewEnv()).Inspect(); got != tt.want {
+			t.Errorf("%s = %s, want %s", tt.src, got, tt.want)
+		}
+	}
+}
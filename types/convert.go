@@ -0,0 +1,571 @@
+package types
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+var (
+	errorType     = reflect.TypeOf((*error)(nil)).Elem()
+	objectType    = reflect.TypeOf((*Object)(nil)).Elem()
+	timeType      = reflect.TypeOf(time.Time{})
+	interfaceType = reflect.TypeOf((*interface{})(nil)).Elem()
+)
+
+// FromGo converts a Go value into a Mash object.
+//
+// Booleans, integers, floats and strings become Bool, Int, Float and String
+// objects. Slices and arrays become Arrays, maps become Maps, and structs
+// become Maps keyed by field name, or by the name given in a `mash:"name"`
+// field tag (a tag of "-" skips the field). Pointers and interfaces are
+// followed, with nil converting to null. A time.Time becomes an RFC 3339
+// String, an error becomes an Error and a function is wrapped with WrapFunc.
+func FromGo(v interface{}) (Object, error) {
+	if v == nil {
+		return NULL, nil
+	}
+	return fromGoValue(reflect.ValueOf(v), nil)
+}
+
+// ToGo stores the Go representation of obj in the value pointed to by
+// target, which must be a non-nil pointer. It is the inverse of FromGo.
+//
+// When target points to an empty interface the natural Go type of obj is
+// used: bool, int64, float64, string, error, []interface{},
+// map[string]interface{} or nil. Maps whose keys are not strings, integers
+// or booleans, or whose keys convert to the same string, fail, as do values
+// of other types. There a Record becomes the map of its fields, and an enum
+// value its qualified variant name, such as "Shape.Empty", or if the variant
+// has fields a map holding the map of its fields under that name. Structs
+// take the fields of a Record like the keys of a Map.
+//
+// Functions and namespaces convert one way only: FromGo wraps Go functions
+// as Builtins, but ToGo fails for FUNCTION, BUILTIN and NAMESPACE values, as
+// they cannot run outside the runtime. A target of type Object receives them
+// unconverted, and Env.Apply calls them.
+func ToGo(obj Object, target interface{}) error {
+	if obj == nil {
+		obj = NULL
+	}
+
+	v := reflect.ValueOf(target)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return fmt.Errorf("cannot convert %s: target must be a non-nil pointer", obj.Type())
+	}
+
+	elem, err := toGoValue(obj, v.Type().Elem(), nil)
+	if err != nil {
+		return err
+	}
+
+	v.Elem().Set(elem)
+	return nil
+}
+
+// A goRef identifies a Go pointer, map or slice being converted by
+// fromGoValue.
+type goRef struct {
+	ptr uintptr
+	typ reflect.Type
+}
+
+// fromGoValue converts v for FromGo. visiting holds the pointers, maps and
+// slices being converted, so that cyclic values fail instead of recursing
+// forever.
+func fromGoValue(v reflect.Value, visiting map[goRef]bool) (Object, error) {
+	if !v.IsValid() {
+		return NULL, nil
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Map, reflect.Slice:
+		if !v.IsNil() && (v.Kind() != reflect.Slice || v.Len() > 0) {
+			ref := goRef{v.Pointer(), v.Type()}
+			if visiting[ref] {
+				return nil, fmt.Errorf("cannot convert cyclic value of type %s", v.Type())
+			}
+			if visiting == nil {
+				visiting = make(map[goRef]bool)
+			}
+			visiting[ref] = true
+			defer delete(visiting, ref)
+		}
+	}
+
+	if v.Type().Implements(objectType) {
+		if isNilValue(v) {
+			return NULL, nil
+		}
+		return v.Interface().(Object), nil
+	}
+
+	if v.Type() == timeType {
+		return &String{Value: v.Interface().(time.Time).Format(time.RFC3339Nano)}, nil
+	}
+
+	if v.Type().Implements(errorType) {
+		if isNilValue(v) {
+			return NULL, nil
+		}
+		return &Error{Msg: v.Interface().(error).Error()}, nil
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		if v.Bool() {
+			return TRUE, nil
+		}
+		return FALSE, nil
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return &Int{Value: v.Int()}, nil
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		u := v.Uint()
+		if u > 1<<63-1 {
+			return nil, fmt.Errorf("%d overflows INT", u)
+		}
+		return &Int{Value: int64(u)}, nil
+
+	case reflect.Float32, reflect.Float64:
+		return &Float{Value: v.Float()}, nil
+
+	case reflect.String:
+		return &String{Value: v.String()}, nil
+
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return NULL, nil
+		}
+		return fromGoValue(v.Elem(), visiting)
+
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return NULL, nil
+		}
+		elems := make([]Object, v.Len())
+		for i := range elems {
+			elem, err := fromGoValue(v.Index(i), visiting)
+			if err != nil {
+				return nil, fmt.Errorf("index %d: %w", i, err)
+			}
+			elems[i] = elem
+		}
+		return &Array{Elems: elems}, nil
+
+	case reflect.Map:
+		if v.IsNil() {
+			return NULL, nil
+		}
+		m := NewMap()
+		iter := v.MapRange()
+		for iter.Next() {
+			key, err := fromGoValue(iter.Key(), visiting)
+			if err != nil {
+				return nil, fmt.Errorf("map key: %w", err)
+			}
+			hashKey, ok := key.(Hashable)
+			if !ok {
+				return nil, fmt.Errorf("invalid map key: %s", key.Type())
+			}
+			value, err := fromGoValue(iter.Value(), visiting)
+			if err != nil {
+				return nil, fmt.Errorf("key %s: %w", key.Inspect(), err)
+			}
+			m.Set(hashKey, value)
+		}
+		return m, nil
+
+	case reflect.Struct:
+		m := NewMap()
+		for _, field := range structFields(v.Type()) {
+			value, err := fromGoValue(v.FieldByIndex(field.index), visiting)
+			if err != nil {
+				return nil, fmt.Errorf("field %s: %w", field.name, err)
+			}
+			m.Set(&String{Value: field.name}, value)
+		}
+		return m, nil
+
+	case reflect.Func:
+		if v.IsNil() {
+			return NULL, nil
+		}
+		// WrapFunc returns a nil *Builtin on failure, which must not become
+		// a non-nil Object.
+		b, err := WrapFunc(v.Type().String(), v.Interface())
+		if err != nil {
+			return nil, err
+		}
+		return b, nil
+	}
+
+	return nil, fmt.Errorf("unsupported type %s", v.Type())
+}
+
+// toGoValue converts obj to a value of type t for ToGo. A nil obj converts
+// like null. visiting holds the Arrays and Maps whose elements are being
+// converted.
+func toGoValue(obj Object, t reflect.Type, visiting map[Object]bool) (reflect.Value, error) {
+	v := reflect.New(t).Elem()
+	if obj == nil {
+		obj = NULL
+	}
+
+	if t == objectType {
+		v.Set(reflect.ValueOf(obj))
+		return v, nil
+	}
+	if err := oneWay(obj); err != nil {
+		return v, err
+	}
+
+	if t == timeType {
+		s, ok := obj.(*String)
+		if !ok {
+			return v, cannotUse(obj, t)
+		}
+		tm, err := time.Parse(time.RFC3339Nano, s.Value)
+		if err != nil {
+			return v, fmt.Errorf("cannot use %q as %s: %w", s.Value, t, err)
+		}
+		v.Set(reflect.ValueOf(tm))
+		return v, nil
+	}
+
+	if t == errorType {
+		switch obj := obj.(type) {
+		case *Null:
+			return v, nil
+		case *Error:
+			v.Set(reflect.ValueOf(errors.New(obj.Msg)))
+			return v, nil
+		}
+		return v, cannotUse(obj, t)
+	}
+
+	switch t.Kind() {
+	case reflect.Slice, reflect.Array, reflect.Map, reflect.Struct:
+		var err error
+		if visiting, err = visit(visiting, obj); err != nil {
+			return v, err
+		}
+		defer delete(visiting, obj)
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		b, ok := obj.(*Bool)
+		if !ok {
+			return v, cannotUse(obj, t)
+		}
+		v.SetBool(b.Value)
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, ok := obj.(*Int)
+		if !ok {
+			return v, cannotUse(obj, t)
+		}
+		if v.OverflowInt(i.Value) {
+			return v, fmt.Errorf("%d overflows %s", i.Value, t)
+		}
+		v.SetInt(i.Value)
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		i, ok := obj.(*Int)
+		if !ok {
+			return v, cannotUse(obj, t)
+		}
+		if i.Value < 0 || v.OverflowUint(uint64(i.Value)) {
+			return v, fmt.Errorf("%d overflows %s", i.Value, t)
+		}
+		v.SetUint(uint64(i.Value))
+
+	case reflect.Float32, reflect.Float64:
+		switch n := obj.(type) {
+		case *Float:
+			v.SetFloat(n.Value)
+		case *Int:
+			v.SetFloat(float64(n.Value))
+		default:
+			return v, cannotUse(obj, t)
+		}
+
+	case reflect.String:
+		s, ok := obj.(*String)
+		if !ok {
+			return v, cannotUse(obj, t)
+		}
+		v.SetString(s.Value)
+
+	case reflect.Ptr:
+		if obj == NULL {
+			return v, nil
+		}
+		elem, err := toGoValue(obj, t.Elem(), visiting)
+		if err != nil {
+			return v, err
+		}
+		ptr := reflect.New(t.Elem())
+		ptr.Elem().Set(elem)
+		v.Set(ptr)
+
+	case reflect.Interface:
+		if t != interfaceType {
+			return v, fmt.Errorf("unsupported type %s", t)
+		}
+		natural, err := toNaturalGo(obj, visiting)
+		if err != nil {
+			return v, err
+		}
+		if natural != nil {
+			v.Set(reflect.ValueOf(natural))
+		}
+
+	case reflect.Slice:
+		if obj == NULL {
+			return v, nil
+		}
+		arr, ok := obj.(*Array)
+		if !ok {
+			return v, cannotUse(obj, t)
+		}
+		v.Set(reflect.MakeSlice(t, len(arr.Elems), len(arr.Elems)))
+		for i, elem := range arr.Elems {
+			ev, err := toGoValue(elem, t.Elem(), visiting)
+			if err != nil {
+				return v, fmt.Errorf("index %d: %w", i, err)
+			}
+			v.Index(i).Set(ev)
+		}
+
+	case reflect.Array:
+		arr, ok := obj.(*Array)
+		if !ok {
+			return v, cannotUse(obj, t)
+		}
+		if len(arr.Elems) != t.Len() {
+			return v, fmt.Errorf("cannot use ARRAY of length %d as %s", len(arr.Elems), t)
+		}
+		for i, elem := range arr.Elems {
+			ev, err := toGoValue(elem, t.Elem(), visiting)
+			if err != nil {
+				return v, fmt.Errorf("index %d: %w", i, err)
+			}
+			v.Index(i).Set(ev)
+		}
+
+	case reflect.Map:
+		if obj == NULL {
+			return v, nil
+		}
+		m, ok := obj.(*Map)
+		if !ok {
+			return v, cannotUse(obj, t)
+		}
+		v.Set(reflect.MakeMapWithSize(t, len(m.Pairs)))
+		for _, pair := range m.SortedPairs() {
+			kv, err := toGoValue(pair.Key, t.Key(), visiting)
+			if err != nil {
+				return v, fmt.Errorf("map key: %w", err)
+			}
+			ev, err := toGoValue(pair.Value, t.Elem(), visiting)
+			if err != nil {
+				return v, fmt.Errorf("key %s: %w", pair.Key.Inspect(), err)
+			}
+			v.SetMapIndex(kv, ev)
+		}
+
+	case reflect.Struct:
+		switch obj.(type) {
+		case *Map, *Record:
+		default:
+			return v, cannotUse(obj, t)
+		}
+		for _, field := range structFields(t) {
+			value, ok := fieldOf(obj, field.name)
+			if !ok {
+				continue
+			}
+			fv, err := toGoValue(value, field.typ, visiting)
+			if err != nil {
+				return v, fmt.Errorf("field %s: %w", field.name, err)
+			}
+			v.FieldByIndex(field.index).Set(fv)
+		}
+
+	default:
+		return v, fmt.Errorf("unsupported type %s", t)
+	}
+
+	return v, nil
+}
+
+// toNaturalGo converts obj to the Go type a decoder would pick for an empty
+// interface.
+func toNaturalGo(obj Object, visiting map[Object]bool) (interface{}, error) {
+	if err := oneWay(obj); err != nil {
+		return nil, err
+	}
+
+	var err error
+	if visiting, err = visit(visiting, obj); err != nil {
+		return nil, err
+	}
+	defer delete(visiting, obj)
+
+	switch obj := obj.(type) {
+	case *Null:
+		return nil, nil
+	case *Bool:
+		return obj.Value, nil
+	case *Int:
+		return obj.Value, nil
+	case *Float:
+		return obj.Value, nil
+	case *String:
+		return obj.Value, nil
+	case *Error:
+		return errors.New(obj.Msg), nil
+	case *Array:
+		elems := make([]interface{}, len(obj.Elems))
+		for i, elem := range obj.Elems {
+			natural, err := toNaturalGo(elem, visiting)
+			if err != nil {
+				return nil, fmt.Errorf("index %d: %w", i, err)
+			}
+			elems[i] = natural
+		}
+		return elems, nil
+	case *Map:
+		m := make(map[string]interface{}, len(obj.Pairs))
+		// Keys of different types, such as 1 and "1", may have the same
+		// string, which would lose one of their values.
+		keys := make(map[string]Object, len(obj.Pairs))
+		for _, pair := range obj.SortedPairs() {
+			switch pair.Key.(type) {
+			case *String, *Int, *Bool:
+			default:
+				return nil, fmt.Errorf("cannot convert map key of type %s to string", pair.Key.Type())
+			}
+			key := pair.Key.Inspect()
+			if other, ok := keys[key]; ok {
+				return nil, fmt.Errorf("map keys of type %s and %s both convert to %q", other.Type(), pair.Key.Type(), key)
+			}
+			keys[key] = pair.Key
+
+			natural, err := toNaturalGo(pair.Value, visiting)
+			if err != nil {
+				return nil, fmt.Errorf("key %s: %w", key, err)
+			}
+			m[key] = natural
+		}
+		return m, nil
+	case *Record:
+		return naturalFields(obj.RecordType.Fields, obj.Values, visiting)
+	case *EnumValue:
+		name := obj.Variant.Enum.Name + "." + obj.Variant.Name
+		if obj.Variant.Fields == nil {
+			return name, nil
+		}
+		fields, err := naturalFields(obj.Variant.Fields, obj.Values, visiting)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{name: fields}, nil
+	}
+
+	return nil, fmt.Errorf("cannot convert %s to Go: it has no natural Go type", obj.Type())
+}
+
+// naturalFields converts the fields of a Record or enum value, named names,
+// to a map for toNaturalGo.
+func naturalFields(names []string, values []Object, visiting map[Object]bool) (map[string]interface{}, error) {
+	m := make(map[string]interface{}, len(names))
+	for i, name := range names {
+		natural, err := toNaturalGo(values[i], visiting)
+		if err != nil {
+			return nil, fmt.Errorf("field %s: %w", name, err)
+		}
+		m[name] = natural
+	}
+	return m, nil
+}
+
+// oneWay returns an error if obj is a function or namespace, which ToGo
+// cannot convert.
+func oneWay(obj Object) error {
+	switch obj.(type) {
+	case *Fun, *Builtin, *Namespace:
+		return fmt.Errorf("cannot convert %s to Go: functions and namespaces only convert from Go", obj.Type())
+	}
+	return nil
+}
+
+// visit adds obj, an Array, Map, Record or enum value whose elements are
+// about to be converted, to visiting, failing if it is already there because
+// obj contains itself. Other values are not added.
+func visit(visiting map[Object]bool, obj Object) (map[Object]bool, error) {
+	switch obj.(type) {
+	case *Array, *Map, *Record, *EnumValue:
+	default:
+		return visiting, nil
+	}
+	if visiting[obj] {
+		return visiting, fmt.Errorf("cannot convert cyclic %s", obj.Type())
+	}
+	if visiting == nil {
+		visiting = make(map[Object]bool)
+	}
+	visiting[obj] = true
+	return visiting, nil
+}
+
+type structField struct {
+	name  string
+	index []int
+	typ   reflect.Type
+}
+
+// structFields returns the exported fields of t, named by their mash tag if
+// present.
+func structFields(t reflect.Type) []structField {
+	var fields []structField
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+
+		name := f.Name
+		if tag, ok := f.Tag.Lookup("mash"); ok {
+			tag = strings.Split(tag, ",")[0]
+			if tag == "-" {
+				continue
+			}
+			if tag != "" {
+				name = tag
+			}
+		}
+
+		fields = append(fields, structField{name: name, index: f.Index, typ: f.Type})
+	}
+
+	return fields
+}
+
+func isNilValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface, reflect.Map, reflect.Slice, reflect.Func, reflect.Chan:
+		return v.IsNil()
+	}
+	return false
+}
+
+func cannotUse(obj Object, t reflect.Type) error {
+	return fmt.Errorf("cannot use %s as %s", obj.Type(), t)
+}
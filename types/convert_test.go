@@ -0,0 +1,288 @@
+package types
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type point struct {
+	X    int64   `mash:"x"`
+	Y    float64 `mash:"y"`
+	Name string
+	Tags []string
+	Skip string `mash:"-"`
+}
+
+type node struct {
+	Value int64
+	Next  *node
+}
+
+func TestRoundTrip(t *testing.T) {
+	tests := []struct {
+		name  string
+		value interface{}
+		typ   ObjType
+	}{
+		{"int", int64(42), INT_OBJ},
+		{"negative int", int64(-7), INT_OBJ},
+		{"small int", int8(3), INT_OBJ},
+		{"uint", uint16(65535), INT_OBJ},
+		{"float", 2.5, FLOAT_OBJ},
+		{"string", "mash", STRING_OBJ},
+		{"empty string", "", STRING_OBJ},
+		{"bool", true, BOOL_OBJ},
+		{"null", (*int64)(nil), NULL_OBJ},
+		{"array", []int64{1, 2, 3}, ARRAY_OBJ},
+		{"fixed array", [2]string{"a", "b"}, ARRAY_OBJ},
+		{"nested array", [][]bool{{true}, {false, true}}, ARRAY_OBJ},
+		{"map", map[string]int64{"a": 1, "b": 2}, MAP_OBJ},
+		{"nested map", map[string][]float64{"xs": {1.5, 2}}, MAP_OBJ},
+		{"struct", point{X: 1, Y: 2.5, Name: "p", Tags: []string{"t"}}, MAP_OBJ},
+		{"recursive struct", node{Value: 1, Next: &node{Value: 2}}, MAP_OBJ},
+		{"pointer", &point{X: 3}, MAP_OBJ},
+		{"time", time.Date(2024, 1, 10, 9, 30, 0, 0, time.UTC), STRING_OBJ},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			obj, err := FromGo(tt.value)
+			if err != nil {
+				t.Fatalf("FromGo(%#v): %v", tt.value, err)
+			}
+			if obj.Type() != tt.typ {
+				t.Fatalf("FromGo(%#v) = %s, want %s", tt.value, obj.Type(), tt.typ)
+			}
+
+			target := reflect.New(reflect.TypeOf(tt.value))
+			if err := ToGo(obj, target.Interface()); err != nil {
+				t.Fatalf("ToGo(%s): %v", obj.Inspect(), err)
+			}
+			if got := target.Elem().Interface(); !reflect.DeepEqual(got, tt.value) {
+				t.Errorf("round trip of %#v = %#v", tt.value, got)
+			}
+		})
+	}
+}
+
+func TestToGoInterface(t *testing.T) {
+	tests := []struct {
+		name string
+		obj  Object
+		want interface{}
+	}{
+		{"int", &Int{Value: 1}, int64(1)},
+		{"float", &Float{Value: 1.5}, 1.5},
+		{"string", &String{Value: "s"}, "s"},
+		{"bool", FALSE, false},
+		{"null", NULL, nil},
+		{"array", &Array{Elems: []Object{&Int{Value: 1}, NULL}}, []interface{}{int64(1), nil}},
+		{"map", mapOf("k", &String{Value: "v"}), map[string]interface{}{"k": "v"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got interface{}
+			if err := ToGo(tt.obj, &got); err != nil {
+				t.Fatalf("ToGo(%s): %v", tt.obj.Inspect(), err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ToGo(%s) = %#v, want %#v", tt.obj.Inspect(), got, tt.want)
+			}
+		})
+	}
+}
+
+func TestToGoInterfaceFails(t *testing.T) {
+	collision := mapOf("1", TRUE)
+	collision.Set(&Int{Value: 1}, FALSE)
+
+	tests := []struct {
+		name string
+		obj  Object
+		want string
+	}{
+		{"colliding keys", collision, `map keys of type INT and STRING both convert to "1"`},
+		{"regex", &Regex{Pattern: "a"}, "cannot convert REGEX to Go: it has no natural Go type"},
+		{"nested", mapOf("k", &Array{Elems: []Object{&Regex{}}}), "key k: index 0: cannot convert REGEX to Go: it has no natural Go type"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got interface{}
+			if err := ToGo(tt.obj, &got); err == nil || err.Error() != tt.want {
+				t.Errorf("ToGo(%s) = %#v, %v, want the error %q", tt.obj.Inspect(), got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestToGoRecordsAndEnums(t *testing.T) {
+	const decls = "record Point { x, y }\nenum Shape { Circle(r), Empty }\n"
+	tests := []struct {
+		src  string
+		want interface{}
+	}{
+		{`Point(1, 2.5)`, map[string]interface{}{"x": int64(1), "y": 2.5}},
+		{`Shape.Empty`, "Shape.Empty"},
+		{`Shape.Circle(2)`, map[string]interface{}{"Shape.Circle": map[string]interface{}{"r": int64(2)}}},
+		{`[Shape.Circle(Point(0, 0))]`, []interface{}{map[string]interface{}{"Shape.Circle": map[string]interface{}{"r": map[string]interface{}{"x": int64(0), "y": int64(0)}}}}},
+	}
+	for _, tt := range tests {
+		obj := evalSource(t, decls+tt.src, NewEnv())
+		var got interface{}
+		if err := ToGo(obj, &got); err != nil {
+			t.Fatalf("ToGo(%s): %v", tt.src, err)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ToGo(%s) = %#v, want %#v", tt.src, got, tt.want)
+		}
+	}
+
+	// Struct targets take the fields of Records like the keys of Maps.
+	obj := evalSource(t, decls+`Point(3, 4)`, NewEnv())
+	var p point
+	if err := ToGo(obj, &p); err != nil {
+		t.Fatalf("ToGo(Point(3, 4)): %v", err)
+	}
+	if want := (point{X: 3, Y: 4}); !reflect.DeepEqual(p, want) {
+		t.Errorf("ToGo(Point(3, 4)) = %#v, want %#v", p, want)
+	}
+}
+
+func TestFromGoUnwrappableFunc(t *testing.T) {
+	obj, err := FromGo(func(ch chan int) {})
+	if err == nil || obj != nil {
+		t.Errorf("FromGo(func(chan int)) = %#v, %v, want a nil Object and an error", obj, err)
+	}
+}
+
+func TestRoundTripError(t *testing.T) {
+	obj, err := FromGo(errors.New("boom"))
+	if err != nil {
+		t.Fatalf("FromGo: %v", err)
+	}
+	if obj.Type() != ERROR_OBJ {
+		t.Fatalf("FromGo(error) = %s, want ERROR", obj.Type())
+	}
+
+	var got error
+	if err := ToGo(obj, &got); err != nil {
+		t.Fatalf("ToGo(%s): %v", obj.Inspect(), err)
+	}
+	if got == nil || got.Error() != "boom" {
+		t.Errorf("round trip of error boom = %v", got)
+	}
+}
+
+func TestToGoNilObject(t *testing.T) {
+	var obj Object = TRUE
+	if err := ToGo(nil, &obj); err != nil {
+		t.Fatalf("ToGo(nil, *Object): %v", err)
+	}
+	if obj != NULL {
+		t.Errorf("ToGo(nil, *Object) = %v, want null", obj)
+	}
+
+	p := new(int64)
+	if err := ToGo(nil, &p); err != nil {
+		t.Fatalf("ToGo(nil, **int64): %v", err)
+	}
+	if p != nil {
+		t.Errorf("ToGo(nil, **int64) = %v, want nil", p)
+	}
+}
+
+func TestCyclicValues(t *testing.T) {
+	n := &node{Value: 1}
+	n.Next = n
+	if _, err := FromGo(n); err == nil {
+		t.Error("FromGo of a cyclic pointer succeeded")
+	}
+
+	m := map[string]interface{}{}
+	m["self"] = m
+	if _, err := FromGo(m); err == nil {
+		t.Error("FromGo of a cyclic map succeeded")
+	}
+
+	arr := &Array{Elems: []Object{NULL}}
+	arr.Elems[0] = arr
+	var got interface{}
+	if err := ToGo(arr, &got); err == nil {
+		t.Error("ToGo of a cyclic ARRAY succeeded")
+	}
+
+	shared := &node{Value: 2}
+	if _, err := FromGo([]*node{shared, shared}); err != nil {
+		t.Errorf("FromGo of a shared pointer: %v", err)
+	}
+}
+
+func TestWrapRecursiveType(t *testing.T) {
+	length := func(n *node) int64 {
+		var count int64
+		for ; n != nil; n = n.Next {
+			count++
+		}
+		return count
+	}
+
+	builtin, err := WrapFunc("length", length)
+	if err != nil {
+		t.Fatalf("WrapFunc: %v", err)
+	}
+
+	arg, err := FromGo(&node{Value: 1, Next: &node{Value: 2}})
+	if err != nil {
+		t.Fatalf("FromGo: %v", err)
+	}
+	result := builtin.Fun(context.Background(), NewEnv(), arg)
+	if got, ok := result.(*Int); !ok || got.Value != 2 {
+		t.Errorf("length(%s) = %s, want 2", arg.Inspect(), result.Inspect())
+	}
+}
+
+func TestToGoOneWay(t *testing.T) {
+	builtin, err := FromGo(func(s string) string { return s })
+	if err != nil {
+		t.Fatalf("FromGo(func): %v", err)
+	}
+	if builtin.Type() != BUILTIN_OBJ {
+		t.Fatalf("FromGo(func) = %s, want BUILTIN", builtin.Type())
+	}
+
+	objs := []Object{
+		builtin,
+		&Fun{Env: NewEnv()},
+		&Namespace{Name: "ns", Members: map[string]Object{}},
+	}
+	for _, obj := range objs {
+		var natural interface{}
+		if err := ToGo(obj, &natural); err == nil {
+			t.Errorf("ToGo(%s, *interface{}) succeeded", obj.Type())
+		}
+		var fn func(string) string
+		if err := ToGo(obj, &fn); err == nil {
+			t.Errorf("ToGo(%s, *func) succeeded", obj.Type())
+		}
+		var elems []interface{}
+		if err := ToGo(&Array{Elems: []Object{obj}}, &elems); err == nil {
+			t.Errorf("ToGo([%s], *[]interface{}) succeeded", obj.Type())
+		}
+
+		var unconverted Object
+		if err := ToGo(obj, &unconverted); err != nil || unconverted != obj {
+			t.Errorf("ToGo(%s, *Object) = %v, %v, want it unconverted", obj.Type(), unconverted, err)
+		}
+	}
+}
+
+func mapOf(key string, value Object) *Map {
+	m := NewMap()
+	m.Set(&String{Value: key}, value)
+	return m
+}
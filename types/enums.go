@@ -0,0 +1,188 @@
+package types
+
+import (
+	"context"
+
+	"github.com/gramidt/mash-lang-for-codemash/ast"
+)
+
+// An Enum is declared by enum Name { variants }. Its variants are selected
+// with Name.Variant, and are also declared by their own names.
+type Enum struct {
+	Name     string
+	Variants []*Variant
+}
+
+func (e *Enum) Type() ObjType   { return ENUM_OBJ }
+func (e *Enum) Inspect() string { return "<enum " + e.Name + ">" }
+func (e *Enum) IsTruthy() bool  { return true }
+
+// variant returns the variant called name.
+func (e *Enum) variant(name string) (*Variant, bool) {
+	for _, v := range e.Variants {
+		if v.Name == name {
+			return v, true
+		}
+	}
+	return nil, false
+}
+
+// A Variant is one of the alternatives of an Enum. A variant declared with
+// fields, such as Circle(r), is a constructor called with one argument per
+// field. A variant declared without is a single EnumValue, see value.
+type Variant struct {
+	Enum   *Enum
+	Name   string
+	Fields []string // nil if the variant has no fields
+	unit   *EnumValue
+}
+
+func (v *Variant) Type() ObjType   { return VARIANT_OBJ }
+func (v *Variant) Inspect() string { return "<variant " + v.Enum.Name + "." + v.Name + ">" }
+func (v *Variant) IsTruthy() bool  { return true }
+
+// value returns what the name of v refers to: v itself for a constructor,
+// or its only EnumValue for a variant without fields.
+func (v *Variant) value() Object {
+	if v.unit != nil {
+		return v.unit
+	}
+	return v
+}
+
+// An EnumValue is an immutable value of one Variant of an Enum. Like
+// Records, EnumValues are equal when they have the same variant and equal
+// fields.
+type EnumValue struct {
+	Variant *Variant
+	Values  []Object // in the order of Variant.Fields
+}
+
+func (ev *EnumValue) Type() ObjType   { return ENUM_VALUE_OBJ }
+func (ev *EnumValue) Inspect() string { return inspect(ev) }
+func (ev *EnumValue) parts() ([]string, []Object) {
+	name := ev.Variant.Enum.Name + "." + ev.Variant.Name
+	if ev.Variant.Fields == nil {
+		return []string{name}, nil
+	}
+	return listParts(name+"(", ev.Values, ")"), ev.Values
+}
+func (ev *EnumValue) IsTruthy() bool { return true }
+
+// Get returns the field called name, if there is one.
+func (ev *EnumValue) Get(name string) (Object, bool) {
+	for i, field := range ev.Variant.Fields {
+		if field == name {
+			return ev.Values[i], true
+		}
+	}
+	return nil, false
+}
+
+func evalEnumStmt(node *ast.EnumStmt, env *Env) Object {
+	enum := &Enum{Name: node.Name.Value, Variants: make([]*Variant, len(node.Variants))}
+	for i, decl := range node.Variants {
+		v := &Variant{Enum: enum, Name: decl.Name.Value}
+		if decl.Fields == nil {
+			v.unit = &EnumValue{Variant: v}
+		} else {
+			v.Fields = make([]string, len(decl.Fields))
+			for j, field := range decl.Fields {
+				v.Fields[j] = field.Value
+			}
+		}
+		enum.Variants[i] = v
+	}
+
+	if err := env.rt.alloc(objectSize * int64(1+len(enum.Variants))); err != nil {
+		return err
+	}
+	if result := env.Set(enum.Name, enum); isError(result) {
+		return result
+	}
+	for _, v := range enum.Variants {
+		if result := env.Set(v.Name, v.value()); isError(result) {
+			return result
+		}
+	}
+	return nil
+}
+
+// newEnumValue constructs an EnumValue of v from one argument per field.
+func newEnumValue(v *Variant, args []Object, env *Env) Object {
+	if len(args) != len(v.Fields) {
+		return newError("wrong number of arguments to %s.%s: want %d, got %d", v.Enum.Name, v.Name, len(v.Fields), len(args))
+	}
+	return env.rt.track(&EnumValue{Variant: v, Values: append([]Object{}, args...)})
+}
+
+// selectEnum returns the variant of enum called name.
+func selectEnum(enum *Enum, name string) Object {
+	if v, ok := enum.variant(name); ok {
+		return v.value()
+	}
+	return newError("enum %s has no variant %s", enum.Name, name)
+}
+
+// matchConstructor reports whether value was built by the constructor named
+// by pattern, with fields matching the arguments of pattern. Records match
+// their fields positionally too.
+func matchConstructor(ctx context.Context, pattern *ast.ConstructorPattern, value Object, env *Env) (bool, *Error) {
+	name := pattern.Path[0].Value
+	constructor, ok := env.Get(name)
+	if !ok {
+		return false, newError("unknown constructor in pattern: %s", name)
+	}
+	for _, sel := range pattern.Path[1:] {
+		name += "." + sel.Value
+		switch x := constructor.(type) {
+		case *Enum:
+			constructor = selectEnum(x, sel.Value)
+		case *Namespace:
+			if constructor, ok = x.Get(sel.Value); !ok {
+				return false, newError("unknown constructor in pattern: %s", name)
+			}
+		default:
+			return false, newError("unknown constructor in pattern: %s", name)
+		}
+		if err, ok := constructor.(*Error); ok {
+			return false, err
+		}
+	}
+
+	var fields []Object
+	switch c := constructor.(type) {
+	case *Variant:
+		ev, ok := value.(*EnumValue)
+		if !ok || ev.Variant != c {
+			return false, nil
+		}
+		fields = ev.Values
+	case *RecordType:
+		rec, ok := value.(*Record)
+		if !ok || rec.RecordType != c {
+			return false, nil
+		}
+		fields = rec.Values
+	case *EnumValue:
+		if pattern.Args != nil {
+			return false, newError("variant %s has no fields", name)
+		}
+		return value == c, nil
+	default:
+		return false, newError("%s is not a constructor: %s", name, constructor.Type().String())
+	}
+
+	if pattern.Args == nil {
+		return true, nil
+	}
+	if len(pattern.Args) != len(fields) {
+		return false, newError("wrong number of fields in pattern %s: want %d, got %d", name, len(fields), len(pattern.Args))
+	}
+	for i, arg := range pattern.Args {
+		if ok, err := matchPattern(ctx, arg, fields[i], env); !ok || err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
@@ -0,0 +1,38 @@
+package types
+
+import "testing"
+
+func TestEnums(t *testing.T) {
+	const shape = "enum Shape { Circle(r), Rect(w, h), Empty }\n"
+	runEvalTests(t, []evalTest{
+		{"inspect variant", shape + `Shape.Circle(2)`, "Shape.Circle(2)", ""},
+		{"inspect unit variant", shape + `Shape.Empty`, "Shape.Empty", ""},
+		{"field", shape + `Shape.Rect(2, 3).h`, "3", ""},
+		{"match", shape + `var area = fun(s) {
+	match (s) {
+		Shape.Circle(r) => 3 * r * r,
+		Shape.Rect(w, h) => w * h,
+		Shape.Empty => 0
+	}
+};
+[area(Shape.Circle(2)), area(Shape.Rect(2, 3)), area(Shape.Empty)]`, "[12, 6, 0]", ""},
+		{"guard", shape + `match (Shape.Rect(2, 3)) {
+	Shape.Rect(w, h) if w == h => "square",
+	Shape.Rect(_, _) => "rect"
+}`, "rect", ""},
+		{"nested pattern", shape + `match ([Shape.Circle(1), Shape.Empty]) {
+	[Shape.Circle(r), Shape.Empty] => r
+}`, "1", ""},
+		{"non-enum subject", shape + `match (5) { Shape.Empty => 0, x => x }`, "5", ""},
+		{"equal", shape + `[Shape.Circle(1) == Shape.Circle(1), Shape.Empty == Shape.Empty, Shape.Circle(1) == Shape.Circle(2)]`, "[true, true, false]", ""},
+		{"different enums", `enum A { X }
+enum B { X }
+A.X == B.X`, "false", ""},
+
+		{"no arm", shape + `match (Shape.Circle(1)) { Shape.Empty => 0 }`, "", "no match arm matched Shape.Circle(1)"},
+		{"constructor arity", shape + `Shape.Circle()`, "", "wrong number of arguments to Shape.Circle: want 1, got 0"},
+		{"unknown variant", shape + `Shape.Square`, "", "enum Shape has no variant Square"},
+		{"unknown variant in pattern", shape + `match (Shape.Empty) { Shape.Square(w) => 0, _ => 1 }`, "", "enum Shape has no variant Square"},
+		{"pattern arity", shape + `match (Shape.Rect(1, 2)) { Shape.Rect(w) => 0, _ => 1 }`, "", "wrong number of fields in pattern Shape.Rect: want 2, got 1"},
+	})
+}
@@ -1,30 +1,229 @@
 package types
 
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/gramidt/mash-lang-for-codemash/grammar"
+)
+
+// An Env holds the variables of a scope. It is safe for concurrent use, so
+// that hosts may register builtins while scripts are evaluated in it.
 type Env struct {
-	store map[string]Object
-	outer *Env
+	mu       sync.RWMutex // guards store, consts and builtins
+	store    map[string]Object
+	consts   map[string]bool   // names in store declared with const
+	builtins map[string]Object // registered by the host, see RegisterBuiltin
+	outer    *Env
+	rt       *runtime
+
+	dir     string     // directory of the module, see SetDir
+	exports *Namespace // exports of the module, nil for scripts
 }
 
 func (e *Env) Get(name string) (Object, bool) {
+	e.mu.RLock()
 	obj, ok := e.store[name]
+	if !ok {
+		obj, ok = e.builtins[name]
+	}
+	e.mu.RUnlock()
 	if !ok && e.outer != nil {
 		obj, ok = e.outer.Get(name)
 	}
+	// Modules see the builtins the host registered in the Env of NewEnv.
+	if !ok && e.exports != nil {
+		root := e.rt.root
+		root.mu.RLock()
+		obj, ok = root.builtins[name]
+		root.mu.RUnlock()
+	}
 	return obj, ok
 }
 
+// Set declares name in e with the value val, replacing an earlier variable
+// of the same name. It returns val, or an Error if name is a constant of e.
 func (e *Env) Set(name string, val Object) Object {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.consts[name] {
+		return newError("cannot redeclare constant %s", name)
+	}
 	e.store[name] = val
 	return val
 }
 
-func NewEnv() *Env {
+// SetConst declares name in e as a constant with the value val. Scripts
+// cannot redeclare or assign to it, but enclosed Envs may shadow it.
+// SetConst returns val, or an Error if name is already a constant of e.
+func (e *Env) SetConst(name string, val Object) Object {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.consts[name] {
+		return newError("cannot redeclare constant %s", name)
+	}
+	e.store[name] = val
+	if e.consts == nil {
+		e.consts = make(map[string]bool)
+	}
+	e.consts[name] = true
+	return val
+}
+
+// Assign changes the value of the variable name declared in e or an Env
+// enclosing it. It returns val, or an Error if there is no such variable or
+// it is a constant.
+func (e *Env) Assign(name string, val Object) Object {
+	for env := e; env != nil; env = env.outer {
+		env.mu.Lock()
+		if _, ok := env.store[name]; !ok {
+			env.mu.Unlock()
+			continue
+		}
+		if env.consts[name] {
+			env.mu.Unlock()
+			return newError("cannot assign to constant %s", name)
+		}
+		env.store[name] = val
+		env.mu.Unlock()
+		return val
+	}
+	return newError("cannot assign to undeclared variable %s", name)
+}
+
+func NewEnv(opts ...Option) *Env {
 	store := make(map[string]Object)
-	return &Env{store: store, outer: nil}
+	env := &Env{store: store, outer: nil, rt: newRuntime(opts...)}
+	env.rt.root = env
+	return env
 }
 
 func NewEnclosedEnv(outer *Env) *Env {
-	env := NewEnv()
-	env.outer = outer
-	return env
+	store := make(map[string]Object)
+	return &Env{store: store, outer: outer, rt: outer.rt}
+}
+
+// Stats reports the resources used by the last call of Eval in e or an Env
+// sharing its runtime, so far if it is still running.
+func (e *Env) Stats() Stats {
+	return e.rt.stats()
+}
+
+// RegisterBuiltin makes fn callable from scripts evaluated in e under name,
+// unless they declare a variable of the same name. Builtins registered in
+// the Env returned by NewEnv are callable from imported modules too.
+// A dotted name such as "strings.upper" registers fn as a member of the
+// "strings" Namespace, creating the namespace if it does not exist yet. A
+// namespace created in e keeps the members of the builtin or outer namespace
+// of the same name, such as json, which it hides.
+// An arity of VariadicArity disables argument count checking.
+func (e *Env) RegisterBuiltin(name string, fn BuiltinFun, arity int) error {
+	return e.register(name, &Builtin{Name: name, Fun: fn, Arity: arity})
+}
+
+// RegisterFunc adapts the Go function fn with WrapFunc and registers it
+// under name like RegisterBuiltin.
+func (e *Env) RegisterFunc(name string, fn interface{}) error {
+	builtin, err := WrapFunc(name, fn)
+	if err != nil {
+		return err
+	}
+	return e.register(name, builtin)
+}
+
+func (e *Env) register(name string, obj Object) error {
+	parts := strings.Split(name, ".")
+	for _, part := range parts {
+		if !isIdent(part) {
+			return fmt.Errorf("invalid builtin name %q", name)
+		}
+	}
+
+	last := parts[len(parts)-1]
+	if len(parts) == 1 {
+		e.mu.Lock()
+		e.builtinsMap()[last] = obj
+		e.mu.Unlock()
+		return nil
+	}
+
+	// A namespace created in e extends the one it hides, such as json.
+	var hidden Object
+	if e.outer != nil {
+		hidden, _ = e.outer.Get(parts[0])
+	}
+	if hidden == nil {
+		hidden = builtins[parts[0]]
+	}
+
+	e.mu.Lock()
+	ns, err := namespaceIn(e.builtinsMap(), parts, 0, hidden)
+	e.mu.Unlock()
+	for i := 1; err == nil && i < len(parts)-1; i++ {
+		parent := ns
+		parent.mu.Lock()
+		ns, err = namespaceIn(parent.Members, parts, i, nil)
+		parent.mu.Unlock()
+	}
+	if err != nil {
+		return err
+	}
+
+	ns.set(last, obj)
+	return nil
+}
+
+// builtinsMap returns the builtins registered in e, creating the map on
+// first use. e.mu must be held.
+func (e *Env) builtinsMap() map[string]Object {
+	if e.builtins == nil {
+		e.builtins = make(map[string]Object)
+	}
+	return e.builtins
+}
+
+// namespaceIn returns the Namespace called parts[i] in members, the members
+// of the Namespace of the parts before it. If there is none it is created,
+// with the members of hidden, the object of the same name it hides, if that
+// is a Namespace.
+func namespaceIn(members map[string]Object, parts []string, i int, hidden Object) (*Namespace, error) {
+	existing, ok := members[parts[i]]
+	if !ok {
+		existing = hidden
+	}
+	base, isNamespace := existing.(*Namespace)
+	if existing != nil && !isNamespace {
+		name := strings.Join(parts, ".")
+		return nil, fmt.Errorf("cannot register %q: %s is a %s, not a namespace", name, parts[i], existing.Type())
+	}
+	if ok {
+		return base, nil
+	}
+
+	ns := &Namespace{
+		Name:    strings.Join(parts[:i+1], "."),
+		Members: make(map[string]Object),
+	}
+	if base != nil {
+		base.mu.RLock()
+		for name, member := range base.Members {
+			ns.Members[name] = member
+		}
+		base.mu.RUnlock()
+	}
+	members[parts[i]] = ns
+	return ns, nil
+}
+
+func isIdent(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, ch := range name {
+		if !('a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || ch == '_') {
+			return false
+		}
+	}
+	return grammar.Lookup(name) == grammar.IDENT
 }
@@ -0,0 +1,205 @@
+package types
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestRegisterBuiltin(t *testing.T) {
+	env := NewEnv()
+	upper := func(ctx context.Context, env *Env, args ...Object) Object {
+		return &String{Value: strings.ToUpper(args[0].(*String).Value)}
+	}
+	lower := func(ctx context.Context, env *Env, args ...Object) Object {
+		return &String{Value: strings.ToLower(args[0].(*String).Value)}
+	}
+	if err := env.RegisterBuiltin("shout", upper, 1); err != nil {
+		t.Fatalf("RegisterBuiltin(shout): %v", err)
+	}
+	if err := env.RegisterBuiltin("text.upper", upper, 1); err != nil {
+		t.Fatalf("RegisterBuiltin(text.upper): %v", err)
+	}
+	if err := env.RegisterBuiltin("text.lower", lower, 1); err != nil {
+		t.Fatalf("RegisterBuiltin(text.lower): %v", err)
+	}
+
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{`shout("a")`, "A"},
+		{`text.upper("a")`, "A"},
+		{`text.lower("B")`, "b"},
+		{`text.missing("a")`, "ERROR: invalid selector: text.missing"},
+		{`shout.upper("a")`, "ERROR: invalid selector: BUILTIN has no method upper"},
+		{`shout("a", "b")`, "ERROR: wrong number of arguments to shout: want 1, got 2"},
+		// Variables hide builtins of the same name.
+		{`var shout = 1; shout`, "1"},
+	}
+	for _, tt := range tests {
+		if got := evalSource(t, tt.src, env).Inspect(); got != tt.want {
+			t.Errorf("%s = %s, want %s", tt.src, got, tt.want)
+		}
+	}
+
+	// Each Env has builtins of its own.
+	if got := evalSource(t, `shout("a")`, NewEnv()); !isError(got) {
+		t.Errorf("shout in a new Env = %s, want an error", got.Inspect())
+	}
+}
+
+func TestRegisterBuiltinExtendsNamespace(t *testing.T) {
+	env := NewEnv()
+	fn := func(ctx context.Context, env *Env, args ...Object) Object { return TRUE }
+	if err := env.RegisterBuiltin("json.valid", fn, 1); err != nil {
+		t.Fatalf("RegisterBuiltin(json.valid): %v", err)
+	}
+	inner := NewEnclosedEnv(env)
+	if err := inner.RegisterBuiltin("json.strict", fn, 1); err != nil {
+		t.Fatalf("RegisterBuiltin(json.strict): %v", err)
+	}
+
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{`json.valid("1")`, "true"},
+		{`json.strict("1")`, "true"},
+		{`json.stringify(json.parse("[1]"))`, "[1]"},
+	}
+	for _, tt := range tests {
+		if got := evalSource(t, tt.src, inner).Inspect(); got != tt.want {
+			t.Errorf("%s = %s, want %s", tt.src, got, tt.want)
+		}
+	}
+}
+
+func TestRegisterBuiltinWhileRunning(t *testing.T) {
+	env := NewEnv()
+	fn := func(ctx context.Context, env *Env, args ...Object) Object { return TRUE }
+	if err := env.RegisterBuiltin("text.a", fn, 0); err != nil {
+		t.Fatalf("RegisterBuiltin(text.a): %v", err)
+	}
+
+	// Registering members of a namespace while a script reads it must not
+	// race, see go test -race.
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 200; i++ {
+			if err := env.RegisterBuiltin("text."+strings.Repeat("f", i+1), fn, 0); err != nil {
+				t.Errorf("RegisterBuiltin: %v", err)
+			}
+		}
+	}()
+	src := `for (i in range(20000)) { text.a() }
+text.a()`
+	if result := evalSource(t, src, NewEnclosedEnv(env)); result != TRUE {
+		t.Errorf("Eval = %s, want true", result.Inspect())
+	}
+	<-done
+}
+
+func TestRegisterBuiltinFails(t *testing.T) {
+	env := NewEnv()
+	fn := func(ctx context.Context, env *Env, args ...Object) Object { return NULL }
+	if err := env.RegisterBuiltin("taken", fn, 0); err != nil {
+		t.Fatalf("RegisterBuiltin(taken): %v", err)
+	}
+
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"", `invalid builtin name ""`},
+		{"a..b", `invalid builtin name "a..b"`},
+		{"if", `invalid builtin name "if"`},
+		{"kebab-case", `invalid builtin name "kebab-case"`},
+		{"taken.member", `cannot register "taken.member": taken is a BUILTIN, not a namespace`},
+	}
+	for _, tt := range tests {
+		if err := env.RegisterBuiltin(tt.name, fn, 0); err == nil || err.Error() != tt.want {
+			t.Errorf("RegisterBuiltin(%q) = %v, want the error %q", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestRegisterFunc(t *testing.T) {
+	env := NewEnv()
+	greet := func(name string, formal bool) (string, error) {
+		if name == "" {
+			return "", errors.New("empty name")
+		}
+		if formal {
+			return "Good day, " + name, nil
+		}
+		return "Hi " + name, nil
+	}
+	if err := env.RegisterFunc("greet", greet); err != nil {
+		t.Fatalf("RegisterFunc: %v", err)
+	}
+	if err := env.RegisterFunc("join", func(parts ...string) string { return strings.Join(parts, "+") }); err != nil {
+		t.Fatalf("RegisterFunc: %v", err)
+	}
+	if err := env.RegisterFunc("check", func(ok bool) error {
+		if !ok {
+			return errors.New("not ok")
+		}
+		return nil
+	}); err != nil {
+		t.Fatalf("RegisterFunc: %v", err)
+	}
+
+	if err := env.RegisterFunc("explode", func() { panic("boom") }); err != nil {
+		t.Fatalf("RegisterFunc: %v", err)
+	}
+
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{`greet("Ann", false)`, "Hi Ann"},
+		{`greet("Ann", true)`, "Good day, Ann"},
+		{`join("a", "b", "c")`, "a+b+c"},
+		{`join()`, ""},
+		{`check(true)`, "null"},
+		{`greet("", false)`, "ERROR: greet: empty name"},
+		{`check(false)`, "ERROR: check: not ok"},
+		{`explode()`, "ERROR: explode panicked: boom"},
+		{`greet(true, false)`, "ERROR: argument 1 to greet: cannot use BOOL as string"},
+		{`greet("Ann")`, "ERROR: wrong number of arguments to greet: want 2, got 1"},
+	}
+	for _, tt := range tests {
+		if got := evalSource(t, tt.src, env).Inspect(); got != tt.want {
+			t.Errorf("%s = %s, want %s", tt.src, got, tt.want)
+		}
+	}
+}
+
+func TestWrapFuncFails(t *testing.T) {
+	var nilFunc func(string) string
+	tests := []struct {
+		name string
+		fn   interface{}
+		want string
+	}{
+		{"nil", nil, "cannot wrap f: nil is not a function"},
+		{"nil func", nilFunc, "cannot wrap f: nil func(string) string"},
+		{"not a function", "f", "cannot wrap f: string is not a function"},
+		{"parameter", func(ch chan int) {}, "cannot wrap f: unsupported parameter type chan int"},
+		{"result", func() chan int { return nil }, "cannot wrap f: unsupported result type chan int"},
+		{"results", func() (string, string) { return "", "" }, "cannot wrap f: results must be (T, error)"},
+		{"too many results", func() (string, string, error) { return "", "", nil }, "cannot wrap f: too many results"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			builtin, err := WrapFunc("f", tt.fn)
+			if err == nil || err.Error() != tt.want {
+				t.Errorf("WrapFunc = %v, %v, want the error %q", builtin, err, tt.want)
+			}
+		})
+	}
+}
@@ -1,74 +1,211 @@
 package types
 
 import (
+	"context"
+
 	"github.com/gramidt/mash-lang-for-codemash/ast"
 	"github.com/gramidt/mash-lang-for-codemash/grammar"
 )
 
-func Eval(node ast.Node, env *Env) Object {
+// Eval evaluates node in env. Evaluation stops with a TIMEOUT_ERROR or
+// CANCELED_ERROR once ctx is done, and with a BUDGET_EXCEEDED_ERROR once the
+// step budget of env is spent; both are checked at every function call and
+// loop iteration. Each call starts with the whole budget, and Stats count
+// from its start.
+//
+// Eval may be called from several goroutines: the tasks of a runtime, see
+// spawn, take turns evaluating, so scripts never access values concurrently.
+// Once node is evaluated, Eval runs the event loop until the timers and async
+// calls it started are done, and waits for the tasks it spawned to finish.
+// If a task fails and no task waits for it, or a promise is rejected and
+// nothing awaits it, Eval returns its Error. If evaluation fails, the tasks
+// still running are canceled instead, so that none outlives the call, and so
+// are the async calls still waiting, while the timers left are dropped.
+// Generators left suspended are closed.
+func Eval(ctx context.Context, node ast.Node, env *Env) Object {
+	ctx, leave, outer := env.rt.sched.enter(ctx)
+	defer leave()
+	if !outer {
+		return eval(ctx, node, env)
+	}
+
+	env.rt.reset(env)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	return env.rt.finish(ctx, cancel, eval(ctx, node, env))
+}
+
+// finish completes the outermost Eval returning result: it runs the event
+// loop and joins the spawned tasks until neither has work left, cancels and
+// joins the tasks left and stops the event loop if anything failed, fails
+// once ctx is done or with the Error of a task or promise nothing waited
+// for, closes the generators still suspended and measures the memory left in
+// use.
+func (rt *runtime) finish(ctx context.Context, cancel context.CancelFunc, result Object) Object {
+	for !isError(result) {
+		if err := rt.loop.run(ctx, rt, nil); err != nil {
+			result = err
+		} else if len(rt.sched.tasks) == 0 {
+			break
+		} else if err := rt.sched.waitTask(ctx, rt.sched.tasks[0]); err != nil {
+			result = err
+		}
+	}
+
+	// Async calls may fail with the context, leaving a rejected Promise as
+	// the result instead.
+	if err := ctx.Err(); err != nil && !isError(result) {
+		result = contextError(err)
+	}
+
+	// Tasks are left only if evaluation failed. Once canceled they stop at
+	// their next step or blocking operation.
+	cancel()
+	rt.sched.join(context.Background())
+	rt.loop.stop(contextError(context.Canceled))
+	if err := rt.sched.unwaitedError(); err != nil && !isError(result) {
+		result = err
+	}
+	if err := rt.loop.unhandledRejection(); err != nil && !isError(result) {
+		result = err
+	}
+	rt.closeGenerators()
+	rt.mem.measure(rt)
+	return result
+}
+
+func eval(ctx context.Context, node ast.Node, env *Env) Object {
 	switch node := node.(type) {
 	case *ast.Root:
-		return evalRoot(node, env)
+		return evalRoot(ctx, node, env)
 
 	case *ast.ExprStmt:
-		return Eval(node.Expr, env)
+		return eval(ctx, node.Expr, env)
 
 	case *ast.BlockStmt:
-		return evalBlockStmt(node, env)
+		return evalBlockStmt(ctx, node, env)
 
 	case *ast.IfStmt:
-		return evalIfStmt(node, env)
+		return evalIfStmt(ctx, node, env)
+
+	case *ast.MatchExpr:
+		return evalMatchExpr(ctx, node, env)
 
 	case *ast.Ident:
-		return evalIdent(node, env)
+		return evalIdent(ctx, node, env)
 
 	case *ast.VarStmt:
-		return evalVarStmt(node, env)
+		return evalVarStmt(ctx, node, env)
+
+	case *ast.AssignStmt:
+		return evalAssignStmt(ctx, node, env)
+
+	case *ast.RecordStmt:
+		return evalRecordStmt(node, env)
+
+	case *ast.ClassStmt:
+		return evalClassStmt(node, env)
+
+	case *ast.EnumStmt:
+		return evalEnumStmt(node, env)
+
+	case *ast.ForStmt:
+		return evalForStmt(ctx, node, env)
+
+	case *ast.YieldExpr:
+		return evalYieldExpr(ctx, node, env)
+
+	case *ast.AwaitExpr:
+		return evalAwaitExpr(ctx, node, env)
+
+	case *ast.SpawnExpr:
+		return evalSpawnExpr(ctx, node, env)
+
+	case *ast.SelectExpr:
+		return evalSelectExpr(ctx, node, env)
+
+	case *ast.WithExpr:
+		return evalWithExpr(ctx, node, env)
+
+	case *ast.ImportStmt:
+		return evalImportStmt(ctx, node, env)
+
+	case *ast.ExportStmt:
+		return evalExportStmt(ctx, node, env)
 
 	case *ast.BoolLit:
 		return evalBoolLit(node)
 
+	case *ast.NullLit:
+		return NULL
+
+	case *ast.IntLit:
+		return evalIntLit(node)
+
+	case *ast.FloatLit:
+		return evalFloatLit(node)
+
 	case *ast.StringLit:
-		return evalStringLit(node)
+		return evalStringLit(node, env)
+
+	case *ast.RegexLit:
+		return evalRegexLit(node, env)
+
+	case *ast.ArrayLit:
+		return evalArrayLit(ctx, node, env)
+
+	case *ast.MapLit:
+		return evalMapLit(ctx, node, env)
 
 	case *ast.FunLit:
 		return evalFunLit(node, env)
 
 	case *ast.CallExpr:
-		return evalCallExpr(node, env)
+		return evalCallExpr(ctx, node, env)
+
+	case *ast.SelectorExpr:
+		return evalSelectorExpr(ctx, node, env)
+
+	case *ast.IndexExpr:
+		return evalIndexExpr(ctx, node, env)
+
+	case *ast.UnaryExpr:
+		return evalUnaryExpr(ctx, node, env)
 
 	case *ast.BinaryExpr:
-		return evalBinaryExpr(node, env)
+		return evalBinaryExpr(ctx, node, env)
 	}
 
 	return nil
 }
 
-func evalRoot(root *ast.Root, env *Env) Object {
+func evalRoot(ctx context.Context, root *ast.Root, env *Env) Object {
 	var result Object
 
 	for _, stmt := range root.Stmts {
-		result = Eval(stmt, env)
+		result = eval(ctx, stmt, env)
 
 		switch result := result.(type) {
 		case *ReturnValue:
 			return result.Value
+		case *Error:
+			return result
 		}
 	}
 
 	return result
 }
 
-func evalBlockStmt(block *ast.BlockStmt, env *Env) Object {
+func evalBlockStmt(ctx context.Context, block *ast.BlockStmt, env *Env) Object {
 	var result Object
 
 	for _, stmt := range block.List {
-		result = Eval(stmt, env)
+		result = eval(ctx, stmt, env)
 
 		if result != nil {
 			rt := result.Type()
 
-			if rt == RETURN_VALUE_OBJ {
+			if rt == RETURN_VALUE_OBJ || rt == ERROR_OBJ {
 				return result
 			}
 		}
@@ -77,7 +214,7 @@ func evalBlockStmt(block *ast.BlockStmt, env *Env) Object {
 	return result
 }
 
-func evalIdent(node *ast.Ident, env *Env) Object {
+func evalIdent(ctx context.Context, node *ast.Ident, env *Env) Object {
 	if val, ok := env.Get(node.Value); ok {
 		return val
 	}
@@ -86,31 +223,171 @@ func evalIdent(node *ast.Ident, env *Env) Object {
 		return builtin
 	}
 
+	if val, ok := env.rt.lookupPrelude(ctx, node.Value); ok {
+		return val
+	}
+
 	return newError("invalid identifier: " + node.Value)
 }
 
-func evalVarStmt(node *ast.VarStmt, env *Env) Object {
-	val := Eval(node.Value, env)
+func evalVarStmt(ctx context.Context, node *ast.VarStmt, env *Env) Object {
+	val := eval(ctx, node.Value, env)
 	if isError(val) {
 		return val
 	}
-	env.Set(node.Name.Value, val)
+
+	if val == nil {
+		val = NULL
+	}
+
+	if node.Token.Type != grammar.CONST {
+		if node.Pattern != nil {
+			if err := bindPattern(ctx, node.Pattern, val, env); err != nil {
+				return err
+			}
+			return nil
+		}
+		if result := env.Set(node.Name.Value, val); isError(result) {
+			return result
+		}
+		return nil
+	}
+
+	if node.Pattern == nil {
+		if result := env.SetConst(node.Name.Value, val); isError(result) {
+			return result
+		}
+		return nil
+	}
+
+	// Bind the pattern in a scratch Env, then declare what it bound as
+	// constants.
+	scratch := NewEnclosedEnv(env)
+	if err := bindPattern(ctx, node.Pattern, val, scratch); err != nil {
+		return err
+	}
+	for _, name := range patternNames(node.Pattern) {
+		if result := env.SetConst(name, scratch.store[name]); isError(result) {
+			return result
+		}
+	}
 	return nil
 }
 
-func evalIfStmt(node *ast.IfStmt, env *Env) Object {
-	cond := Eval(node.Cond, env)
+// evalAssignStmt assigns to a variable declared with var, an element of an
+// Array or Map, or a field of a Map.
+func evalAssignStmt(ctx context.Context, node *ast.AssignStmt, env *Env) Object {
+	val := eval(ctx, node.Value, env)
+	if isError(val) {
+		return val
+	}
+	if val == nil {
+		val = NULL
+	}
+
+	switch target := node.Target.(type) {
+	case *ast.Ident:
+		if result := env.Assign(target.Value, val); isError(result) {
+			return result
+		}
+		return nil
+
+	case *ast.IndexExpr:
+		x := eval(ctx, target.X, env)
+		if isError(x) {
+			return x
+		}
+		index := eval(ctx, target.Index, env)
+		if isError(index) {
+			return index
+		}
+		return setElem(ctx, x, index, val, env)
+
+	case *ast.SelectorExpr:
+		x := eval(ctx, target.X, env)
+		if isError(x) {
+			return x
+		}
+		if inst, ok := x.(*Instance); ok {
+			return setField(inst, target.Sel.Value, val, env)
+		}
+		if rec, ok := x.(*Record); ok {
+			return newError("cannot assign to field %s of record %s, records are immutable; use with to copy it", target.Sel.Value, rec.RecordType.Name)
+		}
+		if _, ok := x.(*Map); !ok {
+			return newError("cannot assign to field %s of %s", target.Sel.Value, x.Type().String())
+		}
+		return setElem(ctx, x, &String{Value: target.Sel.Value}, val, env)
+	}
+
+	return newError("invalid assignment target")
+}
+
+// setElem stores val at index of the Array or Map x.
+func setElem(ctx context.Context, x, index, val Object, env *Env) Object {
+	switch x := x.(type) {
+	case *Array:
+		if x.Frozen {
+			return newError("cannot modify frozen ARRAY")
+		}
+		i, ok := index.(*Int)
+		if !ok {
+			return newError("invalid array index: %s", index.Type().String())
+		}
+		if i.Value < 0 || i.Value >= int64(len(x.Elems)) {
+			return newError("array index out of range: %d", i.Value)
+		}
+		x.Elems[i.Value] = val
+		return nil
+
+	case *Map:
+		if x.Frozen {
+			return newError("cannot modify frozen MAP")
+		}
+		key, ok := index.(Hashable)
+		if !ok {
+			return newError("invalid map key: %s", index.Type().String())
+		}
+		if _, ok := x.Get(key); !ok {
+			if err := env.rt.alloc(mapPairSize); err != nil {
+				return err
+			}
+		}
+		x.Set(key, val)
+		return nil
+
+	case *Instance:
+		if result, ok := callHook(ctx, env, x, setIndexHook, index, val); ok {
+			if isError(result) {
+				return result
+			}
+			return nil
+		}
+	}
+
+	return newError("invalid operation: cannot assign to an element of %s", x.Type().String())
+}
+
+// evalIfStmt evaluates the branch chosen by the condition of an if. Its
+// value is that of the last statement of the branch, or null if no branch
+// is taken, the branch is empty or it ends with a declaration.
+func evalIfStmt(ctx context.Context, node *ast.IfStmt, env *Env) Object {
+	cond := eval(ctx, node.Cond, env)
 	if isError(cond) {
 		return cond
 	}
 
+	var result Object
 	if cond.IsTruthy() {
-		return Eval(node.Body, env)
+		result = eval(ctx, node.Body, env)
 	} else if node.Else != nil {
-		return Eval(node.Else, env)
+		result = eval(ctx, node.Else, env)
 	}
 
-	return NULL
+	if result == nil {
+		return NULL
+	}
+	return result
 }
 
 func evalBoolLit(node *ast.BoolLit) *Bool {
@@ -120,19 +397,67 @@ func evalBoolLit(node *ast.BoolLit) *Bool {
 	return FALSE
 }
 
-func evalStringLit(node *ast.StringLit) Object {
-	return &String{Value: node.Value}
+func evalIntLit(node *ast.IntLit) Object {
+	return &Int{Value: node.Value}
+}
+
+func evalFloatLit(node *ast.FloatLit) Object {
+	return &Float{Value: node.Value}
+}
+
+func evalStringLit(node *ast.StringLit, env *Env) Object {
+	return env.rt.track(&String{Value: node.Value})
+}
+
+func evalArrayLit(ctx context.Context, node *ast.ArrayLit, env *Env) Object {
+	elems := evalExprs(ctx, node.Elems, env)
+	if len(elems) == 1 && isError(elems[0]) {
+		return elems[0]
+	}
+	defer env.rt.mem.pin(&elems)()
+	return env.rt.track(&Array{Elems: elems})
+}
+
+func evalMapLit(ctx context.Context, node *ast.MapLit, env *Env) Object {
+	m := NewMap()
+	held := []Object{m}
+	defer env.rt.mem.pin(&held)()
+
+	for _, pair := range node.Pairs {
+		key := eval(ctx, pair.Key, env)
+		if isError(key) {
+			return key
+		}
+
+		hashKey, ok := key.(Hashable)
+		if !ok {
+			return newError("invalid map key: %s", key.Type().String())
+		}
+
+		value := eval(ctx, pair.Value, env)
+		if isError(value) {
+			return value
+		}
+
+		m.Set(hashKey, value)
+	}
+
+	return env.rt.track(m)
 }
 
 func evalFunLit(node *ast.FunLit, env *Env) Object {
-	return &Fun{Params: node.Params, Body: node.Body, Env: env}
+	return env.rt.track(&Fun{Params: node.Params, Body: node.Body, Env: env, Generator: node.Generator, Async: node.Async})
 }
 
-func evalExprs(exprs []ast.Expr, env *Env) []Object {
+// evalExprs evaluates exprs in order, returning their values or else a
+// slice holding only the first Error. The values evaluated are pinned while
+// the others are, see memory.pin.
+func evalExprs(ctx context.Context, exprs []ast.Expr, env *Env) []Object {
 	var result []Object
+	defer env.rt.mem.pin(&result)()
 
 	for _, expr := range exprs {
-		e := Eval(expr, env)
+		e := eval(ctx, expr, env)
 		if isError(e) {
 			return []Object{e}
 		}
@@ -142,58 +467,260 @@ func evalExprs(exprs []ast.Expr, env *Env) []Object {
 	return result
 }
 
-func evalCallExpr(node *ast.CallExpr, env *Env) Object {
-	fun := Eval(node.Fun, env)
+func evalCallExpr(ctx context.Context, node *ast.CallExpr, env *Env) Object {
+	fun := eval(ctx, node.Fun, env)
 	if isError(fun) {
 		return fun
 	}
 
-	args := evalExprs(node.Args, env)
+	args := evalExprs(ctx, node.Args, env)
 	if len(args) == 1 && isError(args[0]) {
 		return args[0]
 	}
 
+	return applyFunction(ctx, env, callName(node.Fun), fun, args)
+}
+
+// applyFunction calls fun, a Fun or Builtin, with args. The name is used in
+// stack traces and error messages.
+func applyFunction(ctx context.Context, env *Env, name string, fun Object, args []Object) Object {
+	if err := env.rt.step(ctx); err != nil {
+		return err
+	}
+	defer env.rt.mem.pin(&args)()
+
 	switch f := fun.(type) {
 	case *Fun:
+		if len(args) != len(f.Params) {
+			return newError("wrong number of arguments to %s: want %d, got %d", name, len(f.Params), len(args))
+		}
+
 		env := NewEnclosedEnv(f.Env)
+		ctx, err := env.rt.pushFrame(ctx, name, env)
+		if err != nil {
+			return err
+		}
+		defer env.rt.popFrame(ctx)
+
+		if err := env.rt.alloc(envSize); err != nil {
+			return err
+		}
+
 		for paramIdx, param := range f.Params {
-			env.Set(param.Value, args[paramIdx])
+			if err := bindPattern(ctx, param, args[paramIdx], env); err != nil {
+				return err
+			}
 		}
 
-		evaluated := Eval(f.Body, env)
+		if f.Generator {
+			return newGenerator(name, f, env)
+		}
+		if f.Async {
+			return startAsync(ctx, name, f, env)
+		}
+
+		evaluated := eval(ctx, f.Body, env)
 		if returnVal, ok := evaluated.(*ReturnValue); ok {
 			return returnVal.Value
 		}
 		return evaluated
 
 	case *Builtin:
-		return f.Fun(args...)
+		if f.Arity != VariadicArity && len(args) != f.Arity {
+			return newError("wrong number of arguments to %s: want %d, got %d", f.Name, f.Arity, len(args))
+		}
+		return f.Fun(ctx, env, args...)
+
+	case *RecordType:
+		return newRecord(f, args, env)
+
+	case *Class:
+		return newInstance(ctx, f, args, env)
+
+	case *Variant:
+		return newEnumValue(f, args, env)
 
 	default:
 		return newError("invalid function: %s", f.Type().String())
 	}
 }
 
-func evalBinaryExpr(node *ast.BinaryExpr, env *Env) Object {
-	left := Eval(node.Left, env)
+// callName describes the function called by fun for stack traces.
+func callName(fun ast.Expr) string {
+	switch fun := fun.(type) {
+	case *ast.Ident:
+		return fun.Value
+	case *ast.SelectorExpr:
+		return callName(fun.X) + "." + fun.Sel.Value
+	}
+	return "<anonymous>"
+}
+
+func evalSelectorExpr(ctx context.Context, node *ast.SelectorExpr, env *Env) Object {
+	x := eval(ctx, node.X, env)
+	if isError(x) {
+		return x
+	}
+
+	switch x := x.(type) {
+	case *Namespace:
+		member, ok := x.Get(node.Sel.Value)
+		if !ok {
+			return newError("invalid selector: %s.%s", x.Name, node.Sel.Value)
+		}
+		return member
+
+	case *Map:
+		if value, ok := x.Get(&String{Value: node.Sel.Value}); ok {
+			return value
+		}
+
+	case *Record:
+		if value, ok := x.Get(node.Sel.Value); ok {
+			return value
+		}
+		return newError("record %s has no field %s", x.RecordType.Name, node.Sel.Value)
+
+	case *Instance:
+		return selectInstance(x, node.Sel.Value)
+
+	case *Super:
+		return selectSuper(x, node.Sel.Value)
+
+	case *Enum:
+		return selectEnum(x, node.Sel.Value)
+
+	case *EnumValue:
+		if value, ok := x.Get(node.Sel.Value); ok {
+			return value
+		}
+		return newError("%s.%s has no field %s", x.Variant.Enum.Name, x.Variant.Name, node.Sel.Value)
+	}
+
+	if method, ok := lookupMethod(x, node.Sel.Value); ok {
+		return method
+	}
+
+	if x.Type() == MAP_OBJ {
+		return NULL
+	}
+
+	return newError("invalid selector: %s has no method %s", x.Type().String(), node.Sel.Value)
+}
+
+func evalIndexExpr(ctx context.Context, node *ast.IndexExpr, env *Env) Object {
+	x := eval(ctx, node.X, env)
+	if isError(x) {
+		return x
+	}
+
+	index := eval(ctx, node.Index, env)
+	if isError(index) {
+		return index
+	}
+
+	switch x := x.(type) {
+	case *Array:
+		i, ok := index.(*Int)
+		if !ok {
+			return newError("invalid array index: %s", index.Type().String())
+		}
+		if i.Value < 0 || i.Value >= int64(len(x.Elems)) {
+			return newError("array index out of range: %d", i.Value)
+		}
+		return x.Elems[i.Value]
+
+	case *Map:
+		key, ok := index.(Hashable)
+		if !ok {
+			return newError("invalid map key: %s", index.Type().String())
+		}
+		if value, ok := x.Get(key); ok {
+			return value
+		}
+		return NULL
+
+	case *Instance:
+		if result, ok := callHook(ctx, env, x, indexHook, index); ok {
+			return result
+		}
+	}
+
+	return newError("invalid operation: cannot index %s", x.Type().String())
+}
+
+// evalUnaryExpr applies a prefix operator: - negates numbers and ! negates
+// the truthiness of any value.
+func evalUnaryExpr(ctx context.Context, node *ast.UnaryExpr, env *Env) Object {
+	x := eval(ctx, node.X, env)
+	if isError(x) {
+		return x
+	}
+	if x == nil {
+		x = NULL
+	}
+
+	switch node.Op.Type {
+	case grammar.NOT:
+		return nativeBool(!x.IsTruthy())
+	case grammar.SUB:
+		switch x := x.(type) {
+		case *Int:
+			return &Int{Value: -x.Value}
+		case *Float:
+			return &Float{Value: -x.Value}
+		}
+	}
+
+	return newError("invalid operation: %s%s", node.Op.Lit, x.Type().String())
+}
+
+func evalBinaryExpr(ctx context.Context, node *ast.BinaryExpr, env *Env) Object {
+	left := eval(ctx, node.Left, env)
 	if isError(left) {
 		return left
 	}
 
-	right := Eval(node.Right, env)
+	right := eval(ctx, node.Right, env)
 	if isError(right) {
 		return right
 	}
 
+	if result, ok := evalOperatorHook(ctx, node.Op.Type, left, right, env); ok {
+		return result
+	}
+
 	switch {
 	case left.Type() == BOOL_OBJ && right.Type() == BOOL_OBJ:
 		leftVal := left.(*Bool)
 		rightVal := right.(*Bool)
 		return evalBoolBinaryExpr(node.Op.Type, leftVal, rightVal)
+	case left.Type() == INT_OBJ && right.Type() == INT_OBJ:
+		leftVal := left.(*Int)
+		rightVal := right.(*Int)
+		return evalIntBinaryExpr(node.Op.Type, leftVal, rightVal)
+	case left.Type() == FLOAT_OBJ && right.Type() == FLOAT_OBJ:
+		leftVal := left.(*Float)
+		rightVal := right.(*Float)
+		return evalFloatBinaryExpr(node.Op.Type, leftVal, rightVal)
+	case left.Type() == INT_OBJ && right.Type() == FLOAT_OBJ:
+		leftVal := &Float{Value: float64(left.(*Int).Value)}
+		rightVal := right.(*Float)
+		return evalFloatBinaryExpr(node.Op.Type, leftVal, rightVal)
+	case left.Type() == FLOAT_OBJ && right.Type() == INT_OBJ:
+		leftVal := left.(*Float)
+		rightVal := &Float{Value: float64(right.(*Int).Value)}
+		return evalFloatBinaryExpr(node.Op.Type, leftVal, rightVal)
 	case left.Type() == STRING_OBJ && right.Type() == STRING_OBJ:
 		leftVal := left.(*String)
 		rightVal := right.(*String)
-		return evalStringBinaryExpr(node.Op.Type, leftVal, rightVal)
+		return evalStringBinaryExpr(node.Op.Type, leftVal, rightVal, env)
+	case node.Op.Type == grammar.EQ || node.Op.Type == grammar.NEQ:
+		equal, err := objectsEqual(left, right)
+		if err != nil {
+			return err
+		}
+		return nativeBool(equal == (node.Op.Type == grammar.EQ))
 	default:
 		return newError("invalid operation: %s %s %s", left.Type().String(), node.Op.Lit, right.Type().String())
 	}
@@ -202,24 +729,92 @@ func evalBinaryExpr(node *ast.BinaryExpr, env *Env) Object {
 func evalBoolBinaryExpr(opTokType grammar.TokenType, left, right *Bool) Object {
 	switch opTokType {
 	case grammar.EQ:
-		if left.Value == right.Value {
-			return TRUE
-		}
-		return FALSE
+		return nativeBool(left.Value == right.Value)
+	case grammar.NEQ:
+		return nativeBool(left.Value != right.Value)
 	}
 
 	return newError("unknown operator for Bool: %s", opTokType)
 }
 
-func evalStringBinaryExpr(opTokType grammar.TokenType, left, right *String) Object {
+func evalIntBinaryExpr(opTokType grammar.TokenType, left, right *Int) Object {
 	switch opTokType {
 	case grammar.ADD:
-		return &String{Value: left.Value + right.Value}
-	case grammar.EQ:
-		if left.Value == right.Value {
-			return TRUE
+		return &Int{Value: left.Value + right.Value}
+	case grammar.SUB:
+		return &Int{Value: left.Value - right.Value}
+	case grammar.MUL:
+		return &Int{Value: left.Value * right.Value}
+	case grammar.QUO:
+		if right.Value == 0 {
+			return newError("division by zero")
+		}
+		return &Int{Value: left.Value / right.Value}
+	case grammar.REM:
+		if right.Value == 0 {
+			return newError("division by zero")
 		}
-		return FALSE
+		return &Int{Value: left.Value % right.Value}
+	case grammar.EQ:
+		return nativeBool(left.Value == right.Value)
+	case grammar.NEQ:
+		return nativeBool(left.Value != right.Value)
+	case grammar.LSS:
+		return nativeBool(left.Value < right.Value)
+	case grammar.GTR:
+		return nativeBool(left.Value > right.Value)
+	case grammar.LEQ:
+		return nativeBool(left.Value <= right.Value)
+	case grammar.GEQ:
+		return nativeBool(left.Value >= right.Value)
+	}
+
+	return newError("unknown operator for Int: %s", opTokType)
+}
+
+func evalFloatBinaryExpr(opTokType grammar.TokenType, left, right *Float) Object {
+	switch opTokType {
+	case grammar.ADD:
+		return &Float{Value: left.Value + right.Value}
+	case grammar.SUB:
+		return &Float{Value: left.Value - right.Value}
+	case grammar.MUL:
+		return &Float{Value: left.Value * right.Value}
+	case grammar.QUO:
+		return &Float{Value: left.Value / right.Value}
+	case grammar.EQ:
+		return nativeBool(left.Value == right.Value)
+	case grammar.NEQ:
+		return nativeBool(left.Value != right.Value)
+	case grammar.LSS:
+		return nativeBool(left.Value < right.Value)
+	case grammar.GTR:
+		return nativeBool(left.Value > right.Value)
+	case grammar.LEQ:
+		return nativeBool(left.Value <= right.Value)
+	case grammar.GEQ:
+		return nativeBool(left.Value >= right.Value)
+	}
+
+	return newError("unknown operator for Float: %s", opTokType)
+}
+
+func evalStringBinaryExpr(opTokType grammar.TokenType, left, right *String, env *Env) Object {
+	switch opTokType {
+	case grammar.ADD:
+		return env.rt.track(&String{Value: left.Value + right.Value})
+	case grammar.EQ:
+		return nativeBool(left.Value == right.Value)
+	case grammar.NEQ:
+		return nativeBool(left.Value != right.Value)
+	case grammar.LSS:
+		return nativeBool(left.Value < right.Value)
+	case grammar.GTR:
+		return nativeBool(left.Value > right.Value)
+	case grammar.LEQ:
+		return nativeBool(left.Value <= right.Value)
+	case grammar.GEQ:
+		return nativeBool(left.Value >= right.Value)
 	}
 
 	return newError("unknown operator for String: %s", opTokType)
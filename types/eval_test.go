@@ -0,0 +1,183 @@
+package types
+
+import (
+	"context"
+	"testing"
+
+	"github.com/gramidt/mash-lang-for-codemash/parser"
+	"github.com/gramidt/mash-lang-for-codemash/scanner"
+)
+
+func TestLimits(t *testing.T) {
+	tests := []struct {
+		name    string
+		src     string
+		opts    []Option
+		expired bool
+		kind    ErrorKind
+		msg     string
+	}{
+		{"step budget of recursion", `var f = fun() { f() }
+f()`, []Option{WithStepBudget(100)}, false, BUDGET_EXCEEDED_ERROR, "step budget exceeded"},
+		{"step budget of loop", `for (i in range(1000)) {}`,
+			[]Option{WithStepBudget(100)}, false, BUDGET_EXCEEDED_ERROR, "step budget exceeded"},
+		{"step budget of generator", `var g = fun() { for (i in range(1000)) { yield i } }
+for (x in g()) {}`, []Option{WithStepBudget(100)}, false, BUDGET_EXCEEDED_ERROR, "step budget exceeded"},
+		{"timeout", `var f = fun() { f() }
+f()`, nil, true, TIMEOUT_ERROR, "evaluation timed out"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tt.expired {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, 0)
+				defer cancel()
+			}
+			p := parser.NewParser(scanner.NewScanner(tt.src))
+			result := Eval(ctx, p.Parse(), NewEnv(tt.opts...))
+			if err, ok := result.(*Error); !ok || err.Kind != tt.kind || err.Msg != tt.msg {
+				t.Errorf("Eval = %s, want the %s error %q", result.Inspect(), tt.kind, tt.msg)
+			}
+		})
+	}
+}
+
+func TestCanceledEval(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	p := parser.NewParser(scanner.NewScanner(`var f = fun() { 1 }
+f()`))
+	result := Eval(ctx, p.Parse(), NewEnv())
+	if err, ok := result.(*Error); !ok || err.Kind != CANCELED_ERROR {
+		t.Errorf("Eval = %s, want a CANCELED_ERROR", result.Inspect())
+	}
+}
+
+func TestStepBudgetAllowsWork(t *testing.T) {
+	env := NewEnv(WithStepBudget(6))
+	result := evalSource(t, `var f = fun(n) { if (n == 5) { n } else { f(n + 1) } }
+f(0)`, env)
+	if got, ok := result.(*Int); !ok || got.Value != 5 {
+		t.Fatalf("Eval = %s, want 5", result.Inspect())
+	}
+}
+
+func TestEvalTwiceOnOneEnv(t *testing.T) {
+	env := NewEnv(WithStepBudget(100))
+	src := `var total = 0
+for (i in range(60)) { total = total + i }
+total`
+
+	for run := 1; run <= 2; run++ {
+		result := evalSource(t, src, env)
+		if got, ok := result.(*Int); !ok || got.Value != 1770 {
+			t.Fatalf("run %d = %s, want 1770", run, result.Inspect())
+		}
+		if steps := env.Stats().Steps; steps < 60 || steps > 100 {
+			t.Errorf("run %d took %d steps, want 60 to 100", run, steps)
+		}
+	}
+}
+
+// evalSource parses src and evaluates it in env, failing the test on a
+// parse error.
+func evalSource(t *testing.T, src string, env *Env) Object {
+	t.Helper()
+	p := parser.NewParser(scanner.NewScanner(src))
+	program := p.Parse()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parsing %q: %v", src, p.Errors())
+	}
+	return Eval(context.Background(), program, env)
+}
+
+// An evalTest is a script with the result it evaluates to, written as
+// Inspect returns it, or the message of the Error it fails with.
+type evalTest struct {
+	name    string
+	src     string
+	want    string
+	wantErr string
+}
+
+// runEvalTests evaluates each test in a fresh Env created with opts.
+func runEvalTests(t *testing.T, tests []evalTest, opts ...Option) {
+	t.Helper()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := evalSource(t, tt.src, NewEnv(opts...))
+			checkResult(t, result, tt.wantErr)
+			if tt.wantErr == "" && result.Inspect() != tt.want {
+				t.Errorf("Eval = %s, want %s", result.Inspect(), tt.want)
+			}
+		})
+	}
+}
+
+// checkResult fails the test if result is an Error and wantErr is empty, or
+// if result is not an Error with the message wantErr.
+func checkResult(t *testing.T, result Object, wantErr string) {
+	t.Helper()
+	err, ok := result.(*Error)
+	switch {
+	case wantErr == "" && ok:
+		t.Errorf("Eval: %s", err.Inspect())
+	case wantErr != "" && (!ok || err.Msg != wantErr):
+		t.Errorf("Eval = %s, want the error %q", result.Inspect(), wantErr)
+	}
+}
+
+func TestOperators(t *testing.T) {
+	runEvalTests(t, []evalTest{
+		{"arithmetic", `[7 + 2, 7 - 2, 7 * 2, 7 / 2, 7 % 2]`, "[9, 5, 14, 3, 1]", ""},
+		{"precedence", `1 + 2 * 3 - 8 / 4`, "5", ""},
+		{"float", `[1.5 + 1, 3 - 0.5, 2 * 1.25, 1 / 2.0]`, "[2.5, 2.5, 2.5, 0.5]", ""},
+		{"comparison", `[1 < 2, 2 <= 2, 3 > 4, 4 >= 5, 1.5 < 2, 1 != 2, "a" != "a"]`, "[true, true, false, false, true, true, false]", ""},
+		{"mixed equality", `[1 == "1", true != 1]`, "[false, true]", ""},
+		{"negation", `[-5, -1.5, -(2 - 3), 2 * -3, - -1]`, "[-5, -1.5, 1, -6, 1]", ""},
+		{"not", `[!true, !false, !0, !"", !!1]`, "[false, true, true, false, true]", ""},
+		{"null", `[null, null == null, !null, null != false]`, "[null, true, true, true]", ""},
+		{"comments", `// leading
+var x = 1 // trailing
+x + 1 // last`, "2", ""},
+
+		{"division by zero", `1 / 0`, "", "division by zero"},
+		{"remainder by zero", `1 % 0`, "", "division by zero"},
+		{"mismatched operands", `"a" - "b"`, "", "unknown operator for String: -"},
+		{"negated string", `-"a"`, "", "invalid operation: -STRING"},
+		{"invalid operation", `"a" + 1`, "", "invalid operation: STRING + INT"},
+	})
+}
+
+func TestListBuiltins(t *testing.T) {
+	runEvalTests(t, []evalTest{
+		{"len", `[len([]), len([1, 2]), len({"a": 1})]`, "[0, 2, 1]", ""},
+		{"append", `var xs = [1]; [append(xs, 2, 3), xs]`, "[[1, 2, 3], [1]]", ""},
+		{"slice", `slice([1, 2, 3, 4], 1, 3)`, "[2, 3]", ""},
+		{"slice clamps", `[slice([1, 2], -1, 9), slice([1, 2], 2, 1)]`, "[[1, 2], []]", ""},
+
+		{"len of bool", `len(true)`, "", "argument to len not supported, got BOOL"},
+		{"append to map", `append({}, 1)`, "", "first argument to append must be ARRAY, got MAP"},
+		{"slice indexes", `slice([1], "a", 1)`, "", "indexes passed to slice must be INT, got STRING and INT"},
+	})
+}
+
+func TestIfExpr(t *testing.T) {
+	runEvalTests(t, []evalTest{
+		{"else if chain", `var sign = fun(n) {
+	if (n < 0) { "neg" } else if (n == 0) { "zero" } else if (n < 10) { "small" } else { "big" }
+};
+[sign(-1), sign(0), sign(5), sign(50)]`, "[neg, zero, small, big]", ""},
+		{"value", `var x = if (true) { "a" } else { "b" }
+x`, "a", ""},
+		{"operand", `(if (true) { 2 } else { 3 }) * 2`, "4", ""},
+		{"no branch taken", `if (false) { 1 }`, "null", ""},
+		{"no branch of chain taken", `var x = if (false) { 1 } else if (false) { 2 }
+x`, "null", ""},
+		{"empty block", `if (true) {}`, "null", ""},
+		{"later conditions unevaluated", `if (1 > 0) { 1 } else if (undefinedName) { 2 }`, "1", ""},
+		{"condition error", `if (false) { 1 } else if (undefinedName) { 2 }`, "", "invalid identifier: undefinedName"},
+	})
+}
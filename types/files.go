@@ -0,0 +1,279 @@
+package types
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var fsModule = newNamespace("fs",
+	&Builtin{Name: "readFile", Fun: readFile, Arity: 1},
+	&Builtin{Name: "writeFile", Fun: writeFile, Arity: 2},
+	&Builtin{Name: "appendFile", Fun: appendFile, Arity: 2},
+	&Builtin{Name: "readLines", Fun: readLines, Arity: 1},
+	&Builtin{Name: "exists", Fun: exists, Arity: 1},
+	&Builtin{Name: "stat", Fun: stat, Arity: 1},
+	&Builtin{Name: "listDir", Fun: listDir, Arity: 1},
+	&Builtin{Name: "glob", Fun: glob, Arity: 1},
+	&Builtin{Name: "mkdirAll", Fun: mkdirAll, Arity: 1},
+	&Builtin{Name: "remove", Fun: remove, Arity: 1},
+)
+
+func readFile(ctx context.Context, env *Env, args ...Object) Object {
+	path, err := pathArg("fs.readFile", READ_PERM, env, args[0])
+	if err != nil {
+		return err
+	}
+
+	f, openErr := env.rt.fs.Open(path)
+	if openErr != nil {
+		return newIOError("fs.readFile", openErr)
+	}
+	defer f.Close()
+
+	data, readErr := env.rt.readAll("fs.readFile", f)
+	if readErr != nil {
+		return readErr
+	}
+
+	return env.rt.track(&String{Value: string(data)})
+}
+
+// maxReadSize is the largest file read whole, by fs.readFile or import.
+// Larger files are better read line by line with fs.readLines.
+const maxReadSize = 1 << 30
+
+// readAll reads r until EOF for the builtin called name. It fails without
+// reading further once r holds more than maxReadSize bytes, or more than the
+// memory limit of rt allows.
+func (rt *runtime) readAll(name string, r io.Reader) ([]byte, *Error) {
+	limit := int64(maxReadSize)
+	if rt.maxAlloc > 0 && rt.maxAlloc < limit {
+		limit = rt.maxAlloc
+	}
+
+	data, err := io.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return nil, newIOError(name, err)
+	}
+	if int64(len(data)) > limit {
+		if limit == rt.maxAlloc {
+			return nil, &Error{
+				Kind: MEMORY_LIMIT_ERROR,
+				Msg:  fmt.Sprintf("%s: file exceeds the memory limit of %d bytes", name, limit),
+			}
+		}
+		return nil, &Error{Kind: IO_ERROR, Msg: fmt.Sprintf("%s: file exceeds %d bytes", name, limit)}
+	}
+	return data, nil
+}
+
+func writeFile(ctx context.Context, env *Env, args ...Object) Object {
+	return writeTo("fs.writeFile", os.O_WRONLY|os.O_CREATE|os.O_TRUNC, env, args)
+}
+
+func appendFile(ctx context.Context, env *Env, args ...Object) Object {
+	return writeTo("fs.appendFile", os.O_WRONLY|os.O_CREATE|os.O_APPEND, env, args)
+}
+
+func writeTo(name string, flag int, env *Env, args []Object) Object {
+	path, err := pathArg(name, WRITE_PERM, env, args[0])
+	if err != nil {
+		return err
+	}
+
+	data, ok := args[1].(*String)
+	if !ok {
+		return newError("second argument to %s must be STRING, got %s", name, args[1].Type().String())
+	}
+
+	f, openErr := env.rt.fs.OpenFile(path, flag, 0o644)
+	if openErr != nil {
+		return newIOError(name, openErr)
+	}
+
+	_, writeErr := io.WriteString(f, data.Value)
+	if closeErr := f.Close(); writeErr == nil {
+		writeErr = closeErr
+	}
+	if writeErr != nil {
+		return newIOError(name, writeErr)
+	}
+
+	return NULL
+}
+
+// readLines returns an Iterator of the lines of the file. The file is read
+// lazily, so arbitrarily large files can be processed line by line, and is
+// closed once the lines are exhausted or the Iterator is closed.
+func readLines(ctx context.Context, env *Env, args ...Object) Object {
+	path, err := pathArg("fs.readLines", READ_PERM, env, args[0])
+	if err != nil {
+		return err
+	}
+
+	f, openErr := env.rt.fs.Open(path)
+	if openErr != nil {
+		return newIOError("fs.readLines", openErr)
+	}
+
+	lines := bufio.NewScanner(f)
+	closed := false
+	closeFile := func() {
+		if !closed {
+			closed = true
+			f.Close()
+		}
+	}
+
+	next := func(ctx context.Context) (Object, bool, *Error) {
+		if closed {
+			return NULL, true, nil
+		}
+
+		if lines.Scan() {
+			line := env.rt.track(&String{Value: lines.Text()})
+			if err, ok := line.(*Error); ok {
+				closeFile()
+				return nil, false, err
+			}
+			return line, false, nil
+		}
+
+		closeFile()
+		if scanErr := lines.Err(); scanErr != nil {
+			return nil, false, newIOError("fs.readLines", scanErr)
+		}
+		return NULL, true, nil
+	}
+
+	return env.rt.track(&Iterator{next: next, close: closeFile})
+}
+
+func exists(ctx context.Context, env *Env, args ...Object) Object {
+	path, err := pathArg("fs.exists", READ_PERM, env, args[0])
+	if err != nil {
+		return err
+	}
+
+	if _, statErr := env.rt.fs.Stat(path); statErr != nil {
+		if ioErr := newIOError("fs.exists", statErr); ioErr.Kind != NOT_FOUND_ERROR {
+			return ioErr
+		}
+		return FALSE
+	}
+	return TRUE
+}
+
+func stat(ctx context.Context, env *Env, args ...Object) Object {
+	path, err := pathArg("fs.stat", READ_PERM, env, args[0])
+	if err != nil {
+		return err
+	}
+
+	info, statErr := env.rt.fs.Stat(path)
+	if statErr != nil {
+		return newIOError("fs.stat", statErr)
+	}
+
+	m := NewMap()
+	m.Set(&String{Value: "name"}, &String{Value: info.Name()})
+	m.Set(&String{Value: "size"}, &Int{Value: info.Size()})
+	m.Set(&String{Value: "isDir"}, nativeBool(info.IsDir()))
+	m.Set(&String{Value: "mode"}, &String{Value: info.Mode().String()})
+	m.Set(&String{Value: "modTime"}, &String{Value: info.ModTime().Format(time.RFC3339Nano)})
+	return env.rt.track(m)
+}
+
+func listDir(ctx context.Context, env *Env, args ...Object) Object {
+	path, err := pathArg("fs.listDir", READ_PERM, env, args[0])
+	if err != nil {
+		return err
+	}
+
+	entries, readErr := env.rt.fs.ReadDir(path)
+	if readErr != nil {
+		return newIOError("fs.listDir", readErr)
+	}
+
+	names := make([]Object, len(entries))
+	for i, entry := range entries {
+		names[i] = &String{Value: entry.Name()}
+	}
+	return env.rt.track(&Array{Elems: names})
+}
+
+func glob(ctx context.Context, env *Env, args ...Object) Object {
+	pattern, ok := args[0].(*String)
+	if !ok {
+		return newError("argument to fs.glob must be STRING, got %s", args[0].Type().String())
+	}
+
+	// Globbing reads the directories below the part of the pattern without
+	// meta characters, so that is what needs read access.
+	root := pattern.Value
+	if i := strings.IndexAny(root, `*?[\`); i >= 0 {
+		root = filepath.Dir(root[:i])
+	}
+	if err := env.Require(READ_PERM, root); err != nil {
+		return err
+	}
+
+	matches, globErr := env.rt.fs.Glob(pattern.Value)
+	if globErr != nil {
+		return newError("fs.glob: %s", globErr)
+	}
+
+	// A match may lie outside the readable paths even so, through a
+	// symbolic link, so only the matches that may be read are returned.
+	names := []Object{}
+	for _, match := range matches {
+		if env.Require(READ_PERM, match) == nil {
+			names = append(names, &String{Value: match})
+		}
+	}
+	return env.rt.track(&Array{Elems: names})
+}
+
+func mkdirAll(ctx context.Context, env *Env, args ...Object) Object {
+	path, err := pathArg("fs.mkdirAll", WRITE_PERM, env, args[0])
+	if err != nil {
+		return err
+	}
+
+	if mkdirErr := env.rt.fs.MkdirAll(path, 0o755); mkdirErr != nil {
+		return newIOError("fs.mkdirAll", mkdirErr)
+	}
+	return NULL
+}
+
+func remove(ctx context.Context, env *Env, args ...Object) Object {
+	path, err := pathArg("fs.remove", WRITE_PERM, env, args[0])
+	if err != nil {
+		return err
+	}
+
+	if removeErr := env.rt.fs.Remove(path); removeErr != nil {
+		return newIOError("fs.remove", removeErr)
+	}
+	return NULL
+}
+
+// pathArg returns the path held by arg once perm has been checked for it.
+func pathArg(name string, perm Perm, env *Env, arg Object) (string, *Error) {
+	path, ok := arg.(*String)
+	if !ok {
+		return "", newError("path argument to %s must be STRING, got %s", name, arg.Type().String())
+	}
+
+	if err := env.Require(perm, path.Value); err != nil {
+		return "", err
+	}
+
+	return path.Value, nil
+}
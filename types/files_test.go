@@ -0,0 +1,177 @@
+package types
+
+import (
+	"bytes"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func TestFileBuiltins(t *testing.T) {
+	dir := t.TempDir()
+	q := func(elem ...string) string {
+		return strconv.Quote(filepath.Join(append([]string{dir}, elem...)...))
+	}
+
+	// The steps run in order in one Env, each seeing the files left by the
+	// previous ones.
+	steps := []struct {
+		src  string
+		want string
+	}{
+		{`fs.exists(` + q("a.txt") + `)`, "false"},
+		{`fs.writeFile(` + q("a.txt") + `, "one")`, "null"},
+		{`fs.appendFile(` + q("a.txt") + `, "two")`, "null"},
+		{`fs.readFile(` + q("a.txt") + `)`, "onetwo"},
+		{`fs.exists(` + q("a.txt") + `)`, "true"},
+		{`fs.writeFile(` + q("a.txt") + `, "three")`, "null"},
+		{`fs.readFile(` + q("a.txt") + `)`, "three"},
+		{`var s = fs.stat(` + q("a.txt") + `);
+[s["name"], s["size"], s["isDir"]]`, "[a.txt, 5, false]"},
+		{`fs.mkdirAll(` + q("sub", "deep") + `)`, "null"},
+		{`fs.stat(` + q("sub") + `)["isDir"]`, "true"},
+		{`fs.writeFile(` + q("sub", "b.txt") + `, "")`, "null"},
+		{`fs.listDir(` + q() + `)`, "[a.txt, sub]"},
+		{`fs.listDir(` + q("sub") + `)`, "[b.txt, deep]"},
+		{`fs.glob(` + q("sub", "*.txt") + `)`, "[" + filepath.Join(dir, "sub", "b.txt") + "]"},
+		{`fs.readLines(` + q("a.txt") + `).toArray()`, "[three]"},
+		{`fs.remove(` + q("sub", "b.txt") + `)`, "null"},
+		{`fs.exists(` + q("sub", "b.txt") + `)`, "false"},
+		{`fs.remove(` + q("sub") + `)`, "ERROR: fs.remove: remove " + filepath.Join(dir, "sub") + ": directory not empty"},
+		{`fs.writeFile(` + q("a.txt") + `, 1)`, "ERROR: second argument to fs.writeFile must be STRING, got INT"},
+		{`fs.readFile(1)`, "ERROR: path argument to fs.readFile must be STRING, got INT"},
+	}
+
+	env := NewEnv(AllowRead(dir), AllowWrite(dir))
+	for _, step := range steps {
+		result := evalSource(t, step.src, env)
+		if result.Inspect() != step.want {
+			t.Fatalf("Eval(%q) = %s, want %s", step.src, result.Inspect(), step.want)
+		}
+	}
+}
+
+func TestFileErrorKinds(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "a.txt"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	q := func(name string) string { return strconv.Quote(filepath.Join(dir, name)) }
+
+	tests := []struct {
+		name string
+		src  string
+		kind ErrorKind
+		opts []Option
+	}{
+		{"read missing", `fs.readFile(` + q("missing") + `)`, NOT_FOUND_ERROR, nil},
+		{"stat missing", `fs.stat(` + q("missing") + `)`, NOT_FOUND_ERROR, nil},
+		{"list missing", `fs.listDir(` + q("missing") + `)`, NOT_FOUND_ERROR, nil},
+		{"remove missing", `fs.remove(` + q("missing") + `)`, NOT_FOUND_ERROR, []Option{AllowWrite(dir)}},
+		{"mkdir over file", `fs.mkdirAll(` + q("a.txt") + `)`, IO_ERROR, []Option{AllowWrite(dir)}},
+		{"read outside", `fs.readFile(` + strconv.Quote(filepath.Join(filepath.Dir(dir), "x")) + `)`, PERMISSION_DENIED_ERROR, nil},
+		{"write without permission", `fs.writeFile(` + q("a.txt") + `, "")`, PERMISSION_DENIED_ERROR, nil},
+		{"remove without permission", `fs.remove(` + q("a.txt") + `)`, PERMISSION_DENIED_ERROR, nil},
+		{"glob outside", `fs.glob(` + strconv.Quote(filepath.Join(filepath.Dir(dir), "*")) + `)`, PERMISSION_DENIED_ERROR, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := NewEnv(append(tt.opts, AllowRead(dir))...)
+			result := evalSource(t, tt.src, env)
+			if err, ok := result.(*Error); !ok || err.Kind != tt.kind {
+				t.Errorf("Eval = %s, want a %s error", result.Inspect(), tt.kind)
+			}
+		})
+	}
+}
+
+func TestForInReadLines(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "lines.txt")
+	if err := os.WriteFile(path, []byte("one\ntwo\nthree\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	env := NewEnv(AllowRead(dir), WithStdout(&out))
+	src := `for (line in fs.readLines(` + strconv.Quote(path) + `)) { print(line) }`
+	if result := evalSource(t, src, env); isError(result) {
+		t.Fatalf("Eval: %s", result.Inspect())
+	}
+	if got, want := out.String(), "one\ntwo\nthree\n"; got != want {
+		t.Errorf("printed %q, want %q", got, want)
+	}
+}
+
+func TestGlobSkipsUnreadableMatches(t *testing.T) {
+	dir := t.TempDir()
+	allowed := filepath.Join(dir, "allowed")
+	secret := filepath.Join(dir, "secret")
+	for _, d := range []string{filepath.Join(allowed, "real"), secret} {
+		if err := os.MkdirAll(d, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, f := range []string{filepath.Join(allowed, "real", "a"), filepath.Join(secret, "s")} {
+		if err := os.WriteFile(f, nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink(secret, filepath.Join(allowed, "link")); err != nil {
+		t.Skipf("symlinks unsupported: %v", err)
+	}
+
+	env := NewEnv(AllowRead(allowed))
+	result := evalSource(t, `fs.glob(`+strconv.Quote(filepath.Join(allowed, "*", "*"))+`)`, env)
+	want := "[" + filepath.Join(allowed, "real", "a") + "]"
+	if result.Inspect() != want {
+		t.Errorf("fs.glob = %s, want %s", result.Inspect(), want)
+	}
+}
+
+// endlessFS is a FileSystem whose files are endless streams of spaces.
+type endlessFS struct {
+	FileSystem
+}
+
+func (endlessFS) Open(name string) (io.ReadCloser, error) {
+	return io.NopCloser(endlessReader{}), nil
+}
+
+func (endlessFS) Stat(name string) (fs.FileInfo, error) {
+	return nil, nil
+}
+
+type endlessReader struct{}
+
+func (endlessReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = ' '
+	}
+	return len(p), nil
+}
+
+func TestReadsAreBounded(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{"readFile", `fs.readFile("big.txt")`, "fs.readFile: file exceeds the memory limit of 1048576 bytes"},
+		{"import", `import "big" as big`, "import: file exceeds the memory limit of 1048576 bytes"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := NewEnv(WithFileSystem(endlessFS{}), AllowRead(), WithMemoryLimit(1<<20))
+			result := evalSource(t, tt.src, env)
+			if err, ok := result.(*Error); !ok || err.Kind != MEMORY_LIMIT_ERROR || err.Msg != tt.want {
+				t.Errorf("Eval = %s, want the MEMORY_LIMIT_ERROR %q", result.Inspect(), tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,103 @@
+package types
+
+import "context"
+
+// Freeze makes obj and every Array, Map and Instance reachable from it,
+// through Records and enum values too, immutable, so that scripts cannot
+// assign to their elements or fields, and returns obj. Hosts can use it to
+// share configuration with scripts that must not change it.
+func Freeze(obj Object) Object {
+	// Values are frozen with a stack of their own rather than recursively,
+	// so that deeply nested values cannot exhaust the Go stack.
+	seen := make(map[Object]bool)
+	stack := []Object{obj}
+	for len(stack) > 0 {
+		obj := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if seen[obj] {
+			continue
+		}
+		seen[obj] = true
+
+		switch obj := obj.(type) {
+		case *Array:
+			if obj.Frozen {
+				continue
+			}
+			obj.Frozen = true
+			stack = append(stack, obj.Elems...)
+		case *Map:
+			if obj.Frozen {
+				continue
+			}
+			obj.Frozen = true
+			for _, pair := range obj.Pairs {
+				stack = append(stack, pair.Key, pair.Value)
+			}
+		case *Instance:
+			if obj.Frozen {
+				continue
+			}
+			obj.Frozen = true
+			for _, field := range obj.Fields {
+				stack = append(stack, field)
+			}
+		case *Record:
+			stack = append(stack, obj.Values...)
+		case *EnumValue:
+			stack = append(stack, obj.Values...)
+		}
+	}
+	return obj
+}
+
+// isFrozen reports whether a value cannot be modified, that is whether
+// every Array, Map and Instance reachable from it is frozen. Other values
+// are immutable themselves.
+func isFrozen(obj Object) bool {
+	seen := make(map[Object]bool)
+	stack := []Object{obj}
+	for len(stack) > 0 {
+		obj := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if seen[obj] {
+			continue
+		}
+		seen[obj] = true
+
+		switch obj := obj.(type) {
+		case *Array:
+			if !obj.Frozen {
+				return false
+			}
+			stack = append(stack, obj.Elems...)
+		case *Map:
+			if !obj.Frozen {
+				return false
+			}
+			for _, pair := range obj.Pairs {
+				stack = append(stack, pair.Key, pair.Value)
+			}
+		case *Instance:
+			if !obj.Frozen {
+				return false
+			}
+			for _, field := range obj.Fields {
+				stack = append(stack, field)
+			}
+		case *Record:
+			stack = append(stack, obj.Values...)
+		case *EnumValue:
+			stack = append(stack, obj.Values...)
+		}
+	}
+	return true
+}
+
+func freeze(ctx context.Context, env *Env, args ...Object) Object {
+	return Freeze(args[0])
+}
+
+func frozen(ctx context.Context, env *Env, args ...Object) Object {
+	return nativeBool(isFrozen(args[0]))
+}
@@ -0,0 +1,86 @@
+package types
+
+import (
+	"runtime/debug"
+	"strings"
+	"testing"
+)
+
+func TestConstAndFreeze(t *testing.T) {
+	runEvalTests(t, []evalTest{
+		{"const", `const x = 1
+x`, "1", ""},
+		{"shadowing in function", `const x = 1
+var f = fun() { var x = 2; x }
+f()`, "2", ""},
+		{"const binds, not freezes", `const xs = [1]
+xs[0] = 2
+xs`, "[2]", ""},
+		{"frozen nested values", `var m = freeze({"a": [1]})
+isFrozen(m.a)`, "true", ""},
+		{"copies are not frozen", `var xs = freeze([1])
+isFrozen(append(xs, 2))`, "false", ""},
+		{"values of records", `record Box { value }
+var b = freeze(Box([1]))
+isFrozen(b.value)`, "true", ""},
+		{"records holding mutable values", `record Box { value }
+isFrozen(Box([1]))`, "false", ""},
+		{"values of enum values", `enum Shape { Poly(points) }
+var p = freeze(Shape.Poly([1]))
+match (p) { Shape.Poly(points) => isFrozen(points) }`, "true", ""},
+		{"scalars are frozen", `isFrozen(1)`, "true", ""},
+
+		{"reassignment", `const x = 1
+x = 2`, "", "cannot assign to constant x"},
+		{"reassignment in function", `const x = 1
+var f = fun() { x = 2 }
+f()`, "", "cannot assign to constant x"},
+		{"redeclaration as var", `const x = 1
+var x = 2`, "", "cannot redeclare constant x"},
+		{"redeclaration as const", `const x = 1
+const x = 2`, "", "cannot redeclare constant x"},
+		{"destructured const", `const [c] = [3]
+c = 1`, "", "cannot assign to constant c"},
+		{"frozen map", `var m = freeze({"a": [1]})
+m["b"] = 1`, "", "cannot modify frozen MAP"},
+		{"frozen nested array", `var m = freeze({"a": [1]})
+m.a[0] = 2`, "", "cannot modify frozen ARRAY"},
+		{"frozen array in record", `record Box { value }
+var b = freeze(Box([1]))
+b.value[0] = 2`, "", "cannot modify frozen ARRAY"},
+	})
+}
+
+func TestDeeplyNestedValues(t *testing.T) {
+	// Printing and freezing keep stacks of their own and comparing stops at
+	// maxCompareDepth, so nesting deeper than the Go stack allows must not
+	// crash.
+	defer debug.SetMaxStack(debug.SetMaxStack(8 << 20))
+
+	env := NewEnv()
+	src := `record Box { value }
+var a = []
+var b = Box(0)
+var c = Box(0)
+for (i in range(100000)) {
+	a = [a]
+	b = Box(b)
+	c = Box(c)
+}
+freeze(a)`
+	if result := evalSource(t, src, env); isError(result) {
+		t.Fatalf("Eval: %s", result.Inspect())
+	}
+
+	if result := evalSource(t, `isFrozen(a)`, env); result != TRUE {
+		t.Errorf("isFrozen(a) = %s, want true", result.Inspect())
+	}
+	printed := evalSource(t, `a`, env).Inspect()
+	if want := strings.Repeat("[", 100001) + strings.Repeat("]", 100001); printed != want {
+		t.Errorf("a printed as %d bytes, want %d", len(printed), len(want))
+	}
+	result := evalSource(t, `b == c`, env)
+	if err, ok := result.(*Error); !ok || !strings.Contains(err.Msg, "nested deeper") {
+		t.Errorf("b == c = %s, want an error about nesting", result.Inspect())
+	}
+}
@@ -0,0 +1,156 @@
+package types
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+)
+
+// WrapFunc adapts an arbitrary Go function into a Builtin named name.
+//
+// Arguments are converted to the Go parameter types with the same rules as
+// ToGo when the function is called, and results are converted back with
+// FromGo. A function may return nothing, a single value, an error, or a
+// value followed by an error. A non-nil error is turned into a Mash Error,
+// and so is a panic of the function.
+func WrapFunc(name string, fn interface{}) (*Builtin, error) {
+	fv := reflect.ValueOf(fn)
+	if !fv.IsValid() {
+		return nil, fmt.Errorf("cannot wrap %s: nil is not a function", name)
+	}
+	ft := fv.Type()
+	if ft.Kind() != reflect.Func {
+		return nil, fmt.Errorf("cannot wrap %s: %s is not a function", name, ft)
+	}
+	if fv.IsNil() {
+		return nil, fmt.Errorf("cannot wrap %s: nil %s", name, ft)
+	}
+
+	for i := 0; i < ft.NumIn(); i++ {
+		in := ft.In(i)
+		if ft.IsVariadic() && i == ft.NumIn()-1 {
+			in = in.Elem()
+		}
+		if !isConvertibleType(in) {
+			return nil, fmt.Errorf("cannot wrap %s: unsupported parameter type %s", name, in)
+		}
+	}
+
+	switch ft.NumOut() {
+	case 0:
+	case 1:
+		if ft.Out(0) != errorType && !isConvertibleType(ft.Out(0)) {
+			return nil, fmt.Errorf("cannot wrap %s: unsupported result type %s", name, ft.Out(0))
+		}
+	case 2:
+		if !isConvertibleType(ft.Out(0)) || ft.Out(1) != errorType {
+			return nil, fmt.Errorf("cannot wrap %s: results must be (T, error)", name)
+		}
+	default:
+		return nil, fmt.Errorf("cannot wrap %s: too many results", name)
+	}
+
+	arity := ft.NumIn()
+	if ft.IsVariadic() {
+		arity = VariadicArity
+	}
+
+	call := func(ctx context.Context, env *Env, args ...Object) Object {
+		if ft.IsVariadic() && len(args) < ft.NumIn()-1 {
+			return newError("wrong number of arguments to %s: want at least %d, got %d", name, ft.NumIn()-1, len(args))
+		}
+
+		in := make([]reflect.Value, len(args))
+		for i, arg := range args {
+			var t reflect.Type
+			if ft.IsVariadic() && i >= ft.NumIn()-1 {
+				t = ft.In(ft.NumIn() - 1).Elem()
+			} else {
+				t = ft.In(i)
+			}
+
+			v, err := toGoValue(arg, t, nil)
+			if err != nil {
+				return newError("argument %d to %s: %s", i+1, name, err)
+			}
+			in[i] = v
+		}
+
+		out, panicked := callGo(name, fv, in)
+		if panicked != nil {
+			return panicked
+		}
+
+		if len(out) > 0 {
+			if last := out[len(out)-1]; last.Type() == errorType {
+				if !last.IsNil() {
+					return newError("%s: %s", name, last.Interface().(error))
+				}
+				out = out[:len(out)-1]
+			}
+		}
+
+		if len(out) == 0 {
+			return NULL
+		}
+
+		result, err := fromGoValue(out[0], nil)
+		if err != nil {
+			return newError("result of %s: %s", name, err)
+		}
+		return result
+	}
+
+	return &Builtin{Name: name, Fun: call, Arity: arity}, nil
+}
+
+// callGo calls fv with in, recovering a panic of the function as an Error
+// so that a faulty Go function fails the script instead of the program.
+func callGo(name string, fv reflect.Value, in []reflect.Value) (out []reflect.Value, err *Error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = newError("%s panicked: %v", name, r)
+		}
+	}()
+	return fv.Call(in), nil
+}
+
+// isConvertibleType reports whether values of type t can be converted to
+// and from Mash objects.
+func isConvertibleType(t reflect.Type) bool {
+	return convertibleType(t, make(map[reflect.Type]bool))
+}
+
+// convertibleType implements isConvertibleType. Types in seen are being
+// checked, and are assumed to be convertible so that recursive types such
+// as struct{ Next *Node } terminate.
+func convertibleType(t reflect.Type, seen map[reflect.Type]bool) bool {
+	if seen[t] {
+		return true
+	}
+	seen[t] = true
+
+	switch t {
+	case objectType, errorType, timeType, interfaceType:
+		return true
+	}
+
+	switch t.Kind() {
+	case reflect.Bool, reflect.String, reflect.Float32, reflect.Float64,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return true
+	case reflect.Ptr, reflect.Slice, reflect.Array:
+		return convertibleType(t.Elem(), seen)
+	case reflect.Map:
+		return convertibleType(t.Key(), seen) && convertibleType(t.Elem(), seen)
+	case reflect.Struct:
+		for _, field := range structFields(t) {
+			if !convertibleType(field.typ, seen) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
@@ -0,0 +1,97 @@
+package types
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// A FileSystem provides the files used by the fs builtins. Builtins never
+// call the os package directly, so hosts can substitute an in-memory or
+// otherwise restricted file system with WithFileSystem.
+type FileSystem interface {
+	Open(name string) (io.ReadCloser, error)
+	OpenFile(name string, flag int, perm fs.FileMode) (io.WriteCloser, error)
+	Stat(name string) (fs.FileInfo, error)
+	ReadDir(name string) ([]fs.DirEntry, error)
+	Glob(pattern string) ([]string, error)
+	MkdirAll(name string, perm fs.FileMode) error
+	Remove(name string) error
+}
+
+// A LinkFileSystem is a FileSystem with symbolic links. EvalSymlinks
+// returns name with its links resolved, as filepath.EvalSymlinks does.
+// Permission checks resolve the links of paths through it; on file systems
+// that do not implement it, paths are compared as written.
+type LinkFileSystem interface {
+	FileSystem
+	EvalSymlinks(name string) (string, error)
+}
+
+// WithFileSystem makes the fs builtins use fsys instead of the file system
+// of the operating system.
+func WithFileSystem(fsys FileSystem) Option {
+	return func(rt *runtime) {
+		rt.fs = fsys
+	}
+}
+
+// WithStdout makes print and other builtins writing to standard output
+// write to w instead.
+func WithStdout(w io.Writer) Option {
+	return func(rt *runtime) {
+		rt.stdout = w
+	}
+}
+
+// OSFileSystem is the FileSystem of the operating system.
+type OSFileSystem struct{}
+
+func (OSFileSystem) Open(name string) (io.ReadCloser, error) {
+	return os.Open(name)
+}
+
+func (OSFileSystem) OpenFile(name string, flag int, perm fs.FileMode) (io.WriteCloser, error) {
+	return os.OpenFile(name, flag, perm)
+}
+
+func (OSFileSystem) Stat(name string) (fs.FileInfo, error) {
+	return os.Stat(name)
+}
+
+func (OSFileSystem) ReadDir(name string) ([]fs.DirEntry, error) {
+	return os.ReadDir(name)
+}
+
+func (OSFileSystem) Glob(pattern string) ([]string, error) {
+	return filepath.Glob(pattern)
+}
+
+func (OSFileSystem) MkdirAll(name string, perm fs.FileMode) error {
+	return os.MkdirAll(name, perm)
+}
+
+func (OSFileSystem) Remove(name string) error {
+	return os.Remove(name)
+}
+
+func (OSFileSystem) EvalSymlinks(name string) (string, error) {
+	return filepath.EvalSymlinks(name)
+}
+
+// newIOError converts an error returned by a FileSystem into an Error whose
+// Kind tells the common failures apart.
+func newIOError(name string, err error) *Error {
+	kind := IO_ERROR
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		kind = NOT_FOUND_ERROR
+	case errors.Is(err, fs.ErrExist):
+		kind = ALREADY_EXISTS_ERROR
+	case errors.Is(err, fs.ErrPermission):
+		kind = ACCESS_DENIED_ERROR
+	}
+	return &Error{Kind: kind, Msg: name + ": " + err.Error()}
+}
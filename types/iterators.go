@@ -0,0 +1,523 @@
+package types
+
+import (
+	"context"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/gramidt/mash-lang-for-codemash/ast"
+)
+
+// iterHook is the name of the method a class defines to make its instances
+// iterable, returning an iterable.
+const iterHook = "__iter__"
+
+// iteratorFuns are the methods of Iterators and Generators. map, filter and
+// take are lazy: they return an Iterator calling the source only as values
+// are consumed.
+var iteratorFuns = []*Builtin{
+	{Name: "next", Fun: iterNext, Arity: 1},
+	{Name: "close", Fun: iterClose, Arity: 1},
+	{Name: "map", Fun: iterMap, Arity: 2},
+	{Name: "filter", Fun: iterFilter, Arity: 2},
+	{Name: "take", Fun: iterTake, Arity: 2},
+	{Name: "toArray", Fun: iterToArray, Arity: 1},
+}
+
+// iter is added to builtins by init, as the iterator functions call back into
+// the evaluator.
+func init() {
+	builtins["iter"] = &Builtin{Name: "iter", Fun: iterBuiltin, Arity: 1}
+}
+
+// An Iterator produces the values of an Array, Map, String, Generator or
+// iterator object one at a time, see iterate.
+type Iterator struct {
+	next  func(ctx context.Context) (value Object, done bool, err *Error)
+	close func()
+}
+
+func (it *Iterator) Type() ObjType   { return ITERATOR_OBJ }
+func (it *Iterator) Inspect() string { return "<iterator>" }
+func (it *Iterator) IsTruthy() bool  { return true }
+
+// A Generator is returned by calling a function that yields. Its body runs
+// in a goroutine of its own, suspended at each yield until the next value is
+// asked for. The goroutine exits when the body returns, or else when the
+// Generator is closed, its context is done or the outermost Eval returns.
+type Generator struct {
+	Name string
+	gen  *generator
+}
+
+func (g *Generator) Type() ObjType   { return GENERATOR_OBJ }
+func (g *Generator) Inspect() string { return "<generator " + g.Name + ">" }
+func (g *Generator) IsTruthy() bool  { return true }
+
+// A generator is the state shared by a Generator and the goroutine running
+// its body. The goroutine runs from the first call of next until the body
+// returns or the generator is closed, which the outermost Eval does for the
+// generators still suspended when it returns.
+type generator struct {
+	name string
+	fun  *Fun
+	env  *Env // the Env of the call, with the parameters bound
+
+	mu       sync.Mutex
+	started  bool
+	running  bool
+	finished bool
+
+	resume    chan struct{}  // asks the body for its next value
+	results   chan genResult // values yielded, then the end of the body
+	done      chan struct{}  // closed to stop the body
+	exited    chan struct{}  // closed once the goroutine returns
+	closeOnce sync.Once
+}
+
+type genResult struct {
+	value Object
+	done  bool
+}
+
+type generatorKey struct{}
+
+func newGenerator(name string, fun *Fun, env *Env) Object {
+	g := &Generator{Name: name, gen: &generator{
+		name:    name,
+		fun:     fun,
+		env:     env,
+		resume:  make(chan struct{}),
+		results: make(chan genResult),
+		done:    make(chan struct{}),
+		exited:  make(chan struct{}),
+	}}
+	return env.rt.track(g)
+}
+
+// next resumes the body until it yields a value or returns.
+func (g *generator) next(ctx context.Context) (Object, bool, *Error) {
+	g.mu.Lock()
+	if g.running {
+		g.mu.Unlock()
+		return nil, false, newError("generator %s is already running", g.name)
+	}
+	if g.finished {
+		g.mu.Unlock()
+		return NULL, true, nil
+	}
+	g.running = true
+	started := g.started
+	g.started = true
+	g.mu.Unlock()
+
+	value, done, err := g.step(ctx, started)
+
+	g.mu.Lock()
+	g.running = false
+	g.mu.Unlock()
+	if done || err != nil {
+		g.close()
+	}
+	return value, done, err
+}
+
+func (g *generator) step(ctx context.Context, started bool) (Object, bool, *Error) {
+	if !started {
+		g.env.rt.generators[g] = struct{}{}
+		go g.run(ctx)
+	} else {
+		select {
+		case g.resume <- struct{}{}:
+		case <-ctx.Done():
+			return nil, false, contextError(ctx.Err())
+		}
+	}
+
+	select {
+	case result := <-g.results:
+		if err, ok := result.value.(*Error); ok {
+			return nil, true, err
+		}
+		return result.value, result.done, nil
+	case <-ctx.Done():
+		return nil, false, contextError(ctx.Err())
+	}
+}
+
+// run evaluates the body with a call stack of its own, on top of the calls
+// of the first caller of next.
+func (g *generator) run(ctx context.Context) {
+	defer close(g.exited)
+
+	ctx = context.WithValue(ctx, callStackKey{}, &callStack{base: depth(ctx)})
+	ctx = context.WithValue(ctx, generatorKey{}, g)
+
+	var result Object = NULL
+	ctx, err := g.env.rt.pushFrame(ctx, g.name, g.env)
+	if err != nil {
+		result = err
+	} else {
+		if evaluated, ok := eval(ctx, g.fun.Body, g.env).(*Error); ok {
+			result = evaluated
+		}
+		g.env.rt.popFrame(ctx)
+	}
+
+	select {
+	case g.results <- genResult{value: result, done: true}:
+	case <-g.done:
+	case <-ctx.Done():
+	}
+}
+
+// yield hands value to the caller of next and waits to be resumed.
+func (g *generator) yield(ctx context.Context, value Object) Object {
+	select {
+	case g.results <- genResult{value: value}:
+	case <-g.done:
+		return newError("generator %s closed", g.name)
+	case <-ctx.Done():
+		return contextError(ctx.Err())
+	}
+
+	select {
+	case <-g.resume:
+		return NULL
+	case <-g.done:
+		return newError("generator %s closed", g.name)
+	case <-ctx.Done():
+		return contextError(ctx.Err())
+	}
+}
+
+// close stops the body at its current yield, if it is suspended there.
+func (g *generator) close() {
+	g.closeOnce.Do(func() { close(g.done) })
+	g.mu.Lock()
+	g.finished = true
+	g.mu.Unlock()
+}
+
+// closeGenerators closes the generators of rt whose bodies have started and
+// waits for their goroutines to return.
+func (rt *runtime) closeGenerators() {
+	for g := range rt.generators {
+		g.close()
+		<-g.exited
+		delete(rt.generators, g)
+	}
+}
+
+func evalYieldExpr(ctx context.Context, node *ast.YieldExpr, env *Env) Object {
+	value := eval(ctx, node.Value, env)
+	if isError(value) {
+		return value
+	}
+	if value == nil {
+		value = NULL
+	}
+
+	g, ok := ctx.Value(generatorKey{}).(*generator)
+	if !ok || g == nil {
+		return newError("yield outside of a generator")
+	}
+	return g.yield(ctx, value)
+}
+
+// evalForStmt evaluates the body of a loop once for each value of an
+// iterable, with the names of the pattern bound to the value.
+func evalForStmt(ctx context.Context, node *ast.ForStmt, env *Env) Object {
+	iterable := eval(ctx, node.Iter, env)
+	if isError(iterable) {
+		return iterable
+	}
+
+	it, err := iterate(ctx, env, iterable)
+	if err != nil {
+		return err
+	}
+	defer it.close()
+
+	for {
+		if err := env.rt.step(ctx); err != nil {
+			return err
+		}
+
+		value, done, err := it.next(ctx)
+		if err != nil {
+			return err
+		}
+		if done {
+			return nil
+		}
+
+		loopEnv := NewEnclosedEnv(env)
+		if err := bindPattern(ctx, node.Pattern, value, loopEnv); err != nil {
+			return err
+		}
+
+		result := eval(ctx, node.Body, loopEnv)
+		if result != nil && (result.Type() == RETURN_VALUE_OBJ || result.Type() == ERROR_OBJ) {
+			return result
+		}
+	}
+}
+
+// iterate returns an Iterator over the values of obj: the elements of an
+// Array, the Ints of a Range, the [key, value] pairs of a Map in key order,
+// the characters of a String, the values received from a Channel until it is
+// closed, the values of an Iterator or Generator, or those of an instance
+// whose class defines __iter__, returning an iterable, or a next method
+// returning a map of value and done like the next method of Iterators.
+func iterate(ctx context.Context, env *Env, obj Object) (*Iterator, *Error) {
+	noop := func() {}
+
+	switch obj := obj.(type) {
+	case *Iterator:
+		return obj, nil
+
+	case *Generator:
+		return &Iterator{
+			next:  func(ctx context.Context) (Object, bool, *Error) { return obj.gen.next(ctx) },
+			close: func() { obj.gen.close() },
+		}, nil
+
+	case *Array:
+		i := 0
+		return &Iterator{next: func(ctx context.Context) (Object, bool, *Error) {
+			if i >= len(obj.Elems) {
+				return NULL, true, nil
+			}
+			i++
+			return obj.Elems[i-1], false, nil
+		}, close: noop}, nil
+
+	case *Range:
+		var i uint64
+		return &Iterator{next: func(ctx context.Context) (Object, bool, *Error) {
+			if i >= obj.n {
+				return NULL, true, nil
+			}
+			i++
+			return obj.at(i - 1), false, nil
+		}, close: noop}, nil
+
+	case *String:
+		s := obj.Value
+		return &Iterator{next: func(ctx context.Context) (Object, bool, *Error) {
+			if s == "" {
+				return NULL, true, nil
+			}
+			_, size := utf8.DecodeRuneInString(s)
+			char := &String{Value: s[:size]}
+			s = s[size:]
+			return char, false, nil
+		}, close: noop}, nil
+
+	case *Map:
+		pairs := obj.SortedPairs()
+		return &Iterator{next: func(ctx context.Context) (Object, bool, *Error) {
+			if len(pairs) == 0 {
+				return NULL, true, nil
+			}
+			pair := env.rt.track(&Array{Elems: []Object{pairs[0].Key, pairs[0].Value}})
+			if err, ok := pair.(*Error); ok {
+				return nil, false, err
+			}
+			pairs = pairs[1:]
+			return pair, false, nil
+		}, close: noop}, nil
+
+	case *Channel:
+		return &Iterator{next: func(ctx context.Context) (Object, bool, *Error) {
+			value, ok, err := obj.recv(ctx, env.rt.sched)
+			return value, !ok && err == nil, err
+		}, close: noop}, nil
+
+	case *Instance:
+		if result, ok := callHook(ctx, env, obj, iterHook); ok {
+			if err, ok := result.(*Error); ok {
+				return nil, err
+			}
+			if inst, ok := result.(*Instance); ok && inst == obj {
+				return instanceIterator(env, inst)
+			}
+			return iterate(ctx, env, result)
+		}
+		return instanceIterator(env, obj)
+	}
+
+	return nil, newError("cannot iterate over %s", obj.Type().String())
+}
+
+// instanceIterator returns an Iterator calling the next method of inst.
+func instanceIterator(env *Env, inst *Instance) (*Iterator, *Error) {
+	method, owner, ok := inst.Class.findMethod("next")
+	if !ok {
+		return nil, newError("cannot iterate over %s: it has no next or __iter__ method", inst.Class.Name)
+	}
+	next := bindMethod(inst, method, owner)
+	name := inst.Class.Name + ".next"
+
+	return &Iterator{next: func(ctx context.Context) (Object, bool, *Error) {
+		result := applyFunction(ctx, env, name, next, nil)
+		if err, ok := result.(*Error); ok {
+			return nil, false, err
+		}
+		if result == nil || !hasFields(result) {
+			return nil, false, newError("%s must return a map of value and done", name)
+		}
+		if done, ok := fieldOf(result, "done"); ok && done.IsTruthy() {
+			return NULL, true, nil
+		}
+		value, ok := fieldOf(result, "value")
+		if !ok {
+			value = NULL
+		}
+		return value, false, nil
+	}, close: func() {}}, nil
+}
+
+// iterResult returns the result of the next method of iterators.
+func iterResult(value Object, done bool, env *Env) Object {
+	m := NewMap()
+	m.Set(&String{Value: "value"}, value)
+	m.Set(&String{Value: "done"}, nativeBool(done))
+	return env.rt.track(m)
+}
+
+// iterBuiltin returns an Iterator over the values of an iterable.
+func iterBuiltin(ctx context.Context, env *Env, args ...Object) Object {
+	if _, ok := args[0].(*Generator); ok {
+		return args[0]
+	}
+	it, err := iterate(ctx, env, args[0])
+	if err != nil {
+		return err
+	}
+	return env.rt.track(it)
+}
+
+// iterNext returns the next value of an iterator as {value, done}.
+func iterNext(ctx context.Context, env *Env, args ...Object) Object {
+	it, err := iterate(ctx, env, args[0])
+	if err != nil {
+		return err
+	}
+	value, done, err := it.next(ctx)
+	if err != nil {
+		return err
+	}
+	return iterResult(value, done, env)
+}
+
+// iterClose stops an iterator, so that it produces no more values.
+func iterClose(ctx context.Context, env *Env, args ...Object) Object {
+	it, err := iterate(ctx, env, args[0])
+	if err != nil {
+		return err
+	}
+	it.close()
+	return NULL
+}
+
+func iterMap(ctx context.Context, env *Env, args ...Object) Object {
+	it, err := iterate(ctx, env, args[0])
+	if err != nil {
+		return err
+	}
+
+	return env.rt.track(&Iterator{next: func(ctx context.Context) (Object, bool, *Error) {
+		value, done, err := it.next(ctx)
+		if done || err != nil {
+			return value, done, err
+		}
+		result := applyFunction(ctx, env, "map", args[1], []Object{value})
+		if err, ok := result.(*Error); ok {
+			return nil, false, err
+		}
+		if result == nil {
+			result = NULL
+		}
+		return result, false, nil
+	}, close: it.close})
+}
+
+func iterFilter(ctx context.Context, env *Env, args ...Object) Object {
+	it, err := iterate(ctx, env, args[0])
+	if err != nil {
+		return err
+	}
+
+	return env.rt.track(&Iterator{next: func(ctx context.Context) (Object, bool, *Error) {
+		for {
+			value, done, err := it.next(ctx)
+			if done || err != nil {
+				return value, done, err
+			}
+			ok, err := callPredicate(ctx, env, "filter", args[1], value)
+			if err != nil {
+				return nil, false, err
+			}
+			if ok {
+				return value, false, nil
+			}
+		}
+	}, close: it.close})
+}
+
+// iterTake returns an Iterator over the first n values of an iterator,
+// closing it after the last one.
+func iterTake(ctx context.Context, env *Env, args ...Object) Object {
+	it, err := iterate(ctx, env, args[0])
+	if err != nil {
+		return err
+	}
+	n, err := intArg("take", args, 1)
+	if err != nil {
+		return err
+	}
+
+	return env.rt.track(&Iterator{next: func(ctx context.Context) (Object, bool, *Error) {
+		if n <= 0 {
+			it.close()
+			return NULL, true, nil
+		}
+		n--
+		return it.next(ctx)
+	}, close: it.close})
+}
+
+// maxArrayLength is the number of elements of the longest Array toArray
+// collects, whether or not a memory limit is set, so that a script cannot
+// make the host run out of memory collecting an endless iterator.
+const maxArrayLength = 1 << 24
+
+// iterToArray consumes an iterator, returning its values.
+func iterToArray(ctx context.Context, env *Env, args ...Object) Object {
+	it, err := iterate(ctx, env, args[0])
+	if err != nil {
+		return err
+	}
+	defer it.close()
+
+	elems := []Object{}
+	defer env.rt.mem.pin(&elems)()
+	for {
+		if err := env.rt.step(ctx); err != nil {
+			return err
+		}
+		value, done, err := it.next(ctx)
+		if err != nil {
+			return err
+		}
+		if done {
+			return env.rt.track(&Array{Elems: elems})
+		}
+		if len(elems) == maxArrayLength {
+			return newError("toArray: more than %d elements", maxArrayLength)
+		}
+		elems = append(elems, value)
+	}
+}
@@ -0,0 +1,98 @@
+package types
+
+import (
+	goruntime "runtime"
+	"testing"
+)
+
+func TestForIn(t *testing.T) {
+	runEvalTests(t, []evalTest{
+		{"array", `var total = 0
+for (x in [1, 2, 3]) { total = total + x }
+total`, "6", ""},
+		{"map", `var keys = ""
+for ([k, v] in {"b": 2, "a": 1}) { keys = keys + format("%s%d", k, v) }
+keys`, "a1b2", ""},
+		{"string", `var out = []
+for (c in "héllo") { out = append(out, c) }
+out`, "[h, é, l, l, o]", ""},
+		{"range", `var total = 0
+for (i in range(4)) { total = total + i }
+total`, "6", ""},
+		{"destructuring", `var total = 0
+for ({x, y} in [{"x": 1, "y": 2}, {"x": 3, "y": 4}]) { total = total + x * y }
+total`, "14", ""},
+		{"loop variables are local", `var x = "outer"
+for (x in [1]) {}
+x`, "outer", ""},
+		{"trailing semicolon", `var total = 0; for (i in range(3)) { total = total + i }; total`, "3", ""},
+		{"no iterations", `for (x in []) { missing }
+"done"`, "done", ""},
+
+		{"not iterable", `for (x in 5) {}`, "", "cannot iterate over INT"},
+		{"body error", `for (x in [1]) { x + "a" }`, "", "invalid operation: INT + STRING"},
+	})
+}
+
+func TestGenerators(t *testing.T) {
+	runEvalTests(t, []evalTest{
+		{"yield", `var count = fun(n) { for (i in range(n)) { yield i } }
+var out = []
+for (x in count(3)) { out = append(out, x) }
+out`, "[0, 1, 2]", ""},
+		{"next", `var g = fun() { yield 1; yield 2 }
+var it = g();
+[it.next(), it.next(), it.next()]`, "[{done: false, value: 1}, {done: false, value: 2}, {done: true, value: null}]", ""},
+		{"lazy infinite generator", `var nat = fun(n) { yield n; for (x in nat(n + 1)) { yield x } }
+nat(0).map(fun(x) { x * x }).filter(fun(x) { x % 2 == 1 }).take(3).toArray()`, "[1, 9, 25]", ""},
+		{"close", `var g = fun() { yield 1; yield 2 }
+var it = g()
+it.next()
+it.close();
+[it.next().done, it.toArray()]`, "[true, []]", ""},
+		{"body runs on demand", `var g = fun() { print("started"); yield 1 }
+var it = g()
+"not started"`, "not started", ""},
+		{"iter", `var it = iter([1, 2]);
+[it.next().value, it.toArray()]`, "[1, [2]]", ""},
+		{"class with __iter__", `class Pair {
+	init(a, b) { self.a = a; self.b = b }
+	__iter__() { [self.a, self.b] }
+}
+var out = []
+for (x in Pair(1, 2)) { out = append(out, x) }
+out`, "[1, 2]", ""},
+		{"class with next", `class Countdown {
+	init(n) { self.n = n }
+	next() { self.n = self.n - 1; {"value": self.n + 1, "done": self.n < 0} }
+}
+iter(Countdown(3)).toArray()`, "[3, 2, 1]", ""},
+
+		{"generator error", `var g = fun() { yield 1; missing }
+g().toArray()`, "", "invalid identifier: missing"},
+		{"class without next", `class A {}
+for (x in A()) {}`, "", "cannot iterate over A: it has no next or __iter__ method"},
+		{"bad next result", `class A { next() { 1 } }
+iter(A()).toArray()`, "", "A.next must return a map of value and done"},
+	})
+}
+
+func TestSuspendedGeneratorsAreClosed(t *testing.T) {
+	before := goruntime.NumGoroutine()
+	env := NewEnv()
+	src := `var g = fun() { yield 1; yield 2 }
+var its = []
+for (i in range(10)) { var it = g(); it.next(); its = append(its, it) }
+len(its)`
+	if result := evalSource(t, src, env); result.Inspect() != "10" {
+		t.Fatalf("Eval = %s, want 10", result.Inspect())
+	}
+	// Eval waits for the bodies of the generators to return, so no
+	// goroutine is left even though the generators are still reachable.
+	if n := goruntime.NumGoroutine(); n > before {
+		t.Errorf("%d goroutines left running", n-before)
+	}
+	if result := evalSource(t, `its[0].next().done`, env); result != TRUE {
+		t.Errorf("next of a closed generator = %s, want done", result.Inspect())
+	}
+}
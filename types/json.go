@@ -0,0 +1,219 @@
+package types
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+var jsonModule = newNamespace("json",
+	&Builtin{Name: "parse", Fun: jsonParse, Arity: 1},
+	&Builtin{Name: "stringify", Fun: jsonStringify, Arity: VariadicArity},
+)
+
+// jsonParse decodes a JSON document into Maps, Arrays, Strings, Ints,
+// Floats, Bools and null. Numbers without a fraction or exponent become
+// Ints when they fit.
+func jsonParse(ctx context.Context, env *Env, args ...Object) Object {
+	str, ok := args[0].(*String)
+	if !ok {
+		return newError("argument to json.parse must be STRING, got %s", args[0].Type().String())
+	}
+
+	dec := json.NewDecoder(strings.NewReader(str.Value))
+	dec.UseNumber()
+
+	value, err := decodeJSON(dec, env)
+	if err != nil {
+		return newError("json.parse: %s", err)
+	}
+
+	if _, err := dec.Token(); err != io.EOF {
+		return newError("json.parse: unexpected data after top-level value")
+	}
+
+	return value
+}
+
+func decodeJSON(dec *json.Decoder, env *Env) (Object, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	switch tok := tok.(type) {
+	case nil:
+		return NULL, nil
+	case bool:
+		return nativeBool(tok), nil
+	case string:
+		return env.rt.track(&String{Value: tok}), nil
+	case json.Number:
+		if i, err := strconv.ParseInt(tok.String(), 10, 64); err == nil {
+			return &Int{Value: i}, nil
+		}
+		f, err := tok.Float64()
+		if err != nil {
+			return nil, err
+		}
+		return &Float{Value: f}, nil
+	case json.Delim:
+		if tok == '[' {
+			arr := &Array{Elems: []Object{}}
+			for dec.More() {
+				elem, err := decodeJSON(dec, env)
+				if err != nil {
+					return nil, err
+				}
+				arr.Elems = append(arr.Elems, elem)
+			}
+			_, err := dec.Token()
+			return env.rt.track(arr), err
+		}
+
+		m := NewMap()
+		for dec.More() {
+			key, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			value, err := decodeJSON(dec, env)
+			if err != nil {
+				return nil, err
+			}
+			m.Set(&String{Value: key.(string)}, value)
+		}
+		_, err := dec.Token()
+		return env.rt.track(m), err
+	}
+
+	return nil, fmt.Errorf("unexpected token %v", tok)
+}
+
+// maxJSONIndent is the largest number of spaces json.stringify indents by,
+// and the length of the longest String it indents with.
+const maxJSONIndent = 10
+
+// jsonStringify encodes a value as JSON with map keys in sorted order. The
+// optional second argument indents nested values by that many spaces, or
+// by the given String.
+func jsonStringify(ctx context.Context, env *Env, args ...Object) Object {
+	if len(args) != 1 && len(args) != 2 {
+		return newError("wrong number of arguments to json.stringify: want 1 or 2, got %d", len(args))
+	}
+
+	var buf bytes.Buffer
+	if err := encodeJSON(&buf, args[0], nil); err != nil {
+		return err
+	}
+
+	if len(args) == 2 {
+		var indent string
+		switch arg := args[1].(type) {
+		case *Int:
+			if arg.Value < 0 || arg.Value > maxJSONIndent {
+				return newError("indent passed to json.stringify must be between 0 and %d, got %d", maxJSONIndent, arg.Value)
+			}
+			indent = strings.Repeat(" ", int(arg.Value))
+		case *String:
+			if len(arg.Value) > maxJSONIndent {
+				return newError("indent passed to json.stringify must be at most %d bytes long, got %d", maxJSONIndent, len(arg.Value))
+			}
+			indent = arg.Value
+		default:
+			return newError("indent argument to json.stringify must be INT or STRING, got %s", arg.Type().String())
+		}
+
+		var indented bytes.Buffer
+		if err := json.Indent(&indented, buf.Bytes(), "", indent); err != nil {
+			return newError("json.stringify: %s", err)
+		}
+		buf = indented
+	}
+
+	return env.rt.track(&String{Value: buf.String()})
+}
+
+// encodeJSON writes obj to buf as JSON. seen holds the Arrays and Maps being
+// encoded, so that cyclic values fail instead of recursing forever.
+func encodeJSON(buf *bytes.Buffer, obj Object, seen map[Object]bool) *Error {
+	switch obj.(type) {
+	case *Array, *Map:
+		if seen[obj] {
+			return newError("json.stringify: cannot serialize a cyclic value")
+		}
+		if seen == nil {
+			seen = make(map[Object]bool)
+		}
+		seen[obj] = true
+		defer delete(seen, obj)
+	}
+
+	switch obj := obj.(type) {
+	case *Null:
+		buf.WriteString("null")
+	case *Bool:
+		buf.WriteString(strconv.FormatBool(obj.Value))
+	case *Int:
+		buf.WriteString(strconv.FormatInt(obj.Value, 10))
+	case *Float:
+		if math.IsInf(obj.Value, 0) || math.IsNaN(obj.Value) {
+			return newError("json.stringify: cannot serialize %s", obj.Inspect())
+		}
+		buf.WriteString(strconv.FormatFloat(obj.Value, 'g', -1, 64))
+	case *String:
+		encodeJSONString(buf, obj.Value)
+	case *Array:
+		buf.WriteByte('[')
+		for i, elem := range obj.Elems {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := encodeJSON(buf, elem, seen); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+	case *Map:
+		buf.WriteByte('{')
+		// Keys of different types, such as 1 and "1", may have the same
+		// encoding, which would make the object ambiguous.
+		keys := make(map[string]Object, len(obj.Pairs))
+		for i, pair := range obj.SortedPairs() {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			switch pair.Key.(type) {
+			case *String, *Int, *Bool:
+			default:
+				return newError("json.stringify: cannot serialize map key of type %s", pair.Key.Type().String())
+			}
+			key := pair.Key.Inspect()
+			if other, ok := keys[key]; ok {
+				return newError("json.stringify: map keys of type %s and %s both serialize as %q", other.Type().String(), pair.Key.Type().String(), key)
+			}
+			keys[key] = pair.Key
+			encodeJSONString(buf, key)
+			buf.WriteByte(':')
+			if err := encodeJSON(buf, pair.Value, seen); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('}')
+	default:
+		return newError("json.stringify: cannot serialize %s", obj.Type().String())
+	}
+
+	return nil
+}
+
+func encodeJSONString(buf *bytes.Buffer, s string) {
+	// Marshaling a string cannot fail.
+	b, _ := json.Marshal(s)
+	buf.Write(b)
+}
@@ -0,0 +1,29 @@
+package types
+
+import "testing"
+
+func TestJSON(t *testing.T) {
+	runEvalTests(t, []evalTest{
+		{"parse", `json.parse("{\"b\": [1, 2.5, true, null], \"a\": \"x\"}")`, "{a: x, b: [1, 2.5, true, null]}", ""},
+		{"parse float", `json.parse("12345678901234567890") == 12345678901234567890.0`, "true", ""},
+		{"stringify", `json.stringify({"b": [1, 2.5, true], "a": "x"})`, `{"a":"x","b":[1,2.5,true]}`, ""},
+		{"indent", `json.stringify({"a": [1]}, 2)`, "{\n  \"a\": [\n    1\n  ]\n}", ""},
+		{"indent string", `json.stringify([1], "\t")`, "[\n\t1\n]", ""},
+		{"non-string keys", `json.stringify({1: "a", true: "b"})`, `{"true":"b","1":"a"}`, ""},
+		{"escapes", `json.stringify("a\"b\\c\n")`, `"a\"b\\c\n"`, ""},
+		{"round trip", `var s = json.stringify({"n": [1, {"m": "é\n"}], "f": 1.5, "t": false})
+json.stringify(json.parse(s)) == s`, "true", ""},
+
+		{"invalid", `json.parse("{")`, "", "json.parse: unexpected end of JSON input"},
+		{"trailing data", `json.parse("1 2")`, "", "json.parse: unexpected data after top-level value"},
+		{"parse non-string", `json.parse(1)`, "", "argument to json.parse must be STRING, got INT"},
+		{"function", `json.stringify([fun() {}])`, "", "json.stringify: cannot serialize FUNCTION"},
+		{"builtin", `json.stringify(print)`, "", "json.stringify: cannot serialize BUILTIN"},
+		{"indent type", `json.stringify(1, true)`, "", "indent argument to json.stringify must be INT or STRING, got BOOL"},
+		{"negative indent", `json.stringify(1, -1)`, "", "indent passed to json.stringify must be between 0 and 10, got -1"},
+		{"large indent", `json.stringify(1, 11)`, "", "indent passed to json.stringify must be between 0 and 10, got 11"},
+		{"long indent", `json.stringify(1, "            ")`, "", "indent passed to json.stringify must be at most 10 bytes long, got 12"},
+		{"cycle", "var m = {}\nm[\"self\"] = m\njson.stringify(m)", "", "json.stringify: cannot serialize a cyclic value"},
+		{"colliding keys", `json.stringify({1: "a", "1": "b"})`, "", `json.stringify: map keys of type INT and STRING both serialize as "1"`},
+	})
+}
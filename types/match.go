@@ -0,0 +1,374 @@
+package types
+
+import (
+	"context"
+
+	"github.com/gramidt/mash-lang-for-codemash/ast"
+)
+
+// patternTypes are the type names usable in type patterns, such as n: Int.
+var patternTypes = map[string][]ObjType{
+	"Null":      {NULL_OBJ},
+	"Bool":      {BOOL_OBJ},
+	"Int":       {INT_OBJ},
+	"Float":     {FLOAT_OBJ},
+	"Number":    {INT_OBJ, FLOAT_OBJ},
+	"String":    {STRING_OBJ},
+	"Array":     {ARRAY_OBJ},
+	"Map":       {MAP_OBJ},
+	"Function":  {FUN_OBJ, BUILTIN_OBJ},
+	"Regex":     {REGEX_OBJ},
+	"Namespace": {NAMESPACE_OBJ},
+}
+
+// evalMatchExpr evaluates the body of the first arm whose pattern matches
+// the subject and whose guard, if any, is truthy. The names bound by the
+// pattern are only visible to the guard and body of their arm.
+func evalMatchExpr(ctx context.Context, node *ast.MatchExpr, env *Env) Object {
+	subject := eval(ctx, node.Subject, env)
+	if isError(subject) {
+		return subject
+	}
+	if subject == nil {
+		subject = NULL
+	}
+
+	for _, arm := range node.Arms {
+		armEnv := NewEnclosedEnv(env)
+
+		ok, err := matchPattern(ctx, arm.Pattern, subject, armEnv)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+
+		if arm.Guard != nil {
+			guard := eval(ctx, arm.Guard, armEnv)
+			if isError(guard) {
+				return guard
+			}
+			if guard == nil || !guard.IsTruthy() {
+				continue
+			}
+		}
+
+		result := eval(ctx, arm.Body, armEnv)
+		if result == nil {
+			return NULL
+		}
+		return result
+	}
+
+	return newError("no match arm matched %s", subject.Inspect())
+}
+
+// matchPattern reports whether value matches pattern, binding the names of
+// the pattern to the parts of value they match in env.
+func matchPattern(ctx context.Context, pattern ast.Pattern, value Object, env *Env) (bool, *Error) {
+	switch pattern := pattern.(type) {
+	case *ast.WildcardPattern:
+		return true, nil
+
+	case *ast.BindingPattern:
+		if unit, ok := unitVariant(pattern.Name.Value, env); ok {
+			return value == unit, nil
+		}
+		if err, ok := env.Set(pattern.Name.Value, value).(*Error); ok {
+			return false, err
+		}
+		return true, nil
+
+	case *ast.LiteralPattern:
+		literal := eval(ctx, pattern.Value, env)
+		if err, ok := literal.(*Error); ok {
+			return false, err
+		}
+		return objectsEqual(literal, value)
+
+	case *ast.ArrayPattern:
+		arr, ok := value.(*Array)
+		if !ok || len(arr.Elems) < len(pattern.Elems) || pattern.Rest == nil && len(arr.Elems) != len(pattern.Elems) {
+			return false, nil
+		}
+		for i, elem := range pattern.Elems {
+			if ok, err := matchPattern(ctx, elem, arr.Elems[i], env); !ok || err != nil {
+				return false, err
+			}
+		}
+		if pattern.Rest != nil {
+			rest := env.rt.track(&Array{Elems: append([]Object{}, arr.Elems[len(pattern.Elems):]...)})
+			if err, ok := rest.(*Error); ok {
+				return false, err
+			}
+			return matchPattern(ctx, pattern.Rest, rest, env)
+		}
+		return true, nil
+
+	case *ast.MapPattern:
+		if !hasFields(value) {
+			return false, nil
+		}
+		for i, key := range pattern.Keys {
+			elem, ok := fieldOf(value, key)
+			if !ok {
+				return false, nil
+			}
+			if ok, err := matchPattern(ctx, pattern.Values[i], elem, env); !ok || err != nil {
+				return false, err
+			}
+		}
+		return true, nil
+
+	case *ast.TypePattern:
+		ok, err := hasType(value, pattern.Type.Value, env)
+		if !ok || err != nil {
+			return false, err
+		}
+		return matchPattern(ctx, pattern.Pattern, value, env)
+
+	case *ast.ConstructorPattern:
+		return matchConstructor(ctx, pattern, value, env)
+	}
+
+	return false, newError("unknown pattern: %s", pattern.TokenLit())
+}
+
+// objectsEqual reports whether a and b are equal the way == compares them:
+// numbers, Strings and Bools by value, Records and EnumValues by type and
+// fields, and everything else by identity. Comparing values that contain
+// themselves, or are nested deeper than maxCompareDepth, fails.
+func objectsEqual(a, b Object) (bool, *Error) {
+	return equalIn(a, b, nil)
+}
+
+// maxCompareDepth is the deepest nesting of Records and EnumValues that
+// objectsEqual compares, so that comparing deeply nested values fails with an
+// Error instead of exhausting the Go stack.
+const maxCompareDepth = 10000
+
+// An objectPair is a pair of values being compared.
+type objectPair struct{ a, b Object }
+
+// equalIn compares a and b for objectsEqual. seen holds the pairs of
+// Records and EnumValues being compared.
+func equalIn(a, b Object, seen map[objectPair]bool) (bool, *Error) {
+	var x, y []Object
+	switch a := a.(type) {
+	case *EnumValue:
+		b, ok := b.(*EnumValue)
+		if !ok || a.Variant != b.Variant {
+			return false, nil
+		}
+		x, y = a.Values, b.Values
+	case *Record:
+		b, ok := b.(*Record)
+		if !ok || a.RecordType != b.RecordType {
+			return false, nil
+		}
+		x, y = a.Values, b.Values
+	case *String:
+		b, ok := b.(*String)
+		return ok && a.Value == b.Value, nil
+	case *Bool:
+		b, ok := b.(*Bool)
+		return ok && a.Value == b.Value, nil
+	case *Int:
+		if b, ok := b.(*Int); ok {
+			return a.Value == b.Value, nil
+		}
+		y, ok := toFloat(b)
+		return ok && float64(a.Value) == y, nil
+	case *Float:
+		x, _ := toFloat(a)
+		y, ok := toFloat(b)
+		return ok && x == y, nil
+	default:
+		return a == b, nil
+	}
+
+	pair := objectPair{a, b}
+	if seen[pair] {
+		return false, newError("cannot compare cyclic values")
+	}
+	if len(seen) >= maxCompareDepth {
+		return false, newError("cannot compare values nested deeper than %d", maxCompareDepth)
+	}
+	if seen == nil {
+		seen = make(map[objectPair]bool)
+	}
+	seen[pair] = true
+	defer delete(seen, pair)
+
+	for i := range x {
+		if equal, err := equalIn(x[i], y[i], seen); !equal || err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// bindPattern binds the names of pattern to the parts of value in env for a
+// destructuring declaration or parameter. Unlike matchPattern it fails with
+// an Error describing where value does not have the shape of pattern.
+func bindPattern(ctx context.Context, pattern ast.Pattern, value Object, env *Env) *Error {
+	switch pattern := pattern.(type) {
+	case *ast.BindingPattern:
+		// A name always declares a variable here, even one naming a unit
+		// variant, which only match arms compare against.
+		if err, ok := env.Set(pattern.Name.Value, value).(*Error); ok {
+			return err
+		}
+		return nil
+
+	case *ast.ArrayPattern:
+		arr, ok := value.(*Array)
+		if !ok {
+			return newError("cannot destructure %s as ARRAY", value.Type().String())
+		}
+		if pattern.Rest == nil && len(arr.Elems) != len(pattern.Elems) {
+			return newError("cannot destructure ARRAY of %d elements into %d names", len(arr.Elems), len(pattern.Elems))
+		}
+		if len(arr.Elems) < len(pattern.Elems) {
+			return newError("cannot destructure ARRAY of %d elements into at least %d names", len(arr.Elems), len(pattern.Elems))
+		}
+
+		for i, elem := range pattern.Elems {
+			if err := bindPattern(ctx, elem, arr.Elems[i], env); err != nil {
+				return err
+			}
+		}
+		if pattern.Rest != nil {
+			rest := env.rt.track(&Array{Elems: append([]Object{}, arr.Elems[len(pattern.Elems):]...)})
+			if err, ok := rest.(*Error); ok {
+				return err
+			}
+			return bindPattern(ctx, pattern.Rest, rest, env)
+		}
+		return nil
+
+	case *ast.MapPattern:
+		if !hasFields(value) {
+			return newError("cannot destructure %s as MAP", value.Type().String())
+		}
+		for i, key := range pattern.Keys {
+			elem, ok := fieldOf(value, key)
+			if !ok {
+				return newError("cannot destructure %s without key %q", value.Type().String(), key)
+			}
+			if err := bindPattern(ctx, pattern.Values[i], elem, env); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case *ast.TypePattern:
+		ok, err := hasType(value, pattern.Type.Value, env)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return newError("cannot destructure %s as %s", value.Type().String(), pattern.Type.Value)
+		}
+		return bindPattern(ctx, pattern.Pattern, value, env)
+	}
+
+	ok, err := matchPattern(ctx, pattern, value, env)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return newError("cannot destructure %s: it does not match %s", value.Inspect(), pattern.TokenLit())
+	}
+	return nil
+}
+
+// patternNames returns the names bound by pattern, in order.
+func patternNames(pattern ast.Pattern) []string {
+	switch pattern := pattern.(type) {
+	case *ast.BindingPattern:
+		return []string{pattern.Name.Value}
+	case *ast.ArrayPattern:
+		names := []string{}
+		for _, elem := range pattern.Elems {
+			names = append(names, patternNames(elem)...)
+		}
+		if pattern.Rest != nil {
+			names = append(names, patternNames(pattern.Rest)...)
+		}
+		return names
+	case *ast.MapPattern:
+		names := []string{}
+		for _, value := range pattern.Values {
+			names = append(names, patternNames(value)...)
+		}
+		return names
+	case *ast.TypePattern:
+		return patternNames(pattern.Pattern)
+	case *ast.ConstructorPattern:
+		names := []string{}
+		for _, arg := range pattern.Args {
+			names = append(names, patternNames(arg)...)
+		}
+		return names
+	}
+	return nil
+}
+
+// unitVariant returns the EnumValue of the variant without fields called
+// name, if name refers to one in env.
+func unitVariant(name string, env *Env) (*EnumValue, bool) {
+	value, ok := env.Get(name)
+	if !ok {
+		return nil, false
+	}
+	ev, ok := value.(*EnumValue)
+	if !ok || ev.Variant.unit != ev {
+		return nil, false
+	}
+	return ev, true
+}
+
+// hasType reports whether value is of the type called name, which is either
+// one of patternTypes or a type declared by the script.
+func hasType(value Object, name string, env *Env) (bool, *Error) {
+	if accepted, ok := patternTypes[name]; ok {
+		for _, typ := range accepted {
+			if value.Type() == typ {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+
+	typ, _ := env.Get(name)
+	if ok, isType := isInstance(value, typ); isType {
+		return ok, nil
+	}
+
+	return false, newError("unknown type in pattern: %s", name)
+}
+
+// hasFields reports whether map patterns can match value.
+func hasFields(value Object) bool {
+	switch value.(type) {
+	case *Map, *Record, *EnumValue:
+		return true
+	}
+	return false
+}
+
+// fieldOf returns the value stored under the String key name of a Map, or
+// the field called name of a Record.
+func fieldOf(value Object, name string) (Object, bool) {
+	switch value := value.(type) {
+	case *Map:
+		return value.Get(&String{Value: name})
+	case *Record:
+		return value.Get(name)
+	case *EnumValue:
+		return value.Get(name)
+	}
+	return nil, false
+}
@@ -0,0 +1,60 @@
+package types
+
+import "testing"
+
+func TestMatch(t *testing.T) {
+	runEvalTests(t, []evalTest{
+		{"literals", `var describe = fun(x) {
+	match (x) { 0 => "zero", "a" => "letter", true => "yes", 1.5 => "half", _ => "other" }
+};
+[describe(0), describe("a"), describe(true), describe(1.5), describe(2)]`, "[zero, letter, yes, half, other]", ""},
+		{"int matches float", `match (1.0) { 1 => "one", _ => "other" }`, "one", ""},
+		{"negative literal", `match (-2) { -1 => "minus one", -2.0 => "minus two", _ => "other" }`, "minus two", ""},
+		{"null literal", `match (null) { 0 => "zero", null => "null" }`, "null", ""},
+		{"binding", `match (41) { n => n + 1 }`, "42", ""},
+		{"array", `match ([1, [2, 3]]) { [a, [b, c]] => a + b + c }`, "6", ""},
+		{"array length", `match ([1, 2]) { [a] => "one", [a, b] => "two" }`, "two", ""},
+		{"map", `match ({"name": "x", "age": 3}) { {name, "age": years} => [name, years] }`, "[x, 3]", ""},
+		{"map keys", `match ({"name": "x", "age": 3}) { {name, age: 3} => name }`, "x", ""},
+		{"map missing key", `match ({"name": "x"}) { {age} => age, _ => "none" }`, "none", ""},
+		{"type", `var kind = fun(x) {
+	match (x) { n: Int => "int", n: Number => "float", s: String => s, f: Function => "fun", _ => "other" }
+};
+[kind(1), kind(1.5), kind("s"), kind(print), kind([])]`, "[int, float, s, fun, other]", ""},
+		{"guard", `var sign = fun(n) { match (n) { x if x < 0 => "neg", 0 => "zero", _ => "pos" } };
+[sign(-2), sign(0), sign(2)]`, "[neg, zero, pos]", ""},
+		{"guard sees bindings", `match ([1, 2]) { [a, b] if a > b => "desc", [a, b] => "asc" }`, "asc", ""},
+		{"block body", `match (2) { n => { var m = n * 2; m + 1 } }`, "5", ""},
+		{"bindings are local to arms", `var n = "outer"; match (1) { n => n }; n`, "outer", ""},
+
+		{"no arm matched", `match (3) { 1 => "one" }`, "", "no match arm matched 3"},
+		{"unknown type", `match (3) { n: Integer => n }`, "", "unknown type in pattern: Integer"},
+		{"subject error", `match (missing) { _ => 1 }`, "", "invalid identifier: missing"},
+	})
+}
+
+func TestDestructuring(t *testing.T) {
+	runEvalTests(t, []evalTest{
+		{"array with rest", `var [a, ...rest] = [1, 2, 3];
+[a, rest]`, "[1, [2, 3]]", ""},
+		{"empty rest", `var [a, ...rest] = [1]
+rest`, "[]", ""},
+		{"nested array", `var [a, [b, c]] = [1, [2, 3]]
+c`, "3", ""},
+		{"wildcard", `var [_, b] = [1, 2]
+b`, "2", ""},
+		{"map with rename", `var {name, age: years} = {"name": "x", "age": 3};
+[name, years]`, "[x, 3]", ""},
+		{"parameters", `var f = fun([a, b], {c}) { a + b + c }
+f([1, 2], {"c": 3})`, "6", ""},
+
+		{"too few elements", `var [a, b] = [1]`, "", "cannot destructure ARRAY of 1 elements into 2 names"},
+		{"too many elements", `var [a] = [1, 2]`, "", "cannot destructure ARRAY of 2 elements into 1 names"},
+		{"not an array", `var [a, b] = 5`, "", "cannot destructure INT as ARRAY"},
+		{"missing key", `var {x} = {"y": 1}`, "", `cannot destructure MAP without key "x"`},
+		{"not a map", `var {x} = [1]`, "", "cannot destructure ARRAY as MAP"},
+		{"parameter shape", `var f = fun([a, b]) { a }
+f(1)`, "", "cannot destructure INT as ARRAY"},
+		{"nested shape", `var [a, [b, c]] = [1, [2]]`, "", "cannot destructure ARRAY of 1 elements into 2 names"},
+	})
+}
@@ -0,0 +1,265 @@
+package types
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// measureInterval is the least number of bytes allocated between two
+// measurements of the memory in use, which otherwise happen once as much
+// memory is allocated as was found in use.
+const measureInterval = 64 << 10
+
+// memory measures the memory in use by a runtime: the approximate size of
+// the values reachable from the variables of the runtime and of the function
+// calls in progress, including the values held by builtins, see pin and
+// sizeOf. Objects are not tracked once created, so it is measured by walking
+// them, as often as needed to enforce the memory limit and otherwise in
+// proportion to the memory allocated. Like the values it walks, it is only
+// used by the task evaluating, except for peak, the call stacks and the
+// values pinned: the body of a closed generator unwinds its calls on its own.
+type memory struct {
+	mu     sync.Mutex              // guards stacks, their frames and pinned
+	stacks map[*callStack]struct{} // the call stacks with calls in progress
+	pinned map[*[]Object]struct{}  // the values held by builtins, see pin
+	top    *Env                    // the Env of the outermost Eval
+	inUse  int64                   // the memory in use when last measured
+	since  int64                   // the bytes allocated since
+	peak   int64                   // accessed atomically
+}
+
+// reset records env as the Env of the outermost Eval, which is starting,
+// and restarts the peak at the memory in use.
+func (m *memory) reset(env *Env) {
+	m.top = env
+	atomic.StoreInt64(&m.peak, m.inUse)
+}
+
+// push enters the call f on stack.
+func (m *memory) push(stack *callStack, f frame) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(stack.frames) == 0 {
+		if m.stacks == nil {
+			m.stacks = make(map[*callStack]struct{})
+		}
+		m.stacks[stack] = struct{}{}
+	}
+	stack.frames = append(stack.frames, f)
+}
+
+// pop leaves the innermost call of stack.
+func (m *memory) pop(stack *callStack) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stack.frames = stack.frames[:len(stack.frames)-1]
+	if len(stack.frames) == 0 {
+		delete(m.stacks, stack)
+	}
+}
+
+// pin makes the values of *objs count as in use until the returned function
+// is called. The evaluator and builtins pin the values they hold only in Go
+// variables, such as the arguments of a call and the elements of the Array
+// they are building, which are otherwise not reachable from any variable of
+// the runtime.
+func (m *memory) pin(objs *[]Object) (unpin func()) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.pinned == nil {
+		m.pinned = make(map[*[]Object]struct{})
+	}
+	m.pinned[objs] = struct{}{}
+	return func() {
+		m.mu.Lock()
+		delete(m.pinned, objs)
+		m.mu.Unlock()
+	}
+}
+
+// alloc accounts for size bytes allocated in rt, measuring the memory in use
+// if it is due, and returns an upper bound of the memory in use.
+func (m *memory) alloc(rt *runtime, size int64) int64 {
+	m.since += size
+	if m.since >= m.inUse && m.since >= measureInterval ||
+		rt.maxAlloc > 0 && m.inUse+m.since > rt.maxAlloc {
+		m.measure(rt)
+		// The object allocated is not reachable yet, so count it apart.
+		m.since = size
+	}
+	return m.inUse + m.since
+}
+
+// peakInUse returns the most memory found in use.
+func (m *memory) peakInUse() int64 {
+	return atomic.LoadInt64(&m.peak)
+}
+
+// measure measures the memory in use by rt.
+func (m *memory) measure(rt *runtime) {
+	w := &memoryWalker{seen: make(map[interface{}]bool)}
+	w.env(m.top)
+	m.mu.Lock()
+	var envs []*Env
+	for stack := range m.stacks {
+		for _, f := range stack.frames {
+			envs = append(envs, f.env)
+		}
+	}
+	pinned := make([][]Object, 0, len(m.pinned))
+	for objs := range m.pinned {
+		pinned = append(pinned, *objs)
+	}
+	m.mu.Unlock()
+	for _, env := range envs {
+		w.env(env)
+	}
+	for _, module := range rt.modules {
+		w.object(module)
+	}
+	if rt.prelude != nil {
+		w.object(rt.prelude)
+	}
+	for g := range rt.generators {
+		w.env(g.env)
+	}
+	for _, task := range rt.sched.tasks {
+		w.object(task)
+	}
+	for _, objs := range pinned {
+		w.objects(objs)
+	}
+	w.walk()
+
+	m.inUse = w.size
+	m.since = 0
+	if w.size > atomic.LoadInt64(&m.peak) {
+		atomic.StoreInt64(&m.peak, w.size)
+	}
+}
+
+// A memoryWalker adds up the sizes of the objects it visits, visiting each
+// object once. Objects and Envs are queued by object and env and visited by
+// walk, which keeps its own stack so that deeply nested values cannot
+// exhaust the Go stack.
+type memoryWalker struct {
+	seen map[interface{}]bool
+	size int64
+
+	envs []*Env
+	objs []Object
+}
+
+func (w *memoryWalker) env(env *Env) {
+	if env != nil && !w.seen[env] {
+		w.envs = append(w.envs, env)
+	}
+}
+
+func (w *memoryWalker) object(obj Object) {
+	if obj != nil {
+		w.objs = append(w.objs, obj)
+	}
+}
+
+func (w *memoryWalker) objects(objs []Object) {
+	for _, obj := range objs {
+		w.object(obj)
+	}
+}
+
+// walk visits the objects and Envs queued until none is left.
+func (w *memoryWalker) walk() {
+	for len(w.envs) > 0 || len(w.objs) > 0 {
+		if n := len(w.objs); n > 0 {
+			obj := w.objs[n-1]
+			w.objs = w.objs[:n-1]
+			w.visit(obj)
+			continue
+		}
+		env := w.envs[len(w.envs)-1]
+		w.envs = w.envs[:len(w.envs)-1]
+		w.visitEnv(env)
+	}
+}
+
+func (w *memoryWalker) visitEnv(env *Env) {
+	if w.seen[env] {
+		return
+	}
+	w.seen[env] = true
+	w.size += envSize
+
+	env.mu.RLock()
+	for _, value := range env.store {
+		w.object(value)
+	}
+	env.mu.RUnlock()
+
+	w.env(env.outer)
+}
+
+func (w *memoryWalker) visit(obj Object) {
+	// Small values are not worth remembering: counting them twice when they
+	// are shared costs less than looking them up.
+	switch obj := obj.(type) {
+	case *Int, *Float, *Bool, *Null:
+		w.size += objectSize
+		return
+	case *String:
+		if len(obj.Value) <= objectSize {
+			w.size += sizeOf(obj)
+			return
+		}
+	}
+
+	if w.seen[obj] {
+		return
+	}
+	w.seen[obj] = true
+	w.size += sizeOf(obj)
+
+	switch obj := obj.(type) {
+	case *Array:
+		w.objects(obj.Elems)
+	case *Map:
+		for _, pair := range obj.Pairs {
+			w.object(pair.Key)
+			w.object(pair.Value)
+		}
+	case *Record:
+		w.objects(obj.Values)
+	case *EnumValue:
+		w.objects(obj.Values)
+	case *Instance:
+		for _, field := range obj.Fields {
+			w.object(field)
+		}
+		w.object(obj.Class)
+	case *Class:
+		for _, method := range obj.Methods {
+			w.object(method)
+		}
+		if obj.Super != nil {
+			w.object(obj.Super)
+		}
+	case *Fun:
+		w.env(obj.Env)
+	case *Namespace:
+		obj.mu.RLock()
+		for _, member := range obj.Members {
+			w.object(member)
+		}
+		obj.mu.RUnlock()
+	case *Generator:
+		w.env(obj.gen.env)
+	case *Promise:
+		w.object(obj.value)
+	case *Task:
+		w.object(obj.result)
+	case *Channel:
+		w.objects(obj.buf)
+	case *ReturnValue:
+		w.object(obj.Value)
+	}
+}
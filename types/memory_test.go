@@ -0,0 +1,145 @@
+package types
+
+import (
+	"runtime/debug"
+	"testing"
+)
+
+func TestMemoryLimit(t *testing.T) {
+	// Each call doubles s, so the strings add up to more than the limit
+	// after about ten calls.
+	src := `var f = fun(s) { f(s + s) }
+f("x")`
+	env := NewEnv(WithMemoryLimit(1 << 12))
+	result := evalSource(t, src, env)
+	if err, ok := result.(*Error); !ok || err.Kind != MEMORY_LIMIT_ERROR || err.Msg != "memory limit of 4096 bytes exceeded" {
+		t.Fatalf("Eval = %s, want a MEMORY_LIMIT_ERROR", result.Inspect())
+	}
+	if allocated := env.Stats().TotalAllocated; allocated <= 1<<12 {
+		t.Errorf("TotalAllocated = %d, want more than %d", allocated, 1<<12)
+	}
+}
+
+func TestStats(t *testing.T) {
+	env := NewEnv()
+	result := evalSource(t, `var f = fun(n) { if (n == 5) { "done" } else { f(n + 1) } }
+f(0)`, env)
+	if result.Inspect() != "done" {
+		t.Fatalf("Eval = %s, want done", result.Inspect())
+	}
+
+	stats := env.Stats()
+	if stats.Steps != 6 {
+		t.Errorf("Steps = %d, want 6", stats.Steps)
+	}
+	if stats.PeakDepth != 6 {
+		t.Errorf("PeakDepth = %d, want 6", stats.PeakDepth)
+	}
+	// The closure, the string literal and six call environments.
+	if want := int64(objectSize + funSize + objectSize + len("done") + 6*envSize); stats.TotalAllocated != want {
+		t.Errorf("TotalAllocated = %d, want %d", stats.TotalAllocated, want)
+	}
+}
+
+func TestMemoryLimitCountsMemoryInUse(t *testing.T) {
+	// Each iteration makes a string of 10000 bytes that is garbage by the
+	// next, 10 MB in all, well above the limit.
+	garbage := `var s = ""
+for (x in range(1000)) { s = "x".repeat(10000) }
+s`
+	env := NewEnv(WithMemoryLimit(1 << 20))
+	if result := evalSource(t, garbage, env); isError(result) {
+		t.Fatalf("Eval: %s", result.Inspect())
+	}
+	stats := env.Stats()
+	if stats.TotalAllocated < 10000000 {
+		t.Errorf("TotalAllocated = %d, want at least 10000000", stats.TotalAllocated)
+	}
+	if stats.PeakMemory < 10000 || stats.PeakMemory > 1<<20 {
+		t.Errorf("PeakMemory = %d, want between 10000 and %d", stats.PeakMemory, 1<<20)
+	}
+
+	kept := `var xs = []
+for (x in range(1000)) { xs = append(xs, "x".repeat(10000)) }`
+	result := evalSource(t, kept, NewEnv(WithMemoryLimit(1<<20)))
+	if err, ok := result.(*Error); !ok || err.Kind != MEMORY_LIMIT_ERROR {
+		t.Errorf("keeping 10 MB with a limit of 1 MB = %s, want a MEMORY_LIMIT_ERROR", result.Inspect())
+	}
+}
+
+func TestMeasureDeeplyNestedValue(t *testing.T) {
+	// Measuring walks values without recursing, so nesting deeper than the
+	// Go stack allows must not crash.
+	defer debug.SetMaxStack(debug.SetMaxStack(8 << 20))
+
+	src := `var a = []
+for (i in range(200000)) { a = [a] }
+1`
+	env := NewEnv()
+	if result := evalSource(t, src, env); isError(result) {
+		t.Fatalf("Eval: %s", result.Inspect())
+	}
+	if peak := env.Stats().PeakMemory; peak < 200000*objectSize {
+		t.Errorf("PeakMemory = %d, want at least %d", peak, 200000*objectSize)
+	}
+}
+
+func TestMemoryLimitCountsBuiltinResults(t *testing.T) {
+	// The strings are only held by the Array map is building, 10 MB in all.
+	src := `var xs = range(10000).toArray()
+xs.map(fun(x) { "x".repeat(1000) })
+1`
+	env := NewEnv(WithMemoryLimit(1 << 20))
+	result := evalSource(t, src, env)
+	if err, ok := result.(*Error); !ok || err.Kind != MEMORY_LIMIT_ERROR {
+		t.Errorf("map building 10 MB with a limit of 1 MB = %s, want a MEMORY_LIMIT_ERROR", result.Inspect())
+	}
+	if peak := env.Stats().PeakMemory; peak > 1<<20 {
+		t.Errorf("PeakMemory = %d, want at most %d", peak, 1<<20)
+	}
+
+	// Garbage made by the function passed to map does not count.
+	src = `var xs = range(10000).toArray()
+xs.map(fun(x) { var s = "x".repeat(1000); x })
+1`
+	if result := evalSource(t, src, NewEnv(WithMemoryLimit(1<<20))); isError(result) {
+		t.Errorf("map making 10 MB of garbage with a limit of 1 MB = %s, want 1", result.Inspect())
+	}
+}
+
+func TestMemoryLimitCountsValuesBeingEvaluated(t *testing.T) {
+	// Each string is only held by the elements, arguments or pairs evaluated
+	// so far, 2.4 MB in all.
+	const s = "var s = \"x\".repeat(300000);\n"
+	tests := []struct {
+		name string
+		src  string
+	}{
+		{"array literal", s + `[s + "a", s + "a", s + "a", s + "a", s + "a", s + "a", s + "a", s + "a"]
+1`},
+		{"function arguments", s + `var f = fun(a, b, c, d, e, g) { 1 }
+f(s + "a", s + "a", s + "a", s + "a", s + "a", s + "a")`},
+		{"record arguments", s + `record R { a, b, c, d, e, g }
+R(s + "a", s + "a", s + "a", s + "a", s + "a", s + "a")
+1`},
+		{"map literal", s + `{1: s + "a", 2: s + "a", 3: s + "a", 4: s + "a", 5: s + "a", 6: s + "a"}
+1`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := evalSource(t, tt.src, NewEnv(WithMemoryLimit(1_000_000)))
+			if err, ok := result.(*Error); !ok || err.Kind != MEMORY_LIMIT_ERROR {
+				t.Errorf("Eval = %s, want a MEMORY_LIMIT_ERROR", result.Inspect())
+			}
+		})
+	}
+
+	// Arguments stop counting once their call returns.
+	src := s + `var f = fun(a) { len(a) }
+for (i in range(20)) { f(s + "a") }
+1`
+	if result := evalSource(t, src, NewEnv(WithMemoryLimit(1_000_000))); isError(result) {
+		t.Errorf("calls passing 6 MB of arguments in turn with a limit of 1 MB = %s, want 1", result.Inspect())
+	}
+}
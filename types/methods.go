@@ -0,0 +1,114 @@
+package types
+
+import "context"
+
+// methods holds the methods callable on values of each ObjType as
+// value.method(args). A method is a Builtin receiving the value as its first
+// argument, and its Arity counts the value.
+var methods map[ObjType]map[string]*Builtin
+
+// Methods calling back into the evaluator refer to methods indirectly, so
+// the table is filled in by init to avoid an initialization cycle.
+func init() {
+	methods = map[ObjType]map[string]*Builtin{
+		STRING_OBJ: stringMethods,
+		REGEX_OBJ:  regexMethods,
+		ARRAY_OBJ: {
+			"len":   {Name: "len", Fun: length, Arity: 1},
+			"push":  {Name: "push", Fun: arrayPush, Arity: VariadicArity},
+			"slice": {Name: "slice", Fun: slice, Arity: 3},
+			"join":  {Name: "join", Fun: arrayJoin, Arity: 2},
+		},
+		MAP_OBJ: {
+			"len":    {Name: "len", Fun: length, Arity: 1},
+			"keys":   {Name: "keys", Fun: mapKeys, Arity: 1},
+			"values": {Name: "values", Fun: mapValues, Arity: 1},
+			"has":    {Name: "has", Fun: mapHas, Arity: 2},
+		},
+	}
+
+	methods[RANGE_OBJ] = map[string]*Builtin{
+		"len":     {Name: "len", Fun: length, Arity: 1},
+		"toArray": {Name: "toArray", Fun: rangeToArray, Arity: 1},
+	}
+	for _, fun := range collectionFuns {
+		methods[ARRAY_OBJ][fun.Name] = fun
+		methods[RANGE_OBJ][fun.Name] = fun
+	}
+
+	for typ, funs := range taskMethods {
+		methods[typ] = funs
+	}
+
+	methods[ITERATOR_OBJ] = make(map[string]*Builtin, len(iteratorFuns))
+	methods[GENERATOR_OBJ] = make(map[string]*Builtin, len(iteratorFuns))
+	for _, fun := range iteratorFuns {
+		methods[ITERATOR_OBJ][fun.Name] = fun
+		methods[GENERATOR_OBJ][fun.Name] = fun
+	}
+}
+
+// lookupMethod returns the method called name of recv bound to recv.
+func lookupMethod(recv Object, name string) (*Builtin, bool) {
+	method, ok := methods[recv.Type()][name]
+	if !ok {
+		return nil, false
+	}
+
+	arity := method.Arity
+	if arity != VariadicArity {
+		arity--
+	}
+
+	bound := func(ctx context.Context, env *Env, args ...Object) Object {
+		return method.Fun(ctx, env, append([]Object{recv}, args...)...)
+	}
+
+	return &Builtin{Name: name, Fun: bound, Arity: arity}, true
+}
+
+func mapKeys(ctx context.Context, env *Env, args ...Object) Object {
+	pairs := args[0].(*Map).SortedPairs()
+
+	keys := make([]Object, len(pairs))
+	for i, pair := range pairs {
+		keys[i] = pair.Key
+	}
+
+	return env.rt.track(&Array{Elems: keys})
+}
+
+func mapValues(ctx context.Context, env *Env, args ...Object) Object {
+	pairs := args[0].(*Map).SortedPairs()
+
+	values := make([]Object, len(pairs))
+	for i, pair := range pairs {
+		values[i] = pair.Value
+	}
+
+	return env.rt.track(&Array{Elems: values})
+}
+
+func mapHas(ctx context.Context, env *Env, args ...Object) Object {
+	key, ok := args[1].(Hashable)
+	if !ok {
+		return newError("invalid map key: %s", args[1].Type().String())
+	}
+
+	_, ok = args[0].(*Map).Get(key)
+	return nativeBool(ok)
+}
+
+// arrayPush appends its arguments to the Array in place and returns it.
+func arrayPush(ctx context.Context, env *Env, args ...Object) Object {
+	arr := args[0].(*Array)
+	if arr.Frozen {
+		return newError("cannot modify frozen ARRAY")
+	}
+	if err := env.rt.alloc(int64(len(args)-1) * objectSize); err != nil {
+		return err
+	}
+
+	arr.Elems = append(arr.Elems, args[1:]...)
+	return arr
+}
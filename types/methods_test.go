@@ -0,0 +1,29 @@
+package types
+
+import "testing"
+
+func TestSelectors(t *testing.T) {
+	runEvalTests(t, []evalTest{
+		{"string method", `"abc".upper()`, "ABC", ""},
+		{"chained methods", `[1, 2, 3].map(fun(x) { x * 2 }).filter(fun(x) { x > 2 })`, "[4, 6]", ""},
+		{"array methods", `var xs = [1, 2, 3]; [xs.len(), xs.slice(1, 2), xs.push(4)]`, "[3, [2], [1, 2, 3, 4]]", ""},
+		{"push mutates", `var xs = [1]; xs.push(2, 3); xs`, "[1, 2, 3]", ""},
+		{"map method", `{"b": 1, "a": 2}.keys()`, "[a, b]", ""},
+		{"map methods", `var m = {"b": 1, "a": 2}; [m.values(), m.has("a"), m.has("c"), m.len()]`, "[[2, 1], true, false, 2]", ""},
+		{"map key", `var m = {"name": "x"}
+m.name`, "x", ""},
+		{"missing map key", `{"name": "x"}.missing`, "null", ""},
+		{"function in map", `var m = {"f": fun(x) { x + 1 }}
+m.f(1)`, "2", ""},
+		{"map key shadows method", `{"keys": 1}.keys`, "1", ""},
+		{"bound method", `var upper = "ab".upper
+upper()`, "AB", ""},
+		{"method on call result", `"ab".upper().lower()`, "ab", ""},
+
+		{"unknown method", `"abc".nope()`, "", "invalid selector: STRING has no method nope"},
+		{"no methods", `1.foo`, "", "invalid selector: INT has no method foo"},
+		{"method arity", `"abc".upper(1)`, "", "wrong number of arguments to upper: want 0, got 1"},
+		{"push to frozen array", `freeze([1]).push(2)`, "", "cannot modify frozen ARRAY"},
+		{"map callback error", `[1].map(fun(x) { x + "a" })`, "", "invalid operation: INT + STRING"},
+	})
+}
@@ -0,0 +1,245 @@
+package types
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gramidt/mash-lang-for-codemash/ast"
+	"github.com/gramidt/mash-lang-for-codemash/parser"
+	"github.com/gramidt/mash-lang-for-codemash/scanner"
+	"github.com/gramidt/mash-lang-for-codemash/std"
+)
+
+// ModuleExt is the file extension of Mash modules.
+const ModuleExt = ".mash"
+
+const (
+	stdPrefix     = "std/"
+	preludeModule = "std/prelude"
+)
+
+// WithModulePath sets the directories searched for imported modules that
+// are not found relative to the importing file. It defaults to the
+// directories listed in the MASHPATH environment variable.
+func WithModulePath(dirs ...string) Option {
+	return func(rt *runtime) {
+		rt.modulePath = dirs
+	}
+}
+
+// SetDir sets the directory that imports of scripts evaluated in e are
+// resolved against. It defaults to the working directory.
+func (e *Env) SetDir(dir string) {
+	e.dir = dir
+}
+
+// importDir returns the directory of the module e belongs to.
+func (e *Env) importDir() string {
+	for env := e; env != nil; env = env.outer {
+		if env.dir != "" {
+			return env.dir
+		}
+	}
+	return "."
+}
+
+func defaultModulePath() []string {
+	return filepath.SplitList(os.Getenv("MASHPATH"))
+}
+
+func evalImportStmt(ctx context.Context, node *ast.ImportStmt, env *Env) Object {
+	module, err := env.rt.importModule(ctx, env.importDir(), node.Path.Value)
+	if err != nil {
+		return err
+	}
+
+	name := module.Name
+	if node.Name != nil {
+		name = node.Name.Value
+	}
+
+	if result := env.Set(name, module); isError(result) {
+		return result
+	}
+	return nil
+}
+
+// importModule returns the exports of the module imported as name from a
+// module in dir, loading it unless it is cached. Modules other than those of
+// the standard library are files, which require READ_PERM.
+func (rt *runtime) importModule(ctx context.Context, dir, name string) (*Namespace, *Error) {
+	path, err := rt.resolveModule(dir, name)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(path, stdPrefix) {
+		if err := rt.require(READ_PERM, path); err != nil {
+			return nil, err
+		}
+	}
+
+	if module, ok := rt.modules[path]; ok {
+		return module, nil
+	}
+
+	for i, loading := range rt.loading {
+		if loading == path {
+			cycle := append(append([]string{}, rt.loading[i:]...), path)
+			return nil, newError("import cycle: %s", strings.Join(cycle, " -> "))
+		}
+	}
+
+	rt.loading = append(rt.loading, path)
+	module, err := rt.loadModule(ctx, path)
+	rt.loading = rt.loading[:len(rt.loading)-1]
+	if err != nil {
+		return nil, err
+	}
+
+	rt.modules[path] = module
+	return module, nil
+}
+
+// resolveModule finds the file imported as name from a module in dir.
+// Names starting with "std/" refer to the embedded standard library.
+func (rt *runtime) resolveModule(dir, name string) (string, *Error) {
+	if !strings.HasSuffix(name, ModuleExt) {
+		name += ModuleExt
+	}
+
+	if strings.HasPrefix(name, stdPrefix) {
+		if _, err := fs.Stat(std.FS, strings.TrimPrefix(name, stdPrefix)); err == nil {
+			return name, nil
+		}
+		return "", &Error{Kind: NOT_FOUND_ERROR, Msg: "module not found: " + name}
+	}
+
+	candidates := []string{name}
+	if !filepath.IsAbs(name) {
+		candidates = []string{filepath.Join(dir, name)}
+		for _, root := range rt.modulePath {
+			candidates = append(candidates, filepath.Join(root, name))
+		}
+	}
+
+	for _, candidate := range candidates {
+		if _, err := rt.fs.Stat(candidate); err == nil {
+			if abs, err := filepath.Abs(candidate); err == nil {
+				return abs, nil
+			}
+			return candidate, nil
+		}
+	}
+
+	return "", &Error{Kind: NOT_FOUND_ERROR, Msg: "module not found: " + name}
+}
+
+// readModule returns the source of the module resolved to path.
+func (rt *runtime) readModule(path string) ([]byte, *Error) {
+	if strings.HasPrefix(path, stdPrefix) {
+		src, err := std.FS.ReadFile(strings.TrimPrefix(path, stdPrefix))
+		if err != nil {
+			return nil, newIOError("import", err)
+		}
+		return src, nil
+	}
+
+	f, err := rt.fs.Open(path)
+	if err != nil {
+		return nil, newIOError("import", err)
+	}
+	defer f.Close()
+
+	return rt.readAll("import", f)
+}
+
+// loadModule evaluates the module at path in a fresh Env and returns the
+// Namespace of its exports. Besides the builtins, the Env sees those the
+// host registered in the Env of NewEnv.
+func (rt *runtime) loadModule(ctx context.Context, path string) (*Namespace, *Error) {
+	src, err := rt.readModule(path)
+	if err != nil {
+		return nil, err
+	}
+
+	p := parser.NewParser(scanner.NewScanner(string(src)))
+	root := p.Parse()
+	if len(p.Errors()) != 0 {
+		return nil, newError("parser errors in %s:\n\t%s", path, strings.Join(p.Errors(), "\n\t"))
+	}
+
+	module := &Namespace{
+		Name:    strings.TrimSuffix(filepath.Base(path), ModuleExt),
+		Members: make(map[string]Object),
+	}
+
+	env := &Env{store: make(map[string]Object), rt: rt, dir: filepath.Dir(path), exports: module}
+	if result, ok := eval(ctx, root, env).(*Error); ok {
+		return nil, result
+	}
+
+	return module, nil
+}
+
+// lookupPrelude returns the member called name of the prelude, loading the
+// prelude the first time it is needed.
+func (rt *runtime) lookupPrelude(ctx context.Context, name string) (Object, bool) {
+	if rt.prelude == nil {
+		// Names the prelude itself fails to resolve are not in the prelude.
+		if rt.loadingPrelude {
+			return nil, false
+		}
+
+		rt.loadingPrelude = true
+		prelude, err := rt.importModule(ctx, ".", preludeModule)
+		rt.loadingPrelude = false
+		if err != nil {
+			return err, true
+		}
+
+		rt.prelude = prelude
+	}
+
+	return rt.prelude.Get(name)
+}
+
+func evalExportStmt(ctx context.Context, node *ast.ExportStmt, env *Env) Object {
+	if result := eval(ctx, node.Decl, env); isError(result) {
+		return result
+	}
+
+	if env.exports == nil {
+		return nil
+	}
+
+	for _, name := range declNames(node.Decl) {
+		val, _ := env.Get(name)
+		env.exports.set(name, val)
+	}
+	return nil
+}
+
+// declNames returns the names declared by decl.
+func declNames(decl ast.Stmt) []string {
+	switch decl := decl.(type) {
+	case *ast.VarStmt:
+		if decl.Pattern != nil {
+			return patternNames(decl.Pattern)
+		}
+		return []string{decl.Name.Value}
+	case *ast.RecordStmt:
+		return []string{decl.Name.Value}
+	case *ast.ClassStmt:
+		return []string{decl.Name.Value}
+	case *ast.EnumStmt:
+		names := []string{decl.Name.Value}
+		for _, variant := range decl.Variants {
+			names = append(names, variant.Name.Value)
+		}
+		return names
+	}
+	return nil
+}
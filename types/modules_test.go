@@ -0,0 +1,248 @@
+package types
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeModules writes each module source to the file named by its key,
+// relative to dir.
+func writeModules(t *testing.T, dir string, modules map[string]string) {
+	t.Helper()
+	for name, src := range modules {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(src), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestImport(t *testing.T) {
+	dir := t.TempDir()
+	writeModules(t, dir, map[string]string{
+		"greet.mash": `var prefix = "hello "
+export var greet = fun(name) { prefix + name }`,
+		"lib/twice.mash": `import "../greet"
+export var twice = fun(name) { greet.greet(name) + ", " + greet.greet(name) }`,
+	})
+
+	tests := []struct {
+		name    string
+		src     string
+		want    string
+		wantErr string
+	}{
+		{"default name", `import "greet"
+greet.greet("mash")`, "hello mash", ""},
+		{"alias", `import "greet" as g
+g.greet("mash")`, "hello mash", ""},
+		{"extension", `import "greet.mash"
+greet.greet("mash")`, "hello mash", ""},
+		{"relative to the importing module", `import "lib/twice"
+twice.twice("mash")`, "hello mash, hello mash", ""},
+		{"unexported", `import "greet"
+greet.prefix`, "", "invalid selector: greet.prefix"},
+		{"not found", `import "missing"`, "", "module not found: missing.mash"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := NewEnv(AllowRead(dir))
+			env.SetDir(dir)
+			result := evalSource(t, tt.src, env)
+			checkResult(t, result, tt.wantErr)
+			if tt.wantErr == "" && result.Inspect() != tt.want {
+				t.Errorf("Eval = %s, want %s", result.Inspect(), tt.want)
+			}
+		})
+	}
+
+	// Module files are read like any other file.
+	env := NewEnv(AllowRead(filepath.Join(dir, "lib")))
+	env.SetDir(dir)
+	result := evalSource(t, `import "lib/twice"`, env)
+	checkResult(t, result, `permission denied: read access to "`+filepath.Join(dir, "greet.mash")+`" requires --allow-read`)
+}
+
+func TestImportEvaluatesModulesOnce(t *testing.T) {
+	dir := t.TempDir()
+	writeModules(t, dir, map[string]string{
+		"counter.mash": `print("loading counter")
+export var name = "counter"`,
+		"a.mash": `import "counter"
+export var name = "a " + counter.name`,
+		"b.mash": `import "counter"
+export var name = "b " + counter.name`,
+	})
+
+	var out bytes.Buffer
+	env := NewEnv(WithStdout(&out), AllowRead(dir))
+	env.SetDir(dir)
+	result := evalSource(t, `import "a"
+import "b"
+import "counter"
+a.name + ", " + b.name`, env)
+	if result.Inspect() != "a counter, b counter" {
+		t.Errorf("Eval = %s, want a counter, b counter", result.Inspect())
+	}
+	if got := out.String(); got != "loading counter\n" {
+		t.Errorf("printed %q, want the module loaded once", got)
+	}
+}
+
+func TestImportCycle(t *testing.T) {
+	dir := t.TempDir()
+	writeModules(t, dir, map[string]string{
+		"a.mash":    `import "b"`,
+		"b.mash":    `import "c"`,
+		"c.mash":    `import "a"`,
+		"self.mash": `import "self"`,
+	})
+	path := func(name string) string { return filepath.Join(dir, name+ModuleExt) }
+
+	tests := []struct {
+		src   string
+		cycle []string
+	}{
+		{`import "a"`, []string{path("a"), path("b"), path("c"), path("a")}},
+		{`import "self"`, []string{path("self"), path("self")}},
+	}
+
+	for _, tt := range tests {
+		env := NewEnv(AllowRead(dir))
+		env.SetDir(dir)
+		result := evalSource(t, tt.src, env)
+		checkResult(t, result, "import cycle: "+strings.Join(tt.cycle, " -> "))
+	}
+}
+
+func TestModulePath(t *testing.T) {
+	dir := t.TempDir()
+	first := filepath.Join(dir, "first")
+	second := filepath.Join(dir, "second")
+	writeModules(t, dir, map[string]string{
+		"first/shared.mash":  `export var from = "first"`,
+		"second/shared.mash": `export var from = "second"`,
+		"second/only.mash":   `export var from = "second only"`,
+		"local/shared.mash":  `export var from = "local"`,
+	})
+
+	tests := []struct {
+		name     string
+		mashpath string
+		opts     []Option
+		dir      string
+		src      string
+		want     string
+	}{
+		{"MASHPATH", first + string(filepath.ListSeparator) + second, nil, dir,
+			`import "shared"; shared.from`, "first"},
+		{"later MASHPATH entry", first + string(filepath.ListSeparator) + second, nil, dir,
+			`import "only"; only.from`, "second only"},
+		{"WithModulePath", first, []Option{WithModulePath(second)}, dir,
+			`import "shared"; shared.from`, "second"},
+		{"importing directory first", first, nil, filepath.Join(dir, "local"),
+			`import "shared"; shared.from`, "local"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("MASHPATH", tt.mashpath)
+			env := NewEnv(append(tt.opts, AllowRead(dir))...)
+			env.SetDir(tt.dir)
+			result := evalSource(t, tt.src, env)
+			if result.Inspect() != tt.want {
+				t.Errorf("Eval = %s, want %s", result.Inspect(), tt.want)
+			}
+		})
+	}
+}
+
+func TestStdModules(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{`list.isEmpty([])`, "true"},
+		{`[list.first([1, 2]), list.first([])]`, "[1, null]"},
+		{`[list.last([1, 2]), list.last([])]`, "[2, null]"},
+		{`list.rest([1, 2, 3])`, "[2, 3]"},
+		{`[list.take([1, 2, 3], 2), list.drop([1, 2, 3], 2)]`, "[[1, 2], [3]]"},
+		{`list.fold([1, 2, 3], "", fun(acc, x) { acc + "x" })`, "xxx"},
+		{`list.map([1, 2, 3], fun(x) { x * 2 })`, "[2, 4, 6]"},
+		{`list.filter([1, 2, 3, 4], fun(x) { x % 2 == 0 })`, "[2, 4]"},
+		{`list.concat([1], [2, 3])`, "[1, 2, 3]"},
+		{`[list.reverse([1, 2, 3]), list.reverse([])]`, "[[3, 2, 1], []]"},
+		{`[list.indexOf([5, 6, 7, 6], 6), list.indexOf([5], 9)]`, "[1, -1]"},
+		{`[list.contains([1, 2], 2), list.contains([], 2)]`, "[true, false]"},
+		// The helpers loop instead of recursing, so long inputs do not
+		// exhaust the call depth.
+		{`list.reverse(range(20000).toArray())[0]`, "19999"},
+		{`list.indexOf(range(20000).toArray(), 19999)`, "19999"},
+		{`len(strings.reverse("ab".repeat(10000)))`, "20000"},
+		{`list.sum([1, 2, 3])`, "6"},
+		{`[strings.isEmpty(""), strings.isEmpty("a")]`, "[true, false]"},
+		{`[strings.repeat("ab", 3), strings.repeat("ab", 0)]`, "[ababab, ]"},
+		{`[strings.join(["a", "b", "c"], ", "), strings.join([], ", ")]`, "[a, b, c, ]"},
+		{`functional.identity(1)`, "1"},
+		{`functional.constant(1)()`, "1"},
+		{`[functional.not(true), functional.not(0)]`, "[false, true]"},
+		{`functional.compose(fun(x) { x * 2 }, fun(x) { x + 1 })(1)`, "4"},
+		{`functional.pipe(fun(x) { x * 2 }, fun(x) { x + 1 })(1)`, "3"},
+		{`functional.flip(fun(a, b) { a - b })(1, 3)`, "2"},
+		{`functional.partial(fun(a, b) { a - b }, 5)(3)`, "2"},
+	}
+
+	for _, tt := range tests {
+		src := `import "std/list";
+import "std/strings";
+import "std/functional";
+` + tt.src
+		if got := evalSource(t, src, NewEnv()).Inspect(); got != tt.want {
+			t.Errorf("%s = %s, want %s", tt.src, got, tt.want)
+		}
+	}
+
+	// indexOf stops at the first match, within a budget far smaller than
+	// the array.
+	src := `import "std/list"
+var xs = ("b" + "a".repeat(20000)).chars()
+list.indexOf(xs, "b")`
+	if got := evalSource(t, src, NewEnv(WithStepBudget(100))).Inspect(); got != "0" {
+		t.Errorf("indexOf of the first element = %s, want 0", got)
+	}
+}
+
+func TestPrelude(t *testing.T) {
+	runEvalTests(t, []evalTest{
+		{"list", `list.sum([1, 2])`, "3", ""},
+		{"functions", `compose(not, identity)(false)`, "true", ""},
+		{"defined names first", `var identity = fun(x) { x + 1 }; identity(1)`, "2", ""},
+		{"unknown name", `missing`, "", "invalid identifier: missing"},
+		{"missing std module", `import "std/missing"`, "", "module not found: std/missing.mash"},
+	})
+}
+
+func TestModuleCallsHostBuiltin(t *testing.T) {
+	dir := t.TempDir()
+	writeModules(t, dir, map[string]string{
+		"util.mash": `export var shout = fun(s) { host.up(s) + "!" }`,
+	})
+
+	env := NewEnv(WithModulePath(dir), AllowRead(dir))
+	if err := env.RegisterFunc("host.up", strings.ToUpper); err != nil {
+		t.Fatalf("RegisterFunc: %v", err)
+	}
+
+	result := evalSource(t, `import "util" as util
+util.shout("hi")`, env)
+	if got, ok := result.(*String); !ok || got.Value != "HI!" {
+		t.Errorf("util.shout(\"hi\") = %s, want \"HI!\"", result.Inspect())
+	}
+}
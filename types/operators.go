@@ -0,0 +1,130 @@
+package types
+
+import (
+	"context"
+
+	"github.com/gramidt/mash-lang-for-codemash/grammar"
+)
+
+// The names of the methods a class defines to customize how its instances
+// are indexed and printed.
+const (
+	indexHook    = "__index__"
+	setIndexHook = "__setindex__"
+	strHook      = "__str__"
+)
+
+// operatorHooks are the names of the methods a class defines to overload
+// binary operators for its instances. The left operand is the receiver and
+// the right operand the argument. != is the negation of __eq__, and <=, > and
+// >= are derived from __lt__ and __eq__ when not defined.
+var operatorHooks = map[grammar.TokenType]string{
+	grammar.ADD: "__add__",
+	grammar.SUB: "__sub__",
+	grammar.MUL: "__mul__",
+	grammar.QUO: "__div__",
+	grammar.REM: "__mod__",
+	grammar.EQ:  "__eq__",
+	grammar.LSS: "__lt__",
+	grammar.GTR: "__gt__",
+	grammar.LEQ: "__le__",
+	grammar.GEQ: "__ge__",
+}
+
+// callHook calls the method called name of inst with args, reporting false
+// if its class does not define one.
+func callHook(ctx context.Context, env *Env, inst *Instance, name string, args ...Object) (Object, bool) {
+	method, owner, ok := inst.Class.findMethod(name)
+	if !ok {
+		return nil, false
+	}
+	result := applyFunction(ctx, env, inst.Class.Name+"."+name, bindMethod(inst, method, owner), args)
+	if result == nil {
+		result = NULL
+	}
+	return result, true
+}
+
+// compareHook calls the comparison method called name of inst with arg,
+// converting its result to a Bool.
+func compareHook(ctx context.Context, env *Env, inst *Instance, name string, arg Object) (Object, bool) {
+	result, ok := callHook(ctx, env, inst, name, arg)
+	if !ok || isError(result) {
+		return result, ok
+	}
+	return nativeBool(result.IsTruthy()), true
+}
+
+// evalOperatorHook applies the method overloading op for left and right, if
+// the left operand is an Instance whose class defines one. Equality is also
+// overloaded by the class of the right operand.
+func evalOperatorHook(ctx context.Context, op grammar.TokenType, left, right Object, env *Env) (Object, bool) {
+	inst, ok := left.(*Instance)
+	if !ok {
+		if inst, ok = right.(*Instance); !ok || op != grammar.EQ && op != grammar.NEQ {
+			return nil, false
+		}
+		right = left
+	}
+
+	switch op {
+	case grammar.ADD, grammar.SUB, grammar.MUL, grammar.QUO, grammar.REM:
+		return callHook(ctx, env, inst, operatorHooks[op], right)
+	case grammar.EQ, grammar.LSS, grammar.GTR, grammar.LEQ, grammar.GEQ:
+		if result, ok := compareHook(ctx, env, inst, operatorHooks[op], right); ok {
+			return result, true
+		}
+	}
+
+	if op == grammar.NEQ {
+		eq, ok := compareHook(ctx, env, inst, operatorHooks[grammar.EQ], right)
+		if !ok || isError(eq) {
+			return eq, ok
+		}
+		return nativeBool(!eq.IsTruthy()), true
+	}
+
+	if op == grammar.EQ || op == grammar.LSS {
+		return nil, false
+	}
+	lt, ok := compareHook(ctx, env, inst, operatorHooks[grammar.LSS], right)
+	if !ok || isError(lt) {
+		return lt, ok
+	}
+	if op == grammar.GEQ {
+		return nativeBool(!lt.IsTruthy()), true
+	}
+	if lt.IsTruthy() {
+		return nativeBool(op == grammar.LEQ), true
+	}
+
+	eq, ok := compareHook(ctx, env, inst, operatorHooks[grammar.EQ], right)
+	if !ok {
+		eq = nativeBool(inst == right)
+	}
+	if isError(eq) {
+		return eq, true
+	}
+	return nativeBool(eq.IsTruthy() == (op == grammar.LEQ)), true
+}
+
+// display returns the text print and format show for obj: the result of the
+// __str__ method of an Instance whose class defines one, or else its Inspect.
+func display(ctx context.Context, env *Env, obj Object) (string, *Error) {
+	inst, ok := obj.(*Instance)
+	if !ok {
+		return obj.Inspect(), nil
+	}
+
+	result, ok := callHook(ctx, env, inst, strHook)
+	if !ok {
+		return obj.Inspect(), nil
+	}
+	switch result := result.(type) {
+	case *Error:
+		return "", result
+	case *String:
+		return result.Value, nil
+	}
+	return "", newError("%s.%s must return STRING, got %s", inst.Class.Name, strHook, result.Type().String())
+}
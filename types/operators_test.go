@@ -0,0 +1,58 @@
+package types
+
+import (
+	"bytes"
+	"testing"
+)
+
+const moneyClass = `class Money {
+	init(n) { self.n = n }
+	__add__(o) { Money(self.n + o.n) }
+	__sub__(o) { Money(self.n - o.n) }
+	__mul__(k) { Money(self.n * k) }
+	__eq__(o) { if (instanceOf(o, Money)) { self.n == o.n } else { false } }
+	__lt__(o) { self.n < o.n }
+	__str__() { format("$%d", self.n) }
+	__index__(i) { self.n * i }
+};
+`
+
+func TestOperatorHooks(t *testing.T) {
+	runEvalTests(t, []evalTest{
+		{"add", moneyClass + `(Money(1) + Money(2)).n`, "3", ""},
+		{"precedence", moneyClass + `(Money(5) - Money(2) * 2).n`, "1", ""},
+		{"equality", moneyClass + `[Money(1) == Money(1), Money(1) != Money(2), Money(1) == 1, 1 == Money(1)]`, "[true, true, false, false]", ""},
+		{"derived comparisons", moneyClass + `[Money(1) < Money(2), Money(1) <= Money(1), Money(2) > Money(1), Money(1) >= Money(2)]`, "[true, true, true, false]", ""},
+		{"index", moneyClass + `Money(3)[2]`, "6", ""},
+		{"set index", `class B { __setindex__(k, v) { self.last = [k, v] } }
+var b = B()
+b[1] = 2
+b.last`, "[1, 2]", ""},
+		{"str", moneyClass + `format("%s", Money(3))`, "$3", ""},
+		{"identity without __eq__", `class A {}
+var a = A();
+[a == a, a == A()]`, "[true, false]", ""},
+		{"__eq__ of right operand", `class A { __eq__(o) { true } }
+5 == A()`, "true", ""},
+
+		{"undefined operator", moneyClass + `Money(1) / Money(1)`, "", "invalid operation: INSTANCE / INSTANCE"},
+		{"left operand only", moneyClass + `3 * Money(2)`, "", "invalid operation: INT * INSTANCE"},
+		{"no hooks", `class A {}
+A() + 1`, "", "invalid operation: INSTANCE + INT"},
+		{"no __index__", `class A {}
+A()[0]`, "", "invalid operation: cannot index INSTANCE"},
+		{"hook error", `class A { __add__(o) { undefinedName } }
+A() + 1`, "", "invalid identifier: undefinedName"},
+		{"__str__ result", `class A { __str__() { 1 } }
+format("%s", A())`, "", "A.__str__ must return STRING, got INT"},
+	})
+}
+
+func TestPrintCallsStrHook(t *testing.T) {
+	var out bytes.Buffer
+	result := evalSource(t, moneyClass+`print(Money(3), Money(4))`, NewEnv(WithStdout(&out)))
+	checkResult(t, result, "")
+	if got, want := out.String(), "$3\n$4\n"; got != want {
+		t.Errorf("printed %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,185 @@
+package types
+
+import (
+	"fmt"
+	"net"
+	"path/filepath"
+	"strings"
+)
+
+// A Perm is a capability a script must be granted before a builtin may use
+// the corresponding resource of the host.
+type Perm int
+
+const (
+	READ_PERM Perm = iota
+	WRITE_PERM
+	ENV_PERM
+	EXEC_PERM
+	NET_PERM
+)
+
+var perms = map[Perm]string{
+	READ_PERM:  "read",
+	WRITE_PERM: "write",
+	ENV_PERM:   "env",
+	EXEC_PERM:  "exec",
+	NET_PERM:   "net",
+}
+
+func (p Perm) String() string {
+	if s, ok := perms[p]; ok {
+		return s
+	}
+	return ""
+}
+
+// AllowRead grants read access to the given files and directories, or to
+// the whole file system when no paths are given.
+func AllowRead(paths ...string) Option {
+	return func(rt *runtime) {
+		rt.perms[READ_PERM] = grant(absPaths(paths))
+	}
+}
+
+// AllowWrite grants write access to the given files and directories, or to
+// the whole file system when no paths are given.
+func AllowWrite(paths ...string) Option {
+	return func(rt *runtime) {
+		rt.perms[WRITE_PERM] = grant(absPaths(paths))
+	}
+}
+
+// AllowEnv grants access to the given environment variables, or to all of
+// them when no names are given.
+func AllowEnv(names ...string) Option {
+	return func(rt *runtime) {
+		rt.perms[ENV_PERM] = grant(names)
+	}
+}
+
+// AllowExec grants permission to run the given commands, or any command when
+// no commands are given.
+func AllowExec(commands ...string) Option {
+	return func(rt *runtime) {
+		rt.perms[EXEC_PERM] = grant(commands)
+	}
+}
+
+// AllowNet grants network access to the given hosts, written as "host" or
+// "host:port", or to any host when no hosts are given. No builtin uses the
+// network yet: the permission is reserved for those that will, and for the
+// builtins of hosts, which check it with Require.
+func AllowNet(hosts ...string) Option {
+	return func(rt *runtime) {
+		rt.perms[NET_PERM] = grant(hosts)
+	}
+}
+
+// A scope lists the resources a permission was granted for. A nil scope
+// grants every resource.
+type scope []string
+
+func grant(targets []string) scope {
+	if len(targets) == 0 {
+		return nil
+	}
+	return scope(targets)
+}
+
+// Require reports a PERMISSION_DENIED_ERROR unless scripts evaluated in e
+// were granted perm for target, a path, environment variable, command or
+// host depending on perm. Builtins call it before touching the host.
+func (e *Env) Require(perm Perm, target string) *Error {
+	return e.rt.require(perm, target)
+}
+
+func (rt *runtime) require(perm Perm, target string) *Error {
+	s, ok := rt.perms[perm]
+	if ok && s.allows(rt.fs, perm, target) {
+		return nil
+	}
+
+	return &Error{
+		Kind: PERMISSION_DENIED_ERROR,
+		Msg:  fmt.Sprintf("permission denied: %s access to %q requires --allow-%s", perm, target, perm),
+	}
+}
+
+func (s scope) allows(fsys FileSystem, perm Perm, target string) bool {
+	if s == nil {
+		return true
+	}
+
+	switch perm {
+	case READ_PERM, WRITE_PERM:
+		// Symbolic links are resolved so that a link inside an allowed
+		// directory does not give access outside of it.
+		path, err := filepath.Abs(target)
+		if err != nil {
+			return false
+		}
+		path = resolveLinks(fsys, path)
+		for _, allowed := range s {
+			allowed = resolveLinks(fsys, allowed)
+			if path == allowed || strings.HasPrefix(path, allowed+string(filepath.Separator)) {
+				return true
+			}
+		}
+
+	case NET_PERM:
+		host := target
+		if h, _, err := net.SplitHostPort(target); err == nil {
+			host = h
+		}
+		for _, allowed := range s {
+			if target == allowed || host == allowed {
+				return true
+			}
+		}
+
+	default:
+		for _, allowed := range s {
+			if target == allowed {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// resolveLinks returns the absolute path with its symbolic links resolved
+// through fsys, or unchanged if fsys has no links. Paths that do not exist
+// yet, such as files about to be written, are resolved up to their deepest
+// existing directory.
+func resolveLinks(fsys FileSystem, path string) string {
+	links, ok := fsys.(LinkFileSystem)
+	if !ok {
+		return path
+	}
+
+	rest := ""
+	for {
+		if resolved, err := links.EvalSymlinks(path); err == nil {
+			return filepath.Join(resolved, rest)
+		}
+		parent := filepath.Dir(path)
+		if parent == path {
+			return filepath.Join(path, rest)
+		}
+		rest = filepath.Join(filepath.Base(path), rest)
+		path = parent
+	}
+}
+
+func absPaths(paths []string) []string {
+	abs := make([]string, 0, len(paths))
+	for _, path := range paths {
+		if p, err := filepath.Abs(path); err == nil {
+			path = p
+		}
+		abs = append(abs, path)
+	}
+	return abs
+}
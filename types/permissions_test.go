@@ -0,0 +1,183 @@
+package types
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRequirePaths(t *testing.T) {
+	dir := t.TempDir()
+	allowed := filepath.Join(dir, "allowed")
+	secret := filepath.Join(dir, "secret")
+	for _, d := range []string{allowed, secret, allowed + "2"} {
+		if err := os.MkdirAll(d, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink(secret, filepath.Join(allowed, "link")); err != nil {
+		t.Skipf("symlinks unsupported: %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		path  string
+		allow bool
+	}{
+		{"directory", allowed, true},
+		{"file", filepath.Join(allowed, "a.txt"), true},
+		{"new directory", filepath.Join(allowed, "new", "a.txt"), true},
+		{"outside", filepath.Join(secret, "s"), false},
+		{"sibling with prefix", filepath.Join(allowed+"2", "a.txt"), false},
+		{"parent", dir, false},
+		{"dot dot", filepath.Join(allowed, "..", "secret", "s"), false},
+		{"link out", filepath.Join(allowed, "link", "s"), false},
+	}
+
+	env := NewEnv(AllowRead(allowed))
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := env.Require(READ_PERM, tt.path)
+			if tt.allow && err != nil {
+				t.Errorf("Require(%q) = %s, want nil", tt.path, err.Inspect())
+			}
+			if !tt.allow && (err == nil || err.Kind != PERMISSION_DENIED_ERROR) {
+				t.Errorf("Require(%q) = nil, want a PERMISSION_DENIED_ERROR", tt.path)
+			}
+		})
+	}
+
+	if err := env.Require(WRITE_PERM, filepath.Join(allowed, "a.txt")); err == nil {
+		t.Errorf("Require(WRITE_PERM) = nil without AllowWrite")
+	}
+}
+
+// linkFS is a FileSystem whose symbolic links are the map from their paths
+// to their targets.
+type linkFS struct {
+	FileSystem
+	links map[string]string
+}
+
+func (fsys linkFS) EvalSymlinks(name string) (string, error) {
+	for link, target := range fsys.links {
+		if name == link || strings.HasPrefix(name, link+string(filepath.Separator)) {
+			return target + strings.TrimPrefix(name, link), nil
+		}
+	}
+	return name, nil
+}
+
+// plainFS is a FileSystem without symbolic links.
+type plainFS struct {
+	FileSystem
+}
+
+func TestRequireResolvesLinksOfFileSystem(t *testing.T) {
+	dir := t.TempDir()
+	allowed := filepath.Join(dir, "allowed")
+	secret := filepath.Join(dir, "secret")
+	// A link of the operating system that other file systems do not have.
+	if err := os.MkdirAll(allowed, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(secret, filepath.Join(allowed, "os")); err != nil {
+		t.Skipf("symlinks unsupported: %v", err)
+	}
+
+	links := linkFS{links: map[string]string{filepath.Join(allowed, "mem"): secret}}
+	tests := []struct {
+		name  string
+		fsys  FileSystem
+		path  string
+		allow bool
+	}{
+		{"link of file system", links, filepath.Join(allowed, "mem", "s"), false},
+		{"link of os", links, filepath.Join(allowed, "os", "s"), true},
+		{"no links", plainFS{}, filepath.Join(allowed, "os", "s"), true},
+		{"no links outside", plainFS{}, filepath.Join(secret, "s"), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := NewEnv(WithFileSystem(tt.fsys), AllowRead(allowed))
+			err := env.Require(READ_PERM, tt.path)
+			if tt.allow && err != nil {
+				t.Errorf("Require(%q) = %s, want nil", tt.path, err.Inspect())
+			}
+			if !tt.allow && err == nil {
+				t.Errorf("Require(%q) = nil, want a PERMISSION_DENIED_ERROR", tt.path)
+			}
+		})
+	}
+}
+
+func TestRequireNames(t *testing.T) {
+	tests := []struct {
+		name   string
+		opts   []Option
+		perm   Perm
+		target string
+		allow  bool
+	}{
+		{"env not granted", nil, ENV_PERM, "HOME", false},
+		{"env granted", []Option{AllowEnv()}, ENV_PERM, "HOME", true},
+		{"env variable granted", []Option{AllowEnv("HOME", "USER")}, ENV_PERM, "USER", true},
+		{"env other variable", []Option{AllowEnv("HOME")}, ENV_PERM, "PATH", false},
+		{"exec not granted", nil, EXEC_PERM, "ls", false},
+		{"exec granted", []Option{AllowExec()}, EXEC_PERM, "ls", true},
+		{"exec command granted", []Option{AllowExec("ls")}, EXEC_PERM, "ls", true},
+		{"exec other command", []Option{AllowExec("ls")}, EXEC_PERM, "rm", false},
+		{"net host granted", []Option{AllowNet("example.com")}, NET_PERM, "example.com:443", true},
+		{"net port granted", []Option{AllowNet("example.com:80")}, NET_PERM, "example.com:80", true},
+		{"net other port", []Option{AllowNet("example.com:80")}, NET_PERM, "example.com:443", false},
+		{"net other host", []Option{AllowNet("example.com")}, NET_PERM, "example.org", false},
+		{"other permission", []Option{AllowEnv()}, EXEC_PERM, "ls", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := NewEnv(tt.opts...).Require(tt.perm, tt.target)
+			if tt.allow && err != nil {
+				t.Errorf("Require(%s, %q) = %s, want nil", tt.perm, tt.target, err.Inspect())
+			}
+			if !tt.allow && (err == nil || err.Kind != PERMISSION_DENIED_ERROR) {
+				t.Errorf("Require(%s, %q) = nil, want a PERMISSION_DENIED_ERROR", tt.perm, tt.target)
+			}
+		})
+	}
+}
+
+func TestOSBuiltins(t *testing.T) {
+	t.Setenv("MASH_TEST_VAR", "mash")
+	if _, err := os.Stat("/bin/echo"); err != nil {
+		t.Skipf("no echo command: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		src  string
+		opts []Option
+		want string
+	}{
+		{"getenv", `os.getenv("MASH_TEST_VAR")`, []Option{AllowEnv("MASH_TEST_VAR")}, "mash"},
+		{"getenv unset", `os.getenv("MASH_TEST_UNSET")`, []Option{AllowEnv()}, "null"},
+		{"getenv denied", `os.getenv("MASH_TEST_VAR")`, []Option{AllowEnv("HOME")},
+			`ERROR: permission denied: env access to "MASH_TEST_VAR" requires --allow-env`},
+		{"exec", `os.exec("/bin/echo", "hi")`, []Option{AllowExec("/bin/echo")}, "hi\n"},
+		{"exec denied", `os.exec("/bin/echo", "hi")`, nil,
+			`ERROR: permission denied: exec access to "/bin/echo" requires --allow-exec`},
+		{"exec without command", `os.exec()`, []Option{AllowExec()},
+			"ERROR: wrong number of arguments to os.exec: want at least 1, got 0"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := evalSource(t, tt.src, NewEnv(tt.opts...))
+			if result.Inspect() != tt.want {
+				t.Errorf("Eval = %q, want %q", result.Inspect(), tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,101 @@
+package types
+
+import (
+	"context"
+
+	"github.com/gramidt/mash-lang-for-codemash/ast"
+)
+
+// A RecordType is declared by record Name { fields }. Calling it with one
+// argument per field constructs a Record.
+type RecordType struct {
+	Name   string
+	Fields []string
+}
+
+func (rt *RecordType) Type() ObjType   { return RECORD_TYPE_OBJ }
+func (rt *RecordType) Inspect() string { return "<record " + rt.Name + ">" }
+func (rt *RecordType) IsTruthy() bool  { return true }
+
+// fieldIndex returns the position of the field called name.
+func (rt *RecordType) fieldIndex(name string) (int, bool) {
+	for i, field := range rt.Fields {
+		if field == name {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// A Record is an immutable value of a RecordType. Records are equal when
+// they have the same type and equal fields.
+type Record struct {
+	RecordType *RecordType
+	Values     []Object // in the order of RecordType.Fields
+}
+
+func (r *Record) Type() ObjType   { return RECORD_OBJ }
+func (r *Record) Inspect() string { return inspect(r) }
+func (r *Record) parts() ([]string, []Object) {
+	return fieldParts(r.RecordType.Name+"{", r.RecordType.Fields, r.Values, "}"), r.Values
+}
+func (r *Record) IsTruthy() bool { return true }
+
+// Get returns the field called name, if there is one.
+func (r *Record) Get(name string) (Object, bool) {
+	i, ok := r.RecordType.fieldIndex(name)
+	if !ok {
+		return nil, false
+	}
+	return r.Values[i], true
+}
+
+func evalRecordStmt(node *ast.RecordStmt, env *Env) Object {
+	typ := &RecordType{Name: node.Name.Value, Fields: make([]string, len(node.Fields))}
+	for i, field := range node.Fields {
+		typ.Fields[i] = field.Value
+	}
+
+	if result := env.Set(typ.Name, typ); isError(result) {
+		return result
+	}
+	return nil
+}
+
+// newRecord constructs a Record of typ from one argument per field.
+func newRecord(typ *RecordType, args []Object, env *Env) Object {
+	if len(args) != len(typ.Fields) {
+		return newError("wrong number of arguments to %s: want %d, got %d", typ.Name, len(typ.Fields), len(args))
+	}
+	return env.rt.track(&Record{RecordType: typ, Values: append([]Object{}, args...)})
+}
+
+// evalWithExpr returns a copy of a Record with some of its fields replaced.
+func evalWithExpr(ctx context.Context, node *ast.WithExpr, env *Env) Object {
+	x := eval(ctx, node.X, env)
+	if isError(x) {
+		return x
+	}
+
+	rec, ok := x.(*Record)
+	if !ok {
+		return newError("invalid operation: %s with {...}, want RECORD", x.Type().String())
+	}
+
+	values := append([]Object{}, rec.Values...)
+	for _, field := range node.Fields {
+		name := field.Key.(*ast.Ident).Value
+		i, ok := rec.RecordType.fieldIndex(name)
+		if !ok {
+			return newError("record %s has no field %s", rec.RecordType.Name, name)
+		}
+
+		value := eval(ctx, field.Value, env)
+		if isError(value) {
+			return value
+		}
+		values[i] = value
+	}
+
+	return env.rt.track(&Record{RecordType: rec.RecordType, Values: values})
+}
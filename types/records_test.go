@@ -0,0 +1,65 @@
+package types
+
+import "testing"
+
+func TestRecords(t *testing.T) {
+	runEvalTests(t, []evalTest{
+		{"inspect", `record Point { x, y }
+Point(1, 2)`, "Point{x: 1, y: 2}", ""},
+		{"nested inspect", `record P { x }
+P(P(1))`, "P{x: P{x: 1}}", ""},
+		{"equal", `record Point { x, y }
+Point(1, 2) == Point(1, 2)`, "true", ""},
+		{"different fields", `record Point { x, y }
+Point(1, 2) == Point(1, 3)`, "false", ""},
+		{"nested equal", `record P { x }
+P(P(1)) == P(P(1))`, "true", ""},
+		{"different types", `record A { x }
+record B { x }
+A(1) == B(1)`, "false", ""},
+		{"cyclic inspect", `record P { x }
+var xs = [1]
+var p = P(xs)
+xs[0] = p
+p`, "P{x: [[...]]}", ""},
+		{"fields compare as ==", `record L { xs }
+L([1]) == L([1])`, "false", ""},
+		{"with", `record Point { x, y }
+var p = Point(1, 2)
+var q = p with { x: 3 };
+[p, q]`, "[Point{x: 1, y: 2}, Point{x: 3, y: 2}]", ""},
+		{"field selectors", `record P { x, y }
+var p = P(1, 2)
+p.x + p.y`, "3", ""},
+		{"destructuring", `record P { x, y }
+var {x, y} = P(1, 2)
+x + y`, "3", ""},
+		{"match", `record P { x, y }
+match (P(1, 2)) { {x, y: 2} => x }`, "1", ""},
+
+		{"with unknown field", `record Point { x, y }
+Point(1, 2) with { z: 3 }`, "", "record Point has no field z"},
+		{"unknown field", `record P { x, y }
+P(1, 2).z`, "", "record P has no field z"},
+		{"with non-record", `5 with { x: 1 }`, "", "invalid operation: INT with {...}, want RECORD"},
+		{"constructor arity", `record Point { x, y }
+Point(1)`, "", "wrong number of arguments to Point: want 2, got 1"},
+		{"assignment", `record Point { x, y }
+Point(1, 2).x = 5`, "", "cannot assign to field x of record Point, records are immutable; use with to copy it"},
+	})
+}
+
+func TestCyclicRecordEquality(t *testing.T) {
+	typ := &RecordType{Name: "P", Fields: []string{"x"}}
+	a := &Record{RecordType: typ, Values: []Object{nil}}
+	b := &Record{RecordType: typ, Values: []Object{nil}}
+	a.Values[0], b.Values[0] = a, b
+
+	if got := a.Inspect(); got != "P{x: [...]}" {
+		t.Errorf("Inspect() = %q, want %q", got, "P{x: [...]}")
+	}
+	equal, err := objectsEqual(a, b)
+	if err == nil || err.Msg != "cannot compare cyclic values" {
+		t.Errorf("objectsEqual(a, b) = %v, %v, want the cyclic values error", equal, err)
+	}
+}
@@ -0,0 +1,236 @@
+package types
+
+import (
+	"context"
+	"regexp"
+	"unicode/utf8"
+
+	"github.com/gramidt/mash-lang-for-codemash/ast"
+)
+
+// maxCachedRegexps bounds the compiled patterns kept by a runtime. Once it is
+// reached the cache starts over, so that scripts building patterns
+// dynamically cannot grow it without limit.
+const maxCachedRegexps = 256
+
+// A Regex is a compiled regular expression, written /pattern/flags or built
+// with regex(pattern, flags). The syntax is that of Go's regexp package.
+type Regex struct {
+	Pattern string
+	Flags   string
+	Re      *regexp.Regexp
+}
+
+func (r *Regex) Type() ObjType   { return REGEX_OBJ }
+func (r *Regex) Inspect() string { return "/" + r.Pattern + "/" + r.Flags }
+func (r *Regex) IsTruthy() bool  { return true }
+
+var regexMethods = map[string]*Builtin{
+	"test":     {Name: "test", Fun: regexTest, Arity: 2},
+	"match":    {Name: "match", Fun: regexMatch, Arity: 2},
+	"matchAll": {Name: "matchAll", Fun: regexMatchAll, Arity: 2},
+	"findAll":  {Name: "findAll", Fun: regexFindAll, Arity: 2},
+	"replace":  {Name: "replace", Fun: regexReplace, Arity: 3},
+	"split":    {Name: "split", Fun: regexSplit, Arity: 2},
+}
+
+// compileRegex returns pattern compiled with flags, reusing the compiled
+// pattern of an earlier call if there is one.
+func (rt *runtime) compileRegex(pattern, flags string) (*Regex, *Error) {
+	for _, flag := range flags {
+		switch flag {
+		case 'i', 'm', 's', 'U':
+		default:
+			return nil, newError("invalid regular expression flag %q", flag)
+		}
+	}
+
+	key := flags + "/" + pattern
+	if re, ok := rt.regexps[key]; ok {
+		return re, nil
+	}
+
+	source := pattern
+	if flags != "" {
+		source = "(?" + flags + ")" + pattern
+	}
+
+	compiled, err := regexp.Compile(source)
+	if err != nil {
+		return nil, newError("invalid regular expression /%s/%s: %s", pattern, flags, err)
+	}
+
+	if len(rt.regexps) >= maxCachedRegexps {
+		rt.regexps = make(map[string]*Regex)
+	}
+
+	re := &Regex{Pattern: pattern, Flags: flags, Re: compiled}
+	rt.regexps[key] = re
+	return re, nil
+}
+
+func evalRegexLit(node *ast.RegexLit, env *Env) Object {
+	re, err := env.rt.compileRegex(node.Pattern, node.Flags)
+	if err != nil {
+		return err
+	}
+	return re
+}
+
+// regex compiles its pattern argument, with the flags of the optional second
+// argument.
+func regex(ctx context.Context, env *Env, args ...Object) Object {
+	if len(args) != 1 && len(args) != 2 {
+		return newError("wrong number of arguments to regex: want 1 or 2, got %d", len(args))
+	}
+
+	pattern, err := stringArg("regex", args, 0)
+	if err != nil {
+		return err
+	}
+
+	flags := ""
+	if len(args) == 2 {
+		if flags, err = stringArg("regex", args, 1); err != nil {
+			return err
+		}
+	}
+
+	re, err := env.rt.compileRegex(pattern, flags)
+	if err != nil {
+		return err
+	}
+	return re
+}
+
+func regexTest(ctx context.Context, env *Env, args ...Object) Object {
+	s, err := stringArg("test", args, 1)
+	if err != nil {
+		return err
+	}
+	return nativeBool(args[0].(*Regex).Re.MatchString(s))
+}
+
+// regexMatch returns the first match in a String as a Map, or null if there
+// is none. See matchMap for its keys.
+func regexMatch(ctx context.Context, env *Env, args ...Object) Object {
+	s, err := stringArg("match", args, 1)
+	if err != nil {
+		return err
+	}
+
+	re := args[0].(*Regex).Re
+	loc := re.FindStringSubmatchIndex(s)
+	if loc == nil {
+		return NULL
+	}
+	return env.rt.track(matchMap(re, s, loc))
+}
+
+// regexMatchAll returns every match in a String as an Array of the Maps
+// returned by match.
+func regexMatchAll(ctx context.Context, env *Env, args ...Object) Object {
+	s, err := stringArg("matchAll", args, 1)
+	if err != nil {
+		return err
+	}
+
+	re := args[0].(*Regex).Re
+	locs := re.FindAllStringSubmatchIndex(s, -1)
+
+	matches := make([]Object, len(locs))
+	for i, loc := range locs {
+		m := env.rt.track(matchMap(re, s, loc))
+		if isError(m) {
+			return m
+		}
+		matches[i] = m
+	}
+	return env.rt.track(&Array{Elems: matches})
+}
+
+// regexFindAll returns the text of every match in a String.
+func regexFindAll(ctx context.Context, env *Env, args ...Object) Object {
+	s, err := stringArg("findAll", args, 1)
+	if err != nil {
+		return err
+	}
+	return env.rt.track(stringArray(args[0].(*Regex).Re.FindAllString(s, -1)))
+}
+
+// regexReplace replaces every match in a String. A String replacement may
+// refer to groups as $1 or ${name}; a function replacement is called with
+// the Map of each match and must return a String.
+func regexReplace(ctx context.Context, env *Env, args ...Object) Object {
+	s, err := stringArg("replace", args, 1)
+	if err != nil {
+		return err
+	}
+
+	re := args[0].(*Regex).Re
+	switch repl := args[2].(type) {
+	case *String:
+		return env.rt.track(&String{Value: re.ReplaceAllString(s, repl.Value)})
+	case *Fun, *Builtin:
+	default:
+		return newError("replacement passed to replace must be STRING or FUNCTION, got %s", repl.Type().String())
+	}
+
+	var out []byte
+	last := 0
+	for _, loc := range re.FindAllStringSubmatchIndex(s, -1) {
+		result := applyFunction(ctx, env, "replace", args[2], []Object{matchMap(re, s, loc)})
+		if isError(result) {
+			return result
+		}
+		str, ok := result.(*String)
+		if !ok {
+			return newError("replacement function passed to replace must return STRING")
+		}
+
+		out = append(out, s[last:loc[0]]...)
+		out = append(out, str.Value...)
+		last = loc[1]
+	}
+	out = append(out, s[last:]...)
+
+	return env.rt.track(&String{Value: string(out)})
+}
+
+// regexSplit splits a String around each match.
+func regexSplit(ctx context.Context, env *Env, args ...Object) Object {
+	s, err := stringArg("split", args, 1)
+	if err != nil {
+		return err
+	}
+	return env.rt.track(stringArray(args[0].(*Regex).Re.Split(s, -1)))
+}
+
+// matchMap describes the match of re in s at the submatch indexes loc. Its
+// "text" is the matched text, "index" the character index of the match,
+// "groups" an Array of the capture groups, with null for groups that did
+// not participate, and "named" a Map of the named capture groups.
+func matchMap(re *regexp.Regexp, s string, loc []int) *Map {
+	group := func(i int) Object {
+		if loc[2*i] < 0 {
+			return NULL
+		}
+		return &String{Value: s[loc[2*i]:loc[2*i+1]]}
+	}
+
+	groups := make([]Object, re.NumSubexp())
+	named := NewMap()
+	for i, name := range re.SubexpNames()[1:] {
+		groups[i] = group(i + 1)
+		if name != "" {
+			named.Set(&String{Value: name}, groups[i])
+		}
+	}
+
+	m := NewMap()
+	m.Set(&String{Value: "text"}, group(0))
+	m.Set(&String{Value: "index"}, &Int{Value: int64(utf8.RuneCountInString(s[:loc[0]]))})
+	m.Set(&String{Value: "groups"}, &Array{Elems: groups})
+	m.Set(&String{Value: "named"}, named)
+	return m
+}
@@ -0,0 +1,36 @@
+package types
+
+import "testing"
+
+func TestRegexMatchMethod(t *testing.T) {
+	src := `var m = /(\d+)-(?P<b>\d+)/.match("a 12-34");
+[m.text, m.index, m.groups, m.named.b]`
+	result := evalSource(t, src, NewEnv())
+	if got, want := result.Inspect(), "[12-34, 2, [12, 34], 34]"; got != want {
+		t.Errorf("match = %s, want %s", got, want)
+	}
+}
+
+func TestRegexMethods(t *testing.T) {
+	runEvalTests(t, []evalTest{
+		{"literal flags", `/a+/i.test("xAAy")`, "true", ""},
+		{"multiline flag", `/^b/m.test("a\nb")`, "true", ""},
+		{"built regex", `regex("a.c", "s").test("a\nc")`, "true", ""},
+		{"no match", `/z/.match("abc")`, "null", ""},
+		{"index counts characters", `/é(.)/.match("xéy").index`, "1", ""},
+		{"matchAll named groups", `/(?P<d>\d)/.matchAll("a1b2").map(fun(m) { m.named.d })`, "[1, 2]", ""},
+		{"findAll", `/\d+/.findAll("a12b3")`, "[12, 3]", ""},
+		{"replace", `/\d/.replace("a1b2", "#")`, "a#b#", ""},
+		{"replace with groups", `/(a)/.replace("ab", "[$1]")`, "[a]b", ""},
+		{"replace with function", `/\d/.replace("a1b2", fun(m) { m.text + m.text })`, "a11b22", ""},
+		{"split", `/,\s*/.split("a, b,c")`, "[a, b, c]", ""},
+		{"division", `var a = 6
+var b = 2
+a / b / 1`, "3", ""},
+
+		{"invalid pattern", `regex("(")`, "", "invalid regular expression /(/: error parsing regexp: missing closing ): `(`"},
+		{"invalid flag", `regex("a", "q")`, "", "invalid regular expression flag 'q'"},
+		{"argument type", `/a/.test(1)`, "", "argument 1 to test must be STRING, got INT"},
+		{"replacement result", `/a/.replace("a", fun(m) { 1 })`, "", "replacement function passed to replace must return STRING"},
+	})
+}
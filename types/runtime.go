@@ -0,0 +1,296 @@
+package types
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync/atomic"
+)
+
+// DefaultMaxDepth is the maximum call depth used when WithMaxDepth is not
+// given.
+const DefaultMaxDepth = 10000
+
+// DefaultMaxTasks is the maximum number of tasks running at once used when
+// WithMaxTasks is not given.
+const DefaultMaxTasks = 10000
+
+// stackOverflowFrames is the number of innermost frames reported by a
+// STACK_OVERFLOW_ERROR.
+const stackOverflowFrames = 5
+
+// An Option configures the runtime shared by an Env and every Env enclosed
+// by it.
+type Option func(*runtime)
+
+// WithStepBudget limits each call of Eval to n steps, where a step is a
+// function call or a loop iteration. A budget of zero means no limit.
+func WithStepBudget(n int64) Option {
+	return func(rt *runtime) {
+		rt.maxSteps = n
+	}
+}
+
+// WithMaxDepth limits the number of nested function calls to n. Exceeding it
+// stops evaluation with a STACK_OVERFLOW_ERROR instead of exhausting the Go
+// stack. The calls of async functions and generator bodies count as nested
+// in the calls starting them.
+func WithMaxDepth(n int) Option {
+	return func(rt *runtime) {
+		rt.maxDepth = n
+	}
+}
+
+// WithMaxTasks limits the number of tasks started by spawn running at once
+// to n. Spawning more fails with a TASK_LIMIT_ERROR.
+func WithMaxTasks(n int) Option {
+	return func(rt *runtime) {
+		rt.maxTasks = n
+	}
+}
+
+// WithMemoryLimit stops evaluation with a MEMORY_LIMIT_ERROR once the
+// memory in use would exceed n bytes. The memory in use is measured as for
+// Stats.PeakMemory whenever the allocations since the last measurement could
+// exceed the limit, so values no longer reachable from variables do not
+// count against it. A limit of zero means no limit.
+func WithMemoryLimit(n int64) Option {
+	return func(rt *runtime) {
+		rt.maxAlloc = n
+	}
+}
+
+// Stats reports the resources used by the last call of Eval in an Env.
+type Stats struct {
+	// Steps is the number of function calls and loop iterations.
+	Steps int64
+	// TotalAllocated is the approximate number of bytes allocated for
+	// strings, arrays, maps, closures and the environments of function calls.
+	// It never decreases, as objects are not tracked once created.
+	TotalAllocated int64
+	// PeakMemory is the largest approximate number of bytes found in use,
+	// counting the values reachable from the variables of the runtime and of
+	// the function calls in progress, and the values held by builtins in
+	// progress. The memory in use is measured from time to time as memory is
+	// allocated, so short-lived peaks between measurements may be missed.
+	PeakMemory int64
+	// PeakDepth is the deepest call depth reached.
+	PeakDepth int64
+}
+
+type runtime struct {
+	maxSteps  int64
+	steps     int64
+	maxDepth  int
+	peakDepth int64
+	maxTasks  int
+	maxAlloc  int64
+	allocated int64
+	mem       memory
+	perms     map[Perm]scope
+	fs        FileSystem
+	stdout    io.Writer
+
+	root *Env // the Env of NewEnv, whose builtins modules see
+
+	modulePath []string
+	modules    map[string]*Namespace // by absolute path
+	loading    []string              // modules being loaded, for cycle detection
+
+	prelude        *Namespace
+	loadingPrelude bool
+
+	regexps map[string]*Regex // compiled patterns by flags and pattern
+
+	sched      *scheduler
+	loop       *eventLoop
+	generators map[*generator]struct{} // started, see closeGenerators
+}
+
+func newRuntime(opts ...Option) *runtime {
+	rt := &runtime{
+		maxDepth: DefaultMaxDepth,
+		maxTasks: DefaultMaxTasks,
+		perms:    make(map[Perm]scope),
+		fs:       OSFileSystem{},
+		stdout:   os.Stdout,
+
+		modulePath: defaultModulePath(),
+		modules:    make(map[string]*Namespace),
+		regexps:    make(map[string]*Regex),
+
+		loop: newEventLoop(),
+
+		generators: make(map[*generator]struct{}),
+	}
+	rt.sched = newScheduler(rt)
+	for _, opt := range opts {
+		opt(rt)
+	}
+	return rt
+}
+
+// reset starts the accounting of a call of Eval in env: the step budget is
+// refilled and the Stats start over, but for the memory still in use.
+func (rt *runtime) reset(env *Env) {
+	atomic.StoreInt64(&rt.steps, 0)
+	atomic.StoreInt64(&rt.allocated, 0)
+	atomic.StoreInt64(&rt.peakDepth, 0)
+	rt.mem.reset(env)
+}
+
+// step records one unit of work and reports whether evaluation must stop.
+func (rt *runtime) step(ctx context.Context) *Error {
+	if err := ctx.Err(); err != nil {
+		return contextError(err)
+	}
+
+	steps := atomic.AddInt64(&rt.steps, 1)
+	if rt.maxSteps > 0 && steps > rt.maxSteps {
+		return &Error{Kind: BUDGET_EXCEEDED_ERROR, Msg: "step budget exceeded"}
+	}
+	if steps%preemptSteps == 0 {
+		rt.sched.preempt(ctx)
+	}
+
+	return nil
+}
+
+// contextError returns the Error stopping evaluation when its context is
+// done with err.
+func contextError(err error) *Error {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return &Error{Kind: TIMEOUT_ERROR, Msg: "evaluation timed out"}
+	}
+	return &Error{Kind: CANCELED_ERROR, Msg: "evaluation canceled"}
+}
+
+type callStackKey struct{}
+
+// A callStack records the function calls in progress in one thread of
+// evaluation. It travels in the context so that every thread has its own.
+// The bodies of async calls and generators run in threads of their own on
+// top of the calls that start them, which base counts towards the call
+// depth.
+type callStack struct {
+	frames []frame
+	base   int // the depth of the calls the stack runs on top of
+}
+
+// depth returns the call depth of the thread evaluating with ctx.
+func depth(ctx context.Context) int {
+	stack, ok := ctx.Value(callStackKey{}).(*callStack)
+	if !ok {
+		return 0
+	}
+	return stack.base + len(stack.frames)
+}
+
+// A frame is a function call in progress, with the Env of its variables.
+type frame struct {
+	name string
+	env  *Env
+}
+
+// pushFrame enters the function called name, whose variables are in env,
+// returning the context to evaluate its body with.
+func (rt *runtime) pushFrame(ctx context.Context, name string, env *Env) (context.Context, *Error) {
+	stack, ok := ctx.Value(callStackKey{}).(*callStack)
+	if !ok {
+		stack = &callStack{}
+		ctx = context.WithValue(ctx, callStackKey{}, stack)
+	}
+
+	if stack.base+len(stack.frames) >= rt.maxDepth {
+		frames := make([]string, 0, stackOverflowFrames)
+		for i := len(stack.frames) - 1; i >= 0 && len(frames) < stackOverflowFrames; i-- {
+			frames = append(frames, stack.frames[i].name)
+		}
+		return ctx, &Error{
+			Kind:   STACK_OVERFLOW_ERROR,
+			Msg:    fmt.Sprintf("maximum call depth of %d exceeded", rt.maxDepth),
+			Frames: frames,
+		}
+	}
+
+	rt.mem.push(stack, frame{name: name, env: env})
+
+	depth := int64(stack.base + len(stack.frames))
+	for {
+		peak := atomic.LoadInt64(&rt.peakDepth)
+		if depth <= peak || atomic.CompareAndSwapInt64(&rt.peakDepth, peak, depth) {
+			break
+		}
+	}
+
+	return ctx, nil
+}
+
+// popFrame leaves the function entered by the matching pushFrame.
+func (rt *runtime) popFrame(ctx context.Context) {
+	rt.mem.pop(ctx.Value(callStackKey{}).(*callStack))
+}
+
+// Approximate sizes in bytes of the objects accounted by track.
+const (
+	objectSize  = 16
+	envSize     = 64
+	funSize     = 64
+	mapPairSize = 64
+)
+
+// track accounts for the memory used by the newly allocated obj, returning
+// either obj or a MEMORY_LIMIT_ERROR.
+func (rt *runtime) track(obj Object) Object {
+	if err := rt.alloc(sizeOf(obj)); err != nil {
+		return err
+	}
+	return obj
+}
+
+// sizeOf returns the approximate size in bytes of obj, without the objects
+// it refers to.
+func sizeOf(obj Object) int64 {
+	size := int64(objectSize)
+
+	switch obj := obj.(type) {
+	case *String:
+		size += int64(len(obj.Value))
+	case *Array:
+		size += int64(len(obj.Elems)) * objectSize
+	case *Map:
+		size += int64(len(obj.Pairs)) * mapPairSize
+	case *Record:
+		size += int64(len(obj.Values)) * objectSize
+	case *EnumValue:
+		size += int64(len(obj.Values)) * objectSize
+	case *Fun:
+		size += funSize
+	}
+	return size
+}
+
+// alloc accounts for size bytes of memory, measuring the memory in use when
+// it is due, and fails if that would exceed the memory limit.
+func (rt *runtime) alloc(size int64) *Error {
+	atomic.AddInt64(&rt.allocated, size)
+	inUse := rt.mem.alloc(rt, size)
+	if rt.maxAlloc > 0 && inUse > rt.maxAlloc {
+		return &Error{
+			Kind: MEMORY_LIMIT_ERROR,
+			Msg:  fmt.Sprintf("memory limit of %d bytes exceeded", rt.maxAlloc),
+		}
+	}
+	return nil
+}
+
+func (rt *runtime) stats() Stats {
+	return Stats{
+		Steps:          atomic.LoadInt64(&rt.steps),
+		TotalAllocated: atomic.LoadInt64(&rt.allocated),
+		PeakMemory:     rt.mem.peakInUse(),
+		PeakDepth:      atomic.LoadInt64(&rt.peakDepth),
+	}
+}
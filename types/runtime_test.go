@@ -0,0 +1,107 @@
+package types
+
+import (
+	"fmt"
+	"reflect"
+	goruntime "runtime"
+	"testing"
+	"time"
+)
+
+func TestMaxDepthAcrossThreads(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+	}{
+		{"async", `var f = async fun(n) { await f(n + 1) }
+await f(0)`},
+		{"generator", `var g = fun(n) { for (x in g(n + 1)) { yield x } }
+for (x in g(0)) { x }`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := goruntime.NumGoroutine()
+			env := NewEnv(WithMaxDepth(100))
+			result := evalSource(t, tt.src, env)
+			if err, ok := result.(*Error); !ok || err.Kind != STACK_OVERFLOW_ERROR {
+				t.Fatalf("Eval = %s, want a STACK_OVERFLOW_ERROR", result.Inspect())
+			}
+			if depth := env.Stats().PeakDepth; depth != 100 {
+				t.Errorf("PeakDepth = %d, want 100", depth)
+			}
+			waitForGoroutines(t, before)
+		})
+	}
+}
+
+func TestStackOverflow(t *testing.T) {
+	tests := []struct {
+		name   string
+		src    string
+		frames []string
+	}{
+		{"recursion", `var f = fun(n) { f(n + 1) }
+f(0)`, []string{"f", "f", "f", "f", "f"}},
+		{"mutual recursion", `var even = fun(n) { odd(n + 1) }
+var odd = fun(n) { even(n + 1) }
+even(0)`, []string{"odd", "even", "odd", "even", "odd"}},
+		{"builtin callback", `[1].map(fun(x) { var g = fun() { g() }; g() })`, []string{"g", "g", "g", "g", "g"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := NewEnv(WithMaxDepth(20))
+			result := evalSource(t, tt.src, env)
+			err, ok := result.(*Error)
+			if !ok || err.Kind != STACK_OVERFLOW_ERROR || err.Msg != "maximum call depth of 20 exceeded" {
+				t.Fatalf("Eval = %s, want a STACK_OVERFLOW_ERROR", result.Inspect())
+			}
+			if !reflect.DeepEqual(err.Frames, tt.frames) {
+				t.Errorf("Frames = %q, want %q", err.Frames, tt.frames)
+			}
+			if depth := env.Stats().PeakDepth; depth != 20 {
+				t.Errorf("PeakDepth = %d, want 20", depth)
+			}
+
+			// The Env is still usable after the overflow.
+			if result := evalSource(t, `var h = fun(n) { if (n == 20) { "ok" } else { h(n + 1) } }
+h(1)`, env); result.Inspect() != "ok" {
+				t.Errorf("Eval after the overflow = %s, want ok", result.Inspect())
+			}
+		})
+	}
+}
+
+func TestDefaultMaxDepth(t *testing.T) {
+	result := evalSource(t, `var f = fun(n) { f(n + 1) }
+f(0)`, NewEnv())
+	want := fmt.Sprintf("maximum call depth of %d exceeded", DefaultMaxDepth)
+	if err, ok := result.(*Error); !ok || err.Kind != STACK_OVERFLOW_ERROR || err.Msg != want {
+		t.Errorf("Eval = %s, want the STACK_OVERFLOW_ERROR %q", result.Inspect(), want)
+	}
+}
+
+func TestMaxTasks(t *testing.T) {
+	src := `var ch = chan()
+var spawnAll = fun(n) { if (n > 0) { spawn recv(ch); spawnAll(n - 1) } }
+spawnAll(20)`
+	result := evalSource(t, src, NewEnv(WithMaxTasks(10)))
+	if err, ok := result.(*Error); !ok || err.Kind != TASK_LIMIT_ERROR {
+		t.Errorf("Eval = %s, want a TASK_LIMIT_ERROR", result.Inspect())
+	}
+}
+
+// waitForGoroutines fails the test unless the goroutines started since
+// there were n exit soon.
+func waitForGoroutines(t *testing.T, n int) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for goruntime.NumGoroutine() > n {
+		if time.Now().After(deadline) {
+			t.Errorf("%d goroutines left running", goruntime.NumGoroutine()-n)
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
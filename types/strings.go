@@ -0,0 +1,327 @@
+package types
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// stringMethods are the methods of String values. Lengths, indexes and
+// padding count characters (runes), not bytes.
+var stringMethods = map[string]*Builtin{
+	"len":        {Name: "len", Fun: length, Arity: 1},
+	"upper":      {Name: "upper", Fun: stringUpper, Arity: 1},
+	"lower":      {Name: "lower", Fun: stringLower, Arity: 1},
+	"trim":       {Name: "trim", Fun: stringTrim, Arity: VariadicArity},
+	"trimLeft":   {Name: "trimLeft", Fun: stringTrimLeft, Arity: VariadicArity},
+	"trimRight":  {Name: "trimRight", Fun: stringTrimRight, Arity: VariadicArity},
+	"trimPrefix": {Name: "trimPrefix", Fun: stringTrimPrefix, Arity: 2},
+	"trimSuffix": {Name: "trimSuffix", Fun: stringTrimSuffix, Arity: 2},
+	"split":      {Name: "split", Fun: stringSplit, Arity: 2},
+	"join":       {Name: "join", Fun: stringJoin, Arity: 2},
+	"replace":    {Name: "replace", Fun: stringReplace, Arity: 3},
+	"contains":   {Name: "contains", Fun: stringContains, Arity: 2},
+	"startsWith": {Name: "startsWith", Fun: stringStartsWith, Arity: 2},
+	"endsWith":   {Name: "endsWith", Fun: stringEndsWith, Arity: 2},
+	"indexOf":    {Name: "indexOf", Fun: stringIndexOf, Arity: 2},
+	"repeat":     {Name: "repeat", Fun: stringRepeat, Arity: 2},
+	"padLeft":    {Name: "padLeft", Fun: stringPadLeft, Arity: VariadicArity},
+	"padRight":   {Name: "padRight", Fun: stringPadRight, Arity: VariadicArity},
+	"chars":      {Name: "chars", Fun: stringChars, Arity: 1},
+	"format":     {Name: "format", Fun: format, Arity: VariadicArity},
+}
+
+func stringUpper(ctx context.Context, env *Env, args ...Object) Object {
+	return env.rt.track(&String{Value: strings.ToUpper(args[0].(*String).Value)})
+}
+
+func stringLower(ctx context.Context, env *Env, args ...Object) Object {
+	return env.rt.track(&String{Value: strings.ToLower(args[0].(*String).Value)})
+}
+
+// stringTrim removes leading and trailing white space, or the characters
+// of the optional cutset argument.
+func stringTrim(ctx context.Context, env *Env, args ...Object) Object {
+	return trimWith("trim", strings.TrimSpace, strings.Trim, env, args)
+}
+
+func stringTrimLeft(ctx context.Context, env *Env, args ...Object) Object {
+	trimSpace := func(s string) string { return strings.TrimLeftFunc(s, unicode.IsSpace) }
+	return trimWith("trimLeft", trimSpace, strings.TrimLeft, env, args)
+}
+
+func stringTrimRight(ctx context.Context, env *Env, args ...Object) Object {
+	trimSpace := func(s string) string { return strings.TrimRightFunc(s, unicode.IsSpace) }
+	return trimWith("trimRight", trimSpace, strings.TrimRight, env, args)
+}
+
+func trimWith(name string, trimSpace func(string) string, trimCutset func(string, string) string, env *Env, args []Object) Object {
+	if len(args) > 2 {
+		return newError("wrong number of arguments to %s: want 0 or 1, got %d", name, len(args)-1)
+	}
+
+	s := args[0].(*String).Value
+	if len(args) == 1 {
+		return env.rt.track(&String{Value: trimSpace(s)})
+	}
+
+	cutset, err := stringArg(name, args, 1)
+	if err != nil {
+		return err
+	}
+	return env.rt.track(&String{Value: trimCutset(s, cutset)})
+}
+
+func stringTrimPrefix(ctx context.Context, env *Env, args ...Object) Object {
+	prefix, err := stringArg("trimPrefix", args, 1)
+	if err != nil {
+		return err
+	}
+	return env.rt.track(&String{Value: strings.TrimPrefix(args[0].(*String).Value, prefix)})
+}
+
+func stringTrimSuffix(ctx context.Context, env *Env, args ...Object) Object {
+	suffix, err := stringArg("trimSuffix", args, 1)
+	if err != nil {
+		return err
+	}
+	return env.rt.track(&String{Value: strings.TrimSuffix(args[0].(*String).Value, suffix)})
+}
+
+// stringSplit splits a String around each occurrence of a separator, or
+// into characters if the separator is empty.
+func stringSplit(ctx context.Context, env *Env, args ...Object) Object {
+	sep, err := stringArg("split", args, 1)
+	if err != nil {
+		return err
+	}
+	return env.rt.track(stringArray(strings.Split(args[0].(*String).Value, sep)))
+}
+
+// stringJoin concatenates the Strings of an Array, separated by the String
+// the method is called on.
+func stringJoin(ctx context.Context, env *Env, args ...Object) Object {
+	arr, ok := args[1].(*Array)
+	if !ok {
+		return newError("argument to join must be ARRAY, got %s", args[1].Type().String())
+	}
+
+	strs := make([]string, len(arr.Elems))
+	for i, elem := range arr.Elems {
+		s, ok := elem.(*String)
+		if !ok {
+			return newError("elements joined by join must be STRING, got %s", elem.Type().String())
+		}
+		strs[i] = s.Value
+	}
+
+	return env.rt.track(&String{Value: strings.Join(strs, args[0].(*String).Value)})
+}
+
+// arrayJoin is join called on the Array instead of the separator.
+func arrayJoin(ctx context.Context, env *Env, args ...Object) Object {
+	if _, ok := args[1].(*String); !ok {
+		return newError("argument to join must be STRING, got %s", args[1].Type().String())
+	}
+	return stringJoin(ctx, env, args[1], args[0])
+}
+
+func stringReplace(ctx context.Context, env *Env, args ...Object) Object {
+	old, err := stringArg("replace", args, 1)
+	if err != nil {
+		return err
+	}
+	new, err := stringArg("replace", args, 2)
+	if err != nil {
+		return err
+	}
+	return env.rt.track(&String{Value: strings.ReplaceAll(args[0].(*String).Value, old, new)})
+}
+
+func stringContains(ctx context.Context, env *Env, args ...Object) Object {
+	substr, err := stringArg("contains", args, 1)
+	if err != nil {
+		return err
+	}
+	return nativeBool(strings.Contains(args[0].(*String).Value, substr))
+}
+
+func stringStartsWith(ctx context.Context, env *Env, args ...Object) Object {
+	prefix, err := stringArg("startsWith", args, 1)
+	if err != nil {
+		return err
+	}
+	return nativeBool(strings.HasPrefix(args[0].(*String).Value, prefix))
+}
+
+func stringEndsWith(ctx context.Context, env *Env, args ...Object) Object {
+	suffix, err := stringArg("endsWith", args, 1)
+	if err != nil {
+		return err
+	}
+	return nativeBool(strings.HasSuffix(args[0].(*String).Value, suffix))
+}
+
+// stringIndexOf returns the character index of the first occurrence of a
+// substring, or -1.
+func stringIndexOf(ctx context.Context, env *Env, args ...Object) Object {
+	substr, err := stringArg("indexOf", args, 1)
+	if err != nil {
+		return err
+	}
+
+	s := args[0].(*String).Value
+	i := strings.Index(s, substr)
+	if i < 0 {
+		return &Int{Value: -1}
+	}
+	return &Int{Value: int64(utf8.RuneCountInString(s[:i]))}
+}
+
+func stringRepeat(ctx context.Context, env *Env, args ...Object) Object {
+	n, err := intArg("repeat", args, 1)
+	if err != nil {
+		return err
+	}
+	if n < 0 {
+		return newError("negative count passed to repeat: %d", n)
+	}
+
+	s := args[0].(*String).Value
+	if err := allocRepeat(env, "repeat", s, int64(n)); err != nil {
+		return err
+	}
+	return &String{Value: strings.Repeat(s, int(n))}
+}
+
+// maxStringLength is the length in bytes of the longest String repeat,
+// padLeft and padRight create, whether or not a memory limit is set, so
+// that a script cannot make the host run out of memory at once.
+const maxStringLength = 1 << 28
+
+// allocRepeat accounts for the memory of n copies of s, failing if they
+// would be longer than maxStringLength.
+func allocRepeat(env *Env, name string, s string, n int64) *Error {
+	if len(s) > 0 && n > maxStringLength/int64(len(s)) {
+		return newError("count passed to %s is too large: %d, the result may be at most %d bytes", name, n, maxStringLength)
+	}
+	return env.rt.alloc(int64(len(s)) * n)
+}
+
+// stringPadLeft prepends a pad String, a space by default, until the String
+// is at least the given number of characters long.
+func stringPadLeft(ctx context.Context, env *Env, args ...Object) Object {
+	return padWith("padLeft", true, env, args)
+}
+
+func stringPadRight(ctx context.Context, env *Env, args ...Object) Object {
+	return padWith("padRight", false, env, args)
+}
+
+func padWith(name string, left bool, env *Env, args []Object) Object {
+	if len(args) != 2 && len(args) != 3 {
+		return newError("wrong number of arguments to %s: want 1 or 2, got %d", name, len(args)-1)
+	}
+
+	width, err := intArg(name, args, 1)
+	if err != nil {
+		return err
+	}
+
+	pad := " "
+	if len(args) == 3 {
+		if pad, err = stringArg(name, args, 2); err != nil {
+			return err
+		}
+		if pad == "" {
+			return newError("empty pad passed to %s", name)
+		}
+	}
+
+	if width > maxStringLength {
+		return newError("width passed to %s is too large: %d, at most %d", name, width, maxStringLength)
+	}
+
+	s := args[0].(*String).Value
+	missing := int(width) - utf8.RuneCountInString(s)
+	if missing <= 0 {
+		return args[0]
+	}
+
+	if err := allocRepeat(env, name, pad, int64(missing)); err != nil {
+		return err
+	}
+	padding := []rune(strings.Repeat(pad, missing))[:missing]
+	if left {
+		return env.rt.track(&String{Value: string(padding) + s})
+	}
+	return env.rt.track(&String{Value: s + string(padding)})
+}
+
+func stringChars(ctx context.Context, env *Env, args ...Object) Object {
+	return env.rt.track(stringArray(strings.Split(args[0].(*String).Value, "")))
+}
+
+// format formats its arguments like Go's fmt.Sprintf. Strings, Ints, Floats
+// and Bools are passed as their Go values, so verbs such as %d, %.2f and %q
+// work, and everything else is passed as its Inspect output.
+func format(ctx context.Context, env *Env, args ...Object) Object {
+	if len(args) == 0 {
+		return newError("wrong number of arguments to format: want at least 1, got 0")
+	}
+
+	layout, err := stringArg("format", args, 0)
+	if err != nil {
+		return err
+	}
+
+	values := make([]interface{}, len(args)-1)
+	for i, arg := range args[1:] {
+		switch arg := arg.(type) {
+		case *String:
+			values[i] = arg.Value
+		case *Int:
+			values[i] = arg.Value
+		case *Float:
+			values[i] = arg.Value
+		case *Bool:
+			values[i] = arg.Value
+		default:
+			s, err := display(ctx, env, arg)
+			if err != nil {
+				return err
+			}
+			values[i] = s
+		}
+	}
+
+	return env.rt.track(&String{Value: fmt.Sprintf(layout, values...)})
+}
+
+func stringArray(strs []string) *Array {
+	elems := make([]Object, len(strs))
+	for i, s := range strs {
+		elems[i] = &String{Value: s}
+	}
+	return &Array{Elems: elems}
+}
+
+// stringArg returns args[i] of the builtin called name as a Go string.
+func stringArg(name string, args []Object, i int) (string, *Error) {
+	s, ok := args[i].(*String)
+	if !ok {
+		return "", newError("argument %d to %s must be STRING, got %s", i, name, args[i].Type().String())
+	}
+	return s.Value, nil
+}
+
+// intArg returns args[i] of the builtin called name as a Go int64.
+func intArg(name string, args []Object, i int) (int64, *Error) {
+	n, ok := args[i].(*Int)
+	if !ok {
+		return 0, newError("argument %d to %s must be INT, got %s", i, name, args[i].Type().String())
+	}
+	return n.Value, nil
+}
@@ -0,0 +1,45 @@
+package types
+
+import "testing"
+
+func TestStringMethods(t *testing.T) {
+	runEvalTests(t, []evalTest{
+		{"len counts characters", `"héllo".len()`, "5", ""},
+		{"upper", `"école".upper()`, "ÉCOLE", ""},
+		{"lower", `"ÉCOLE".lower()`, "école", ""},
+		{"trim", `"  a b\n".trim()`, "a b", ""},
+		{"trim cutset", `"xxaxx".trim("x")`, "a", ""},
+		{"trimLeft", `"  a ".trimLeft() + "|"`, "a |", ""},
+		{"trimRight", `" a  ".trimRight() + "|"`, " a|", ""},
+		{"trimLeft cutset", `"xxa".trimLeft("x")`, "a", ""},
+		{"trimPrefix", `"prefix-a".trimPrefix("prefix-")`, "a", ""},
+		{"trimSuffix", `"a.go".trimSuffix(".go")`, "a", ""},
+		{"split", `"a,b,,c".split(",")`, "[a, b, , c]", ""},
+		{"split characters", `"héllo".split("")`, "[h, é, l, l, o]", ""},
+		{"join", `",".join(["a", "b"])`, "a,b", ""},
+		{"replace", `"aaa".replace("a", "b")`, "bbb", ""},
+		{"contains", `"héllo".contains("é")`, "true", ""},
+		{"startsWith", `"héllo".startsWith("hé")`, "true", ""},
+		{"endsWith", `"héllo".endsWith("hé")`, "false", ""},
+		{"indexOf counts characters", `"héllo".indexOf("l")`, "2", ""},
+		{"indexOf missing", `"héllo".indexOf("z")`, "-1", ""},
+		{"repeat", `"ab".repeat(3)`, "ababab", ""},
+		{"padLeft", `"é".padLeft(3) + "|"`, "  é|", ""},
+		{"padLeft with pad", `"é".padLeft(3, "*")`, "**é", ""},
+		{"padRight with pad", `"é".padRight(3, "*")`, "é**", ""},
+		{"chars", `"héllo".chars()`, "[h, é, l, l, o]", ""},
+		{"format", `"%s=%d %.2f %v".format("a", 1, 1.5, [1])`, "a=1 1.50 [1]", ""},
+		{"format width counts characters", `format("%3s|", "é")`, "  é|", ""},
+		{"len builtin", `[len("héllo"), len("")]`, "[5, 0]", ""},
+		{"slice builtin", `[slice("héllo", 1, 3), slice("héllo", 3, 99)]`, "[él, lo]", ""},
+		{"std helpers", `import "std/strings";
+[strings.reverse("héllo"), strings.padLeft("é", 3, "*"), strings.padRight("é", 3, "*"), strings.join(["a", "b"], "-")]`, "[olléh, **é, é**, a-b]", ""},
+
+		{"negative repeat", `"a".repeat(-1)`, "", "negative count passed to repeat: -1"},
+		{"overflowing repeat", `"ab".repeat(4611686018427387904)`, "", "count passed to repeat is too large: 4611686018427387904, the result may be at most 268435456 bytes"},
+		{"long repeat", `"a".repeat(268435457)`, "", "count passed to repeat is too large: 268435457, the result may be at most 268435456 bytes"},
+		{"wide pad", `"a".padLeft(268435457)`, "", "width passed to padLeft is too large: 268435457, at most 268435456"},
+		{"empty pad", `"a".padLeft(3, "")`, "", "empty pad passed to padLeft"},
+		{"argument type", `"a".split(1)`, "", "argument 1 to split must be STRING, got INT"},
+	})
+}
@@ -0,0 +1,627 @@
+package types
+
+import (
+	"context"
+	"fmt"
+	goruntime "runtime"
+	"sync"
+
+	"github.com/gramidt/mash-lang-for-codemash/ast"
+)
+
+// preemptSteps is the number of steps after which a task lets the other
+// tasks of its runtime run.
+const preemptSteps = 1024
+
+// The task builtins block, so they are added by init to avoid an
+// initialization cycle.
+func init() {
+	builtins["chan"] = &Builtin{Name: "chan", Fun: newChannel, Arity: VariadicArity}
+	builtins["send"] = &Builtin{Name: "send", Fun: chanSend, Arity: 2}
+	builtins["recv"] = &Builtin{Name: "recv", Fun: chanRecv, Arity: 1}
+	builtins["close"] = &Builtin{Name: "close", Fun: chanClose, Arity: 1}
+	builtins["waitGroup"] = &Builtin{Name: "waitGroup", Fun: newWaitGroup, Arity: 0}
+}
+
+var taskMethods = map[ObjType]map[string]*Builtin{
+	CHANNEL_OBJ: {
+		"send":  {Name: "send", Fun: chanSend, Arity: 2},
+		"recv":  {Name: "recv", Fun: chanRecv, Arity: 1},
+		"close": {Name: "close", Fun: chanClose, Arity: 1},
+		"len":   {Name: "len", Fun: chanLen, Arity: 1},
+	},
+	TASK_OBJ: {
+		"wait": {Name: "wait", Fun: taskWait, Arity: 1},
+	},
+	WAIT_GROUP_OBJ: {
+		"add":  {Name: "add", Fun: waitGroupAdd, Arity: VariadicArity},
+		"done": {Name: "done", Fun: waitGroupDone, Arity: 1},
+		"wait": {Name: "wait", Fun: waitGroupWait, Arity: 1},
+	},
+}
+
+// A scheduler lets the tasks of a runtime take turns: a task evaluates only
+// while it holds the lock of the scheduler, which it releases when it blocks
+// on a channel, wait group or other task, and every preemptSteps steps. The
+// values shared by tasks, such as the Envs of closures, are therefore never
+// accessed concurrently.
+type scheduler struct {
+	lock sync.Mutex
+	rt   *runtime
+	idle chan struct{} // wakes a task sleeping in virtual time, see detectDeadlock
+
+	// The fields below are guarded by lock.
+	active   int                  // tasks evaluating or waiting for lock
+	blocked  map[*waiter]struct{} // tasks blocked until a waiter fires
+	sleeping int                  // blocked tasks also waiting for a timer
+	tasks    []*Task              // spawned tasks not done yet, oldest first
+	failed   []*Task              // tasks done with an Error, see unwaitedError
+}
+
+func newScheduler(rt *runtime) *scheduler {
+	return &scheduler{
+		rt:      rt,
+		idle:    make(chan struct{}, 1),
+		blocked: make(map[*waiter]struct{}),
+	}
+}
+
+type taskKey struct{}
+
+// enter makes the caller of Eval a task of s, returning the context marking
+// it as such and the function to call once it is done. Tasks already
+// holding the lock enter again without taking it, and outer reports false.
+// They are recognized by their context, so a builtin calling Eval or Apply
+// must pass on the context it was called with: with any other, enter would
+// wait for the lock held by the builtin's own task forever.
+func (s *scheduler) enter(ctx context.Context) (_ context.Context, leave func(), outer bool) {
+	if ctx.Value(taskKey{}) == s {
+		return ctx, func() {}, false
+	}
+	s.lock.Lock()
+	s.active++
+	return context.WithValue(ctx, taskKey{}, s), s.exit, true
+}
+
+// exit ends the current task.
+func (s *scheduler) exit() {
+	s.active--
+	s.detectDeadlock()
+	s.lock.Unlock()
+}
+
+// preempt lets other tasks run, if there are any.
+func (s *scheduler) preempt(ctx context.Context) {
+	if ctx.Value(taskKey{}) != s || s.active <= 1 {
+		return
+	}
+	s.lock.Unlock()
+	goruntime.Gosched()
+	s.lock.Lock()
+}
+
+// A waiter is fired to unblock a task, with the outcome of the operation
+// it waits for.
+type waiter struct {
+	ready chan struct{}
+	fired bool
+	index int    // the select case that proceeded
+	value Object // the value received
+	ok    bool   // false if the channel was closed
+	err   *Error
+}
+
+func newWaiter() *waiter {
+	return &waiter{ready: make(chan struct{}, 1)}
+}
+
+// wait blocks the current task until w is fired or ctx is done. Unless the
+// event loop is running already, the task runs it meanwhile, so that the
+// callbacks of timers and async calls can unblock it.
+func (s *scheduler) wait(ctx context.Context, w *waiter) *Error {
+	if l := s.rt.loop; !l.running {
+		if err := l.runUntilFired(ctx, s.rt, w); err != nil || w.fired {
+			if err != nil {
+				w.fired = true
+				return err
+			}
+			return w.err
+		}
+	}
+
+	s.blocked[w] = struct{}{}
+	s.active--
+	s.detectDeadlock()
+	s.lock.Unlock()
+
+	select {
+	case <-w.ready:
+		s.lock.Lock()
+		return w.err
+	case <-ctx.Done():
+		s.lock.Lock()
+		if !w.fired {
+			w.fired = true
+			delete(s.blocked, w)
+			s.active++
+		}
+		return contextError(ctx.Err())
+	}
+}
+
+func (s *scheduler) fire(w *waiter, index int, value Object, ok bool, err *Error) {
+	w.fired, w.index, w.value, w.ok, w.err = true, index, value, ok, err
+	// The task running the event loop is not blocked while it runs the
+	// callback firing w.
+	if _, ok := s.blocked[w]; ok {
+		delete(s.blocked, w)
+		s.active++
+	}
+	w.ready <- struct{}{}
+}
+
+// detectDeadlock fails the blocked tasks once no task is left to unblock
+// them, so that their goroutines exit. Tasks are not deadlocked while a
+// timer is left to fire; in virtual time it fires right away.
+func (s *scheduler) detectDeadlock() {
+	if s.active > 0 {
+		return
+	}
+	if s.sleeping > 0 {
+		select {
+		case s.idle <- struct{}{}:
+		default:
+		}
+		return
+	}
+	for w := range s.blocked {
+		s.fire(w, 0, nil, false, newError("deadlock: all tasks are blocked"))
+	}
+}
+
+// A Task is a function call started by spawn, running alongside the task
+// that spawned it. Eval waits for the tasks spawned while it runs, see Eval.
+type Task struct {
+	Name    string
+	done    bool
+	waited  bool // set once a script waits for the task
+	result  Object
+	waiters []*waiter
+}
+
+func (t *Task) Type() ObjType   { return TASK_OBJ }
+func (t *Task) Inspect() string { return "<task " + t.Name + ">" }
+func (t *Task) IsTruthy() bool  { return true }
+
+func evalSpawnExpr(ctx context.Context, node *ast.SpawnExpr, env *Env) Object {
+	fun := eval(ctx, node.Call.Fun, env)
+	if isError(fun) {
+		return fun
+	}
+
+	args := evalExprs(ctx, node.Call.Args, env)
+	if len(args) == 1 && isError(args[0]) {
+		return args[0]
+	}
+
+	return spawn(ctx, callName(node.Call.Fun), fun, args, env)
+}
+
+// spawn starts a task calling fun with args. The task has a call stack of
+// its own, and is not part of the generator spawning it, if any.
+func spawn(ctx context.Context, name string, fun Object, args []Object, env *Env) Object {
+	s := env.rt.sched
+	if len(s.tasks) >= env.rt.maxTasks {
+		return &Error{
+			Kind: TASK_LIMIT_ERROR,
+			Msg:  fmt.Sprintf("cannot spawn %s: limit of %d running tasks reached", name, env.rt.maxTasks),
+		}
+	}
+	if err := env.rt.alloc(envSize); err != nil {
+		return err
+	}
+
+	task := &Task{Name: name}
+	ctx = context.WithValue(ctx, callStackKey{}, &callStack{})
+	ctx = context.WithValue(ctx, generatorKey{}, (*generator)(nil))
+
+	s.active++
+	s.tasks = append(s.tasks, task)
+	go func() {
+		s.lock.Lock()
+		result := applyFunction(ctx, env, name, fun, args)
+		if result == nil {
+			result = NULL
+		}
+
+		task.done, task.result = true, result
+		if isError(result) {
+			s.failed = append(s.failed, task)
+		}
+		for i, t := range s.tasks {
+			if t == task {
+				s.tasks = append(s.tasks[:i], s.tasks[i+1:]...)
+				break
+			}
+		}
+		for _, w := range task.waiters {
+			if !w.fired {
+				s.fire(w, 0, result, true, nil)
+			}
+		}
+		task.waiters = nil
+
+		s.exit()
+	}()
+
+	return task
+}
+
+// taskWait waits for a task to return, returning its result.
+func taskWait(ctx context.Context, env *Env, args ...Object) Object {
+	task := args[0].(*Task)
+	task.waited = true
+	if err := env.rt.sched.waitTask(ctx, task); err != nil {
+		return err
+	}
+	return task.result
+}
+
+// waitTask blocks the current task until task is done.
+func (s *scheduler) waitTask(ctx context.Context, task *Task) *Error {
+	if task.done {
+		return nil
+	}
+	w := newWaiter()
+	task.waiters = append(task.waiters, w)
+	return s.wait(ctx, w)
+}
+
+// unwaitedError returns the Error of the first task that failed without a
+// script waiting for it, which would otherwise be lost, and forgets the
+// failed tasks.
+func (s *scheduler) unwaitedError() *Error {
+	failed := s.failed
+	s.failed = nil
+	for _, task := range failed {
+		if !task.waited {
+			return task.result.(*Error)
+		}
+	}
+	return nil
+}
+
+// join blocks the current task until every spawned task is done.
+func (s *scheduler) join(ctx context.Context) *Error {
+	for len(s.tasks) > 0 {
+		if err := s.waitTask(ctx, s.tasks[0]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// A Channel passes values between tasks, in the order they are sent. Sending
+// blocks while the buffer of the channel is full, and receiving while it is
+// empty.
+type Channel struct {
+	cap    int
+	buf    []Object
+	closed bool
+	recvq  []*chanWaiter
+	sendq  []*chanWaiter
+}
+
+func (ch *Channel) Type() ObjType   { return CHANNEL_OBJ }
+func (ch *Channel) Inspect() string { return "<channel>" }
+func (ch *Channel) IsTruthy() bool  { return true }
+
+// A chanWaiter is a task blocked sending value to or receiving from a
+// channel, for the select case index.
+type chanWaiter struct {
+	w     *waiter
+	index int
+	value Object
+}
+
+// popWaiter removes the first waiter of q that has not fired yet.
+func popWaiter(q *[]*chanWaiter) (*chanWaiter, bool) {
+	for len(*q) > 0 {
+		cw := (*q)[0]
+		*q = (*q)[1:]
+		if !cw.w.fired {
+			return cw, true
+		}
+	}
+	return nil, false
+}
+
+// trySend sends v if it can without blocking, reporting whether it did.
+func (ch *Channel) trySend(s *scheduler, v Object) (bool, *Error) {
+	if ch.closed {
+		return false, newError("send on closed channel")
+	}
+	if cw, ok := popWaiter(&ch.recvq); ok {
+		s.fire(cw.w, cw.index, v, true, nil)
+		return true, nil
+	}
+	if len(ch.buf) < ch.cap {
+		ch.buf = append(ch.buf, v)
+		return true, nil
+	}
+	return false, nil
+}
+
+// tryRecv receives a value if it can without blocking, reporting whether
+// it did, and whether the value was sent rather than the channel closed.
+func (ch *Channel) tryRecv(s *scheduler) (value Object, ok bool, ready bool) {
+	if len(ch.buf) > 0 {
+		value = ch.buf[0]
+		ch.buf = ch.buf[1:]
+		if cw, ok := popWaiter(&ch.sendq); ok {
+			ch.buf = append(ch.buf, cw.value)
+			s.fire(cw.w, cw.index, nil, true, nil)
+		}
+		return value, true, true
+	}
+	if cw, ok := popWaiter(&ch.sendq); ok {
+		s.fire(cw.w, cw.index, nil, true, nil)
+		return cw.value, true, true
+	}
+	if ch.closed {
+		return NULL, false, true
+	}
+	return nil, false, false
+}
+
+func (ch *Channel) send(ctx context.Context, s *scheduler, v Object) *Error {
+	ok, err := ch.trySend(s, v)
+	if ok || err != nil {
+		return err
+	}
+	w := newWaiter()
+	ch.sendq = append(ch.sendq, &chanWaiter{w: w, value: v})
+	return s.wait(ctx, w)
+}
+
+func (ch *Channel) recv(ctx context.Context, s *scheduler) (Object, bool, *Error) {
+	if value, ok, ready := ch.tryRecv(s); ready {
+		return value, ok, nil
+	}
+	w := newWaiter()
+	ch.recvq = append(ch.recvq, &chanWaiter{w: w})
+	if err := s.wait(ctx, w); err != nil {
+		return nil, false, err
+	}
+	return w.value, w.ok, nil
+}
+
+// newChannel returns a Channel buffering up to n values, by default none.
+func newChannel(ctx context.Context, env *Env, args ...Object) Object {
+	if len(args) > 1 {
+		return newError("wrong number of arguments to chan: want 0 or 1, got %d", len(args))
+	}
+	ch := &Channel{}
+	if len(args) == 1 {
+		n, err := intArg("chan", args, 0)
+		if err != nil {
+			return err
+		}
+		if n < 0 {
+			return newError("chan buffer size must not be negative, got %d", n)
+		}
+		ch.cap = int(n)
+	}
+	return env.rt.track(ch)
+}
+
+func channelArg(name string, args []Object, i int) (*Channel, *Error) {
+	ch, ok := args[i].(*Channel)
+	if !ok {
+		return nil, newError("argument %d to %s must be CHANNEL, got %s", i, name, args[i].Type().String())
+	}
+	return ch, nil
+}
+
+// chanSend sends a value on a channel, blocking until it is received or
+// buffered.
+func chanSend(ctx context.Context, env *Env, args ...Object) Object {
+	ch, err := channelArg("send", args, 0)
+	if err != nil {
+		return err
+	}
+	if err := ch.send(ctx, env.rt.sched, args[1]); err != nil {
+		return err
+	}
+	return NULL
+}
+
+// chanRecv receives a value from a channel, blocking until one is sent. It
+// returns null once the channel is closed and drained.
+func chanRecv(ctx context.Context, env *Env, args ...Object) Object {
+	ch, err := channelArg("recv", args, 0)
+	if err != nil {
+		return err
+	}
+	value, _, err := ch.recv(ctx, env.rt.sched)
+	if err != nil {
+		return err
+	}
+	return value
+}
+
+// chanClose closes a channel: the values buffered can still be received,
+// but no more can be sent.
+func chanClose(ctx context.Context, env *Env, args ...Object) Object {
+	ch, err := channelArg("close", args, 0)
+	if err != nil {
+		return err
+	}
+	if ch.closed {
+		return newError("close of closed channel")
+	}
+	ch.closed = true
+
+	s := env.rt.sched
+	for cw, ok := popWaiter(&ch.recvq); ok; cw, ok = popWaiter(&ch.recvq) {
+		s.fire(cw.w, cw.index, NULL, false, nil)
+	}
+	for cw, ok := popWaiter(&ch.sendq); ok; cw, ok = popWaiter(&ch.sendq) {
+		s.fire(cw.w, cw.index, nil, false, newError("send on closed channel"))
+	}
+	return NULL
+}
+
+// chanLen returns the number of values buffered by a channel.
+func chanLen(ctx context.Context, env *Env, args ...Object) Object {
+	return &Int{Value: int64(len(args[0].(*Channel).buf))}
+}
+
+// evalSelectExpr evaluates the body of the first case whose channel
+// operation can proceed, or else the _ case if there is one, or else blocks
+// until one of the operations proceeds. The channels and values of every
+// case are evaluated first, in order.
+func evalSelectExpr(ctx context.Context, node *ast.SelectExpr, env *Env) Object {
+	s := env.rt.sched
+
+	chans := make([]*Channel, len(node.Cases))
+	values := make([]Object, len(node.Cases))
+	for i, c := range node.Cases {
+		obj := eval(ctx, c.Chan, env)
+		if isError(obj) {
+			return obj
+		}
+		ch, ok := obj.(*Channel)
+		if !ok {
+			return newError("select case must use a CHANNEL, got %s", obj.Type().String())
+		}
+		chans[i] = ch
+
+		if c.Value != nil {
+			value := eval(ctx, c.Value, env)
+			if isError(value) {
+				return value
+			}
+			if value == nil {
+				value = NULL
+			}
+			values[i] = value
+		}
+	}
+
+	for i, c := range node.Cases {
+		if c.Value != nil {
+			ok, err := chans[i].trySend(s, values[i])
+			if err != nil {
+				return err
+			}
+			if ok {
+				return evalSelectCase(ctx, c, nil, env)
+			}
+		} else if value, _, ready := chans[i].tryRecv(s); ready {
+			return evalSelectCase(ctx, c, value, env)
+		}
+	}
+
+	if node.Default != nil {
+		result := eval(ctx, node.Default, NewEnclosedEnv(env))
+		if result == nil {
+			return NULL
+		}
+		return result
+	}
+
+	w := newWaiter()
+	for i, c := range node.Cases {
+		cw := &chanWaiter{w: w, index: i, value: values[i]}
+		if c.Value != nil {
+			chans[i].sendq = append(chans[i].sendq, cw)
+		} else {
+			chans[i].recvq = append(chans[i].recvq, cw)
+		}
+	}
+	if err := s.wait(ctx, w); err != nil {
+		return err
+	}
+	return evalSelectCase(ctx, node.Cases[w.index], w.value, env)
+}
+
+func evalSelectCase(ctx context.Context, c *ast.SelectCase, value Object, env *Env) Object {
+	caseEnv := NewEnclosedEnv(env)
+	if c.Pattern != nil {
+		if err := bindPattern(ctx, c.Pattern, value, caseEnv); err != nil {
+			return err
+		}
+	}
+
+	result := eval(ctx, c.Body, caseEnv)
+	if result == nil {
+		return NULL
+	}
+	return result
+}
+
+// A WaitGroup waits for a number of tasks to be done: add increments the
+// number, done decrements it, and wait blocks until it is zero.
+type WaitGroup struct {
+	count   int64
+	waiters []*waiter
+}
+
+func (wg *WaitGroup) Type() ObjType   { return WAIT_GROUP_OBJ }
+func (wg *WaitGroup) Inspect() string { return "<wait group>" }
+func (wg *WaitGroup) IsTruthy() bool  { return true }
+
+func newWaitGroup(ctx context.Context, env *Env, args ...Object) Object {
+	return env.rt.track(&WaitGroup{})
+}
+
+// add adds delta to the count of wg, unblocking its waiters at zero.
+func (wg *WaitGroup) add(s *scheduler, delta int64) Object {
+	if wg.count+delta < 0 {
+		return newError("negative wait group counter")
+	}
+	wg.count += delta
+	if wg.count == 0 {
+		for _, w := range wg.waiters {
+			if !w.fired {
+				s.fire(w, 0, nil, true, nil)
+			}
+		}
+		wg.waiters = nil
+	}
+	return NULL
+}
+
+// waitGroupAdd adds n, by default 1, to the count of a wait group.
+func waitGroupAdd(ctx context.Context, env *Env, args ...Object) Object {
+	if len(args) < 1 || len(args) > 2 {
+		return newError("wrong number of arguments to add: want 0 or 1, got %d", len(args)-1)
+	}
+	delta := int64(1)
+	if len(args) == 2 {
+		n, err := intArg("add", args, 1)
+		if err != nil {
+			return err
+		}
+		delta = n
+	}
+	return args[0].(*WaitGroup).add(env.rt.sched, delta)
+}
+
+func waitGroupDone(ctx context.Context, env *Env, args ...Object) Object {
+	return args[0].(*WaitGroup).add(env.rt.sched, -1)
+}
+
+func waitGroupWait(ctx context.Context, env *Env, args ...Object) Object {
+	wg := args[0].(*WaitGroup)
+	if wg.count == 0 {
+		return NULL
+	}
+	w := newWaiter()
+	wg.waiters = append(wg.waiters, w)
+	if err := env.rt.sched.wait(ctx, w); err != nil {
+		return err
+	}
+	return NULL
+}
@@ -0,0 +1,103 @@
+package types
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestTasks(t *testing.T) {
+	tests := []struct {
+		name    string
+		src     string
+		out     string
+		wantErr string
+	}{
+		{"unbuffered channel", `var ch = chan()
+spawn fun() { send(ch, 1); send(ch, 2); close(ch) }()
+for (x in ch) { print(x) }`, "1\n2\n", ""},
+		{"buffered channel", `var ch = chan(2)
+send(ch, "a")
+ch.send("b")
+print(ch.len(), recv(ch), ch.recv())`, "2\na\nb\n", ""},
+		{"closed channel", `var ch = chan(1)
+send(ch, 1)
+close(ch)
+print(recv(ch), recv(ch))`, "1\nnull\n", ""},
+		{"send on closed channel", `var ch = chan()
+close(ch)
+send(ch, 1)`, "", "send on closed channel"},
+		{"close of closed channel", `var ch = chan()
+close(ch)
+close(ch)`, "", "close of closed channel"},
+		{"negative buffer", `chan(-1)`, "", "chan buffer size must not be negative, got -1"},
+		{"select default", `var ch = chan()
+select { recv(ch) as x => print(x), _ => print("none") }`, "none\n", ""},
+		{"select ready case", `var a = chan(1)
+var b = chan(1)
+send(b, "b")
+select { recv(a) as x => print("a", x), recv(b) as x => print("b", x) }`, "b\nb\n", ""},
+		{"select send", `var ch = chan(1)
+select { send(ch, 7) => print("sent"), _ => print("full") }
+select { send(ch, 8) => print("sent"), _ => print("full") }
+print(recv(ch))`, "sent\nfull\n7\n", ""},
+		{"select blocks", `var ch = chan()
+spawn fun() { send(ch, "late") }()
+print(select { recv(ch) as x => x })`, "late\n", ""},
+		{"select on closed channel", `var ch = chan()
+close(ch)
+select { recv(ch) as x => print(x) }`, "null\n", ""},
+		{"wait group", `var wg = waitGroup()
+var results = chan(3)
+for (i in range(1, 4)) {
+	wg.add()
+	spawn fun(n) { send(results, n * 10); wg.done() }(i)
+}
+wg.wait()
+var total = 0
+for (i in range(3)) { total = total + recv(results) }
+print(total)`, "60\n", ""},
+		{"negative wait group", `waitGroup().done()`, "", "negative wait group counter"},
+		{"task wait", `var t = spawn fun(x) { x + 1 }(41)
+print(t.wait(), t.wait())`, "42\n42\n", ""},
+		{"wait on spawn", `var double = fun(x) { x * 2 }
+print(spawn double(21).wait())`, "42\n", ""},
+		{"task error", `var t = spawn fun() { undefinedName }()
+t.wait()`, "", "invalid identifier: undefinedName"},
+		{"error of unwaited task", `var fail = fun() { undefinedName }
+spawn fail()
+print("main done")`, "main done\n", "invalid identifier: undefinedName"},
+		{"spawn non-function", `var x = 1
+spawn x()
+print("main done")`, "main done\n", "invalid function: INT"},
+		{"deadlock", `var ch = chan()
+recv(ch)`, "", "deadlock: all tasks are blocked"},
+		{"deadlock of tasks", `var a = chan()
+var b = chan()
+spawn fun() { recv(a); send(b, 1) }()
+recv(b)`, "", "deadlock: all tasks are blocked"},
+		{"preemption", `var done = false
+spawn fun() { done = true }()
+var seen = false
+for (i in range(10000)) { if (done) { seen = true } }
+print(seen)`, "true\n", ""},
+		{"tasks are joined", `spawn fun() {
+	for (i in range(3000)) {}
+	print("task done")
+}()
+print("main done")`, "main done\ntask done\n", ""},
+		{"tasks are canceled on failure", `var ch = chan()
+spawn fun() { recv(ch); print("not reached") }()
+undefinedName`, "", "invalid identifier: undefinedName"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			result := evalSource(t, tt.src, NewEnv(WithStdout(&out)))
+			checkResult(t, result, tt.wantErr)
+			if got := out.String(); got != tt.out {
+				t.Errorf("printed %q, want %q", got, tt.out)
+			}
+		})
+	}
+}
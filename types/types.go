@@ -1,7 +1,13 @@
 package types
 
 import (
+	"context"
 	"fmt"
+	"hash/fnv"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 
 	"github.com/gramidt/mash-lang-for-codemash/ast"
 )
@@ -12,9 +18,30 @@ const (
 	NULL_OBJ ObjType = iota
 	ERROR_OBJ
 	BOOL_OBJ
+	INT_OBJ
+	FLOAT_OBJ
 	STRING_OBJ
+	ARRAY_OBJ
+	MAP_OBJ
 	FUN_OBJ
 	BUILTIN_OBJ
+	NAMESPACE_OBJ
+	REGEX_OBJ
+	RECORD_TYPE_OBJ
+	RECORD_OBJ
+	CLASS_OBJ
+	INSTANCE_OBJ
+	SUPER_OBJ
+	ENUM_OBJ
+	VARIANT_OBJ
+	ENUM_VALUE_OBJ
+	RANGE_OBJ
+	ITERATOR_OBJ
+	GENERATOR_OBJ
+	CHANNEL_OBJ
+	TASK_OBJ
+	WAIT_GROUP_OBJ
+	PROMISE_OBJ
 	RETURN_VALUE_OBJ
 )
 
@@ -27,9 +54,30 @@ var (
 		NULL_OBJ:         "NULL",
 		ERROR_OBJ:        "ERROR",
 		BOOL_OBJ:         "BOOL",
+		INT_OBJ:          "INT",
+		FLOAT_OBJ:        "FLOAT",
 		STRING_OBJ:       "STRING",
+		ARRAY_OBJ:        "ARRAY",
+		MAP_OBJ:          "MAP",
 		FUN_OBJ:          "FUNCTION",
 		BUILTIN_OBJ:      "BUILTIN",
+		NAMESPACE_OBJ:    "NAMESPACE",
+		REGEX_OBJ:        "REGEX",
+		RECORD_TYPE_OBJ:  "RECORD_TYPE",
+		RECORD_OBJ:       "RECORD",
+		CLASS_OBJ:        "CLASS",
+		INSTANCE_OBJ:     "INSTANCE",
+		SUPER_OBJ:        "SUPER",
+		ENUM_OBJ:         "ENUM",
+		VARIANT_OBJ:      "VARIANT",
+		ENUM_VALUE_OBJ:   "ENUM_VALUE",
+		RANGE_OBJ:        "RANGE",
+		ITERATOR_OBJ:     "ITERATOR",
+		GENERATOR_OBJ:    "GENERATOR",
+		CHANNEL_OBJ:      "CHANNEL",
+		TASK_OBJ:         "TASK",
+		WAIT_GROUP_OBJ:   "WAIT_GROUP",
+		PROMISE_OBJ:      "PROMISE",
 		RETURN_VALUE_OBJ: "RETURN_VALUE",
 	}
 )
@@ -47,6 +95,74 @@ type Object interface {
 	IsTruthy() bool
 }
 
+// A container is an Object holding other Objects, which may in turn hold it.
+type container interface {
+	Object
+	// parts returns the elements of the container and the text printed
+	// around them: text[i] precedes elems[i], and the last text ends.
+	parts() (text []string, elems []Object)
+}
+
+// inspect returns the Inspect output of obj. Containers being inspected
+// are printed as [...] so that cyclic values can be printed. It keeps its
+// own stack, so that deeply nested values cannot exhaust the Go stack.
+func inspect(obj Object) string {
+	var out strings.Builder
+	inProgress := make(map[Object]bool)
+
+	// Each item of the stack is text to write, an Object to inspect, or the
+	// end of a container, once its text is written.
+	type item struct {
+		text string
+		obj  Object
+		end  container
+	}
+	stack := []item{{obj: obj}}
+	for len(stack) > 0 {
+		it := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		switch {
+		case it.end != nil:
+			delete(inProgress, it.end)
+			continue
+		case it.obj == nil:
+			out.WriteString(it.text)
+			continue
+		}
+
+		c, ok := it.obj.(container)
+		if !ok {
+			out.WriteString(it.obj.Inspect())
+			continue
+		}
+		if inProgress[c] {
+			out.WriteString("[...]")
+			continue
+		}
+		inProgress[c] = true
+
+		text, elems := c.parts()
+		stack = append(stack, item{end: c}, item{text: text[len(elems)]})
+		for i := len(elems) - 1; i >= 0; i-- {
+			stack = append(stack, item{obj: elems[i]}, item{text: text[i]})
+		}
+	}
+	return out.String()
+}
+
+// A HashKey identifies the value of a Hashable object used as a Map key.
+type HashKey struct {
+	Type  ObjType
+	Value uint64
+}
+
+// Objects usable as Map keys implement the Hashable interface
+type Hashable interface {
+	Object
+	HashKey() HashKey
+}
+
 type Bool struct {
 	Value bool
 }
@@ -54,6 +170,37 @@ type Bool struct {
 func (b *Bool) Type() ObjType   { return BOOL_OBJ }
 func (b *Bool) Inspect() string { return fmt.Sprintf("%t", b.Value) }
 func (b *Bool) IsTruthy() bool  { return b.Value }
+func (b *Bool) HashKey() HashKey {
+	if b.Value {
+		return HashKey{Type: BOOL_OBJ, Value: 1}
+	}
+	return HashKey{Type: BOOL_OBJ, Value: 0}
+}
+
+// nativeBool returns the shared Bool object for b.
+func nativeBool(b bool) *Bool {
+	if b {
+		return TRUE
+	}
+	return FALSE
+}
+
+type Int struct {
+	Value int64
+}
+
+func (i *Int) Type() ObjType    { return INT_OBJ }
+func (i *Int) Inspect() string  { return strconv.FormatInt(i.Value, 10) }
+func (i *Int) IsTruthy() bool   { return i.Value != 0 }
+func (i *Int) HashKey() HashKey { return HashKey{Type: INT_OBJ, Value: uint64(i.Value)} }
+
+type Float struct {
+	Value float64
+}
+
+func (f *Float) Type() ObjType   { return FLOAT_OBJ }
+func (f *Float) Inspect() string { return strconv.FormatFloat(f.Value, 'g', -1, 64) }
+func (f *Float) IsTruthy() bool  { return f.Value != 0 }
 
 type String struct {
 	Value string
@@ -62,11 +209,118 @@ type String struct {
 func (s *String) Type() ObjType   { return STRING_OBJ }
 func (s *String) Inspect() string { return s.Value }
 func (b *String) IsTruthy() bool  { return true }
+func (s *String) HashKey() HashKey {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(s.Value))
+	return HashKey{Type: STRING_OBJ, Value: h.Sum64()}
+}
+
+type Array struct {
+	Elems  []Object
+	Frozen bool // set by freeze, see Freeze
+}
+
+func (a *Array) Type() ObjType   { return ARRAY_OBJ }
+func (a *Array) Inspect() string { return inspect(a) }
+func (a *Array) parts() ([]string, []Object) {
+	return listParts("[", a.Elems, "]"), a.Elems
+}
+func (a *Array) IsTruthy() bool { return true }
+
+// listParts returns the text of a container printing elems separated by
+// commas between open and close, see container.
+func listParts(open string, elems []Object, close string) []string {
+	return fieldParts(open, nil, elems, close)
+}
+
+// fieldParts is listParts, printing each of elems after its name in names,
+// if names is not nil.
+func fieldParts(open string, names []string, elems []Object, close string) []string {
+	if len(elems) == 0 {
+		return []string{open + close}
+	}
+	text := make([]string, 0, len(elems)+1)
+	sep := open
+	for i := range elems {
+		if names != nil {
+			text = append(text, sep+names[i]+": ")
+		} else {
+			text = append(text, sep)
+		}
+		sep = ", "
+	}
+	return append(text, close)
+}
+
+type MapPair struct {
+	Key   Object
+	Value Object
+}
+
+type Map struct {
+	Pairs  map[HashKey]MapPair
+	Frozen bool // set by freeze, see Freeze
+}
+
+func NewMap() *Map {
+	return &Map{Pairs: make(map[HashKey]MapPair)}
+}
+
+func (m *Map) Type() ObjType   { return MAP_OBJ }
+func (m *Map) Inspect() string { return inspect(m) }
+func (m *Map) parts() ([]string, []Object) {
+	var text []string
+	var elems []Object
+	sep := "{"
+	for _, pair := range m.SortedPairs() {
+		text = append(text, sep, ": ")
+		elems = append(elems, pair.Key, pair.Value)
+		sep = ", "
+	}
+	if len(elems) == 0 {
+		return []string{"{}"}, nil
+	}
+	return append(text, "}"), elems
+}
+func (m *Map) IsTruthy() bool { return true }
+
+// Get returns the value stored under key, if any.
+func (m *Map) Get(key Hashable) (Object, bool) {
+	pair, ok := m.Pairs[key.HashKey()]
+	return pair.Value, ok
+}
+
+// Set stores value under key.
+func (m *Map) Set(key Hashable, value Object) {
+	m.Pairs[key.HashKey()] = MapPair{Key: key, Value: value}
+}
+
+// SortedPairs returns the pairs of m ordered by key type, then key, so that
+// iterating over a Map is deterministic.
+func (m *Map) SortedPairs() []MapPair {
+	pairs := make([]MapPair, 0, len(m.Pairs))
+	for _, pair := range m.Pairs {
+		pairs = append(pairs, pair)
+	}
+	sort.Slice(pairs, func(i, j int) bool {
+		ki, kj := pairs[i].Key, pairs[j].Key
+		if ki.Type() != kj.Type() {
+			return ki.Type() < kj.Type()
+		}
+		if a, ok := ki.(*Int); ok {
+			return a.Value < kj.(*Int).Value
+		}
+		return ki.Inspect() < kj.Inspect()
+	})
+	return pairs
+}
 
 type Fun struct {
-	Params []*ast.Ident
-	Body   *ast.BlockStmt
-	Env    *Env
+	Params    []ast.Pattern
+	Body      *ast.BlockStmt
+	Env       *Env
+	Generator bool // calling it returns a Generator instead of running Body
+	Async     bool // calling it returns a Promise of the result of Body
 }
 
 func (f *Fun) Type() ObjType { return FUN_OBJ }
@@ -75,16 +329,53 @@ func (f *Fun) Inspect() string {
 }
 func (b *Fun) IsTruthy() bool { return true }
 
-type BuiltinFun func(args ...Object) Object
+// A BuiltinFun implements a Builtin. It is called with the context and Env
+// of the call so that it can consult the permissions and I/O of the runtime.
+// It must pass ctx on to any Eval or Env.Apply it calls, which otherwise
+// deadlocks waiting for the task evaluating the call.
+type BuiltinFun func(ctx context.Context, env *Env, args ...Object) Object
+
+// VariadicArity is the Arity of a Builtin accepting any number of arguments.
+const VariadicArity = -1
 
 type Builtin struct {
-	Fun BuiltinFun
+	Name  string
+	Fun   BuiltinFun
+	Arity int
 }
 
 func (b *Builtin) Type() ObjType   { return BUILTIN_OBJ }
 func (b *Builtin) Inspect() string { return "<function>" }
 func (b *Builtin) IsTruthy() bool  { return true }
 
+// A Namespace groups related objects under a single name, e.g. strings.upper.
+// Once scripts may use a Namespace its Members must only be accessed with
+// Get, so that hosts can register builtins in it while scripts run.
+type Namespace struct {
+	Name    string
+	Members map[string]Object
+
+	mu sync.RWMutex // guards Members
+}
+
+// Get returns the member called name, if there is one.
+func (ns *Namespace) Get(name string) (Object, bool) {
+	ns.mu.RLock()
+	defer ns.mu.RUnlock()
+	obj, ok := ns.Members[name]
+	return obj, ok
+}
+
+func (ns *Namespace) set(name string, obj Object) {
+	ns.mu.Lock()
+	defer ns.mu.Unlock()
+	ns.Members[name] = obj
+}
+
+func (ns *Namespace) Type() ObjType   { return NAMESPACE_OBJ }
+func (ns *Namespace) Inspect() string { return "<namespace " + ns.Name + ">" }
+func (ns *Namespace) IsTruthy() bool  { return true }
+
 type ReturnValue struct {
 	Value Object
 }
@@ -99,13 +390,63 @@ func (n *Null) Type() ObjType   { return NULL_OBJ }
 func (n *Null) Inspect() string { return "null" }
 func (b *Null) IsTruthy() bool  { return false }
 
+// An ErrorKind classifies an Error so that hosts can tell runtime errors in
+// a script apart from evaluation being stopped.
+type ErrorKind int
+
+const (
+	RUNTIME_ERROR ErrorKind = iota
+	TIMEOUT_ERROR
+	CANCELED_ERROR
+	BUDGET_EXCEEDED_ERROR
+	STACK_OVERFLOW_ERROR
+	MEMORY_LIMIT_ERROR
+	PERMISSION_DENIED_ERROR
+	NOT_FOUND_ERROR
+	ALREADY_EXISTS_ERROR
+	ACCESS_DENIED_ERROR
+	IO_ERROR
+	TASK_LIMIT_ERROR
+)
+
+var errorKinds = map[ErrorKind]string{
+	RUNTIME_ERROR:           "RUNTIME_ERROR",
+	TIMEOUT_ERROR:           "TIMEOUT",
+	CANCELED_ERROR:          "CANCELED",
+	BUDGET_EXCEEDED_ERROR:   "BUDGET_EXCEEDED",
+	STACK_OVERFLOW_ERROR:    "STACK_OVERFLOW",
+	MEMORY_LIMIT_ERROR:      "MEMORY_LIMIT_EXCEEDED",
+	PERMISSION_DENIED_ERROR: "PERMISSION_DENIED",
+	NOT_FOUND_ERROR:         "NOT_FOUND",
+	ALREADY_EXISTS_ERROR:    "ALREADY_EXISTS",
+	ACCESS_DENIED_ERROR:     "ACCESS_DENIED",
+	IO_ERROR:                "IO_ERROR",
+	TASK_LIMIT_ERROR:        "TASK_LIMIT_EXCEEDED",
+}
+
+func (ek ErrorKind) String() string {
+	if k, ok := errorKinds[ek]; ok {
+		return k
+	}
+	return ""
+}
+
 type Error struct {
-	Msg string
+	Kind   ErrorKind
+	Msg    string
+	Frames []string // innermost first, set for STACK_OVERFLOW_ERROR
 }
 
-func (e *Error) Type() ObjType   { return ERROR_OBJ }
-func (e *Error) Inspect() string { return "ERROR: " + e.Msg }
-func (b *Error) IsTruthy() bool  { return true }
+func (e *Error) Type() ObjType { return ERROR_OBJ }
+func (e *Error) Inspect() string {
+	var out strings.Builder
+	out.WriteString("ERROR: " + e.Msg)
+	for _, frame := range e.Frames {
+		out.WriteString("\n\tat " + frame)
+	}
+	return out.String()
+}
+func (b *Error) IsTruthy() bool { return true }
 
 func newError(format string, a ...interface{}) *Error {
 	return &Error{Msg: fmt.Sprintf(format, a...)}